@@ -0,0 +1,403 @@
+package nadago
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// AdminClient manages studies in a NADA catalog through its administrative API.
+// baseurl is the API root (e.g. https://example.org/index.php/api) rather than
+// the catalog endpoint used by Client
+type AdminClient struct {
+	apiURL     string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewAdminClient creates a client for the admin API. Of the options, only
+// those setting the base URL and HTTP client apply. Caching, rate limiting,
+// circuit breaking and retries are for catalog reads, so writes go straight to
+// the HTTP client and a streamed upload is never sent twice
+func NewAdminClient(baseurl, apiKey string, opts ...Option) *AdminClient {
+	// the transport is not wrapped, unlike NewClient
+	c := &Client{apiURL: baseurl, httpClient: http.DefaultClient, compat: &compatibility{}}
+	for _, o := range opts {
+		o(c)
+	}
+
+	return &AdminClient{
+		apiURL:     c.apiURL,
+		apiKey:     apiKey,
+		httpClient: c.httpClient,
+	}
+}
+
+type TitleStatement struct {
+	Idno     string `json:"idno"`
+	Title    string `json:"title"`
+	SubTitle string `json:"sub_title,omitempty"`
+	AltTitle string `json:"alt_title,omitempty"`
+}
+
+type Nation struct {
+	Name         string `json:"name"`
+	Abbreviation string `json:"abbreviation,omitempty"`
+}
+
+type StudyInfo struct {
+	Abstract     string   `json:"abstract,omitempty"`
+	Nation       []Nation `json:"nation,omitempty"`
+	GeogCoverage string   `json:"geog_coverage,omitempty"`
+	AnalysisUnit string   `json:"analysis_unit,omitempty"`
+	Universe     string   `json:"universe,omitempty"`
+	DataKind     string   `json:"data_kind,omitempty"`
+}
+
+type StudyDesc struct {
+	TitleStatement TitleStatement         `json:"title_statement"`
+	StudyInfo      StudyInfo              `json:"study_info,omitempty"`
+	Method         map[string]interface{} `json:"method,omitempty"`
+}
+
+// StudyRequest is the body used to create or update a survey study
+type StudyRequest struct {
+	RepositoryId string                 `json:"repositoryid,omitempty"`
+	AccessPolicy string                 `json:"access_policy,omitempty"`
+	Published    int                    `json:"published"`
+	Overwrite    string                 `json:"overwrite,omitempty"`
+	DocDesc      map[string]interface{} `json:"doc_desc,omitempty"`
+	StudyDesc    StudyDesc              `json:"study_desc"`
+}
+
+// ResourceRequest is the body used to attach an external resource to a study.
+// Either Url or File must be set
+type ResourceRequest struct {
+	Type        string    `json:"dctype"`
+	Title       string    `json:"title"`
+	Format      string    `json:"dcformat,omitempty"`
+	Author      string    `json:"author,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Url         string    `json:"filename,omitempty"`
+	File        io.Reader `json:"-"`
+	FileName    string    `json:"-"`
+	Overwrite   string    `json:"overwrite,omitempty"`
+}
+
+var idnoPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+var isoCountryPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var resourceTypes = map[string]bool{
+	"doc/adm": true, "doc/anl": true, "doc/oth": true, "doc/qst": true,
+	"doc/ref": true, "doc/rep": true, "doc/tec": true, "doc/pub": true,
+	"dat/micro": true, "dat": true, "tbl": true, "prg": true, "web": true,
+}
+
+func (s StudyRequest) Validate() error {
+	ts := s.StudyDesc.TitleStatement
+	if ts.Idno == "" {
+		return ValidationErr{Field: "study_desc.title_statement.idno", Message: "is required"}
+	}
+	if !idnoPattern.MatchString(ts.Idno) {
+		return ValidationErr{Field: "study_desc.title_statement.idno", Message: "may only contain letters, digits, '.', '-' and '_'"}
+	}
+	if ts.Title == "" {
+		return ValidationErr{Field: "study_desc.title_statement.title", Message: "is required"}
+	}
+	if s.Published != 0 && s.Published != 1 {
+		return ValidationErr{Field: "published", Message: "must be 0 or 1"}
+	}
+	if s.Overwrite != "" && s.Overwrite != "yes" && s.Overwrite != "no" {
+		return ValidationErr{Field: "overwrite", Message: `must be "yes" or "no"`}
+	}
+	for _, n := range s.StudyDesc.StudyInfo.Nation {
+		if n.Name == "" {
+			return ValidationErr{Field: "study_desc.study_info.nation", Message: "name is required"}
+		}
+		if n.Abbreviation != "" && !isoCountryPattern.MatchString(n.Abbreviation) {
+			return ValidationErr{Field: "study_desc.study_info.nation", Message: fmt.Sprintf("%q is not an ISO 3166 alpha-3 code", n.Abbreviation)}
+		}
+	}
+	return nil
+}
+
+func (r ResourceRequest) Validate() error {
+	if r.Title == "" {
+		return ValidationErr{Field: "title", Message: "is required"}
+	}
+	if !resourceTypes[r.Type] {
+		return ValidationErr{Field: "dctype", Message: fmt.Sprintf("unknown resource type %q", r.Type)}
+	}
+	if r.Url == "" && r.File == nil {
+		return ValidationErr{Field: "filename", Message: "a url or file is required"}
+	}
+	if r.File != nil && r.FileName == "" {
+		return ValidationErr{Field: "filename", Message: "a file name is required when uploading a file"}
+	}
+	return nil
+}
+
+// CreateStudy creates a new survey study from the request
+func (a *AdminClient) CreateStudy(ctx context.Context, study StudyRequest) (SurveyMeta, error) {
+	if err := study.Validate(); err != nil {
+		return SurveyMeta{}, err
+	}
+
+	var meta SurveyMeta
+	if err := a.sendJSON(ctx, "POST", "/datasets/create/survey", study, &meta); err != nil {
+		return SurveyMeta{}, err
+	}
+	meta.Idno = study.StudyDesc.TitleStatement.Idno
+
+	return meta, nil
+}
+
+// UpdateStudy replaces the metadata of an existing survey study
+func (a *AdminClient) UpdateStudy(ctx context.Context, study StudyRequest) (SurveyMeta, error) {
+	if err := study.Validate(); err != nil {
+		return SurveyMeta{}, err
+	}
+
+	idno := study.StudyDesc.TitleStatement.Idno
+	var meta SurveyMeta
+	if err := a.sendJSON(ctx, "POST", "/datasets/update/survey/"+idno, study, &meta); err != nil {
+		return SurveyMeta{}, err
+	}
+	meta.Idno = idno
+
+	return meta, nil
+}
+
+func (a *AdminClient) PublishStudy(ctx context.Context, idno string) error {
+	return a.setPublished(ctx, idno, 1)
+}
+
+func (a *AdminClient) UnpublishStudy(ctx context.Context, idno string) error {
+	return a.setPublished(ctx, idno, 0)
+}
+
+func (a *AdminClient) setPublished(ctx context.Context, idno string, published int) error {
+	if err := validateIdno(idno); err != nil {
+		return err
+	}
+	body := map[string]int{"published": published}
+	return a.sendJSON(ctx, "POST", "/datasets/options/"+idno, body, nil)
+}
+
+func (a *AdminClient) DeleteStudy(ctx context.Context, idno string) error {
+	if err := validateIdno(idno); err != nil {
+		return err
+	}
+	return a.send(ctx, "DELETE", "/datasets/"+idno, nil, "", nil)
+}
+
+// ImportDDI uploads a DDI-Codebook XML file, creating the study or replacing
+// it when overwrite is true
+func (a *AdminClient) ImportDDI(ctx context.Context, ddi io.Reader, filename string, overwrite bool) (SurveyMeta, error) {
+	if filename == "" {
+		return SurveyMeta{}, ValidationErr{Field: "file", Message: "a file name is required"}
+	}
+
+	fields := map[string]string{"overwrite": "no"}
+	if overwrite {
+		fields["overwrite"] = "yes"
+	}
+
+	body, contentType := multipartBody(fields, "file", filename, ddi)
+
+	var meta SurveyMeta
+	if err := a.send(ctx, "POST", "/datasets/import_ddi", body, contentType, &meta); err != nil {
+		return SurveyMeta{}, err
+	}
+	meta.Idno = stringOf(lookup(meta.Data, "idno"))
+
+	return meta, nil
+}
+
+// AddResource attaches an external resource to a study, uploading the file
+// when one is provided
+func (a *AdminClient) AddResource(ctx context.Context, idno string, res ResourceRequest) (Resource, error) {
+	if err := validateIdno(idno); err != nil {
+		return Resource{}, err
+	}
+	if err := res.Validate(); err != nil {
+		return Resource{}, err
+	}
+
+	var out struct {
+		Resource Resource `json:"resource"`
+	}
+
+	if res.File == nil {
+		if err := a.sendJSON(ctx, "POST", "/resources/"+idno, res, &out); err != nil {
+			return Resource{}, err
+		}
+		return out.Resource, nil
+	}
+
+	fields := map[string]string{
+		"dctype":      res.Type,
+		"title":       res.Title,
+		"dcformat":    res.Format,
+		"author":      res.Author,
+		"description": res.Description,
+		"overwrite":   res.Overwrite,
+	}
+	body, contentType := multipartBody(fields, "file", res.FileName, res.File)
+	if err := a.send(ctx, "POST", "/resources/"+idno, body, contentType, &out); err != nil {
+		return Resource{}, err
+	}
+
+	return out.Resource, nil
+}
+
+// UploadThumbnail sets the thumbnail image shown for a study in the catalog
+func (a *AdminClient) UploadThumbnail(ctx context.Context, idno string, image io.Reader, filename string) error {
+	if err := validateIdno(idno); err != nil {
+		return err
+	}
+	if filename == "" {
+		return ValidationErr{Field: "file", Message: "a file name is required"}
+	}
+
+	body, contentType := multipartBody(nil, "file", filename, image)
+
+	return a.send(ctx, "POST", "/datasets/thumbnail/"+idno, body, contentType, nil)
+}
+
+func validateIdno(idno string) error {
+	if !idnoPattern.MatchString(idno) {
+		return ValidationErr{Field: "idno", Message: fmt.Sprintf("invalid idno %q", idno)}
+	}
+	return nil
+}
+
+// multipartBody streams the form fields and file as a multipart body, encoding
+// them as the request reads it rather than holding the file in memory. Fields
+// are written in key order so the same request always has the same body. The
+// body must be closed so the encoder stops if the request is abandoned
+func multipartBody(fields map[string]string, fileField, filename string, file io.Reader) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	go func() {
+		for _, k := range keys {
+			v := fields[k]
+			if v == "" {
+				continue
+			}
+			if err := mw.WriteField(k, v); err != nil {
+				pw.CloseWithError(AppErr{
+					Message:    fmt.Errorf("failed to encode form field. %w", err).Error(),
+					StatusCode: 1001,
+				})
+				return
+			}
+		}
+
+		fw, err := mw.CreateFormFile(fileField, filename)
+		if err == nil {
+			_, err = io.Copy(fw, file)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		if err != nil {
+			pw.CloseWithError(AppErr{
+				Message:    fmt.Errorf("failed to encode file upload. %w", err).Error(),
+				StatusCode: 1001,
+			})
+			return
+		}
+		pw.Close()
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+func (a *AdminClient) sendJSON(ctx context.Context, method, path string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return AppErr{
+			Message:    fmt.Errorf("failed to marshal request body. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	return a.send(ctx, method, path, bytes.NewReader(b), "application/json", out)
+}
+
+func (a *AdminClient) send(ctx context.Context, method, path string, body io.Reader, contentType string, out interface{}) error {
+	// closing a streamed body stops its writer when the request is not sent
+	if c, ok := body.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if a.apiKey == "" {
+		return AppErr{
+			Message:    "an API key is required for the admin API",
+			StatusCode: 1001,
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.apiURL+path, body)
+	if err != nil {
+		return AppErr{
+			Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	req.Header.Set("X-API-KEY", a.apiKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return AppErr{
+			Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the admin API explains rejected requests in the body
+		var failed struct {
+			Message string `json:"message"`
+		}
+		msg := "non-200 status code from the API"
+		if json.NewDecoder(resp.Body).Decode(&failed) == nil && failed.Message != "" {
+			msg += ": " + failed.Message
+		}
+		return FetchErr{
+			Message:    msg,
+			StatusCode: resp.StatusCode,
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return AppErr{
+			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,339 @@
+package nadago
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAdminAPI is a minimal stand-in for the NADA administrative API
+type fakeAdminAPI struct {
+	mu        sync.Mutex
+	apiKey    string
+	studies   map[string]map[string]interface{}
+	resources map[string][]string
+	thumbs    map[string]string
+}
+
+func newFakeAdminAPI(apiKey string) *fakeAdminAPI {
+	return &fakeAdminAPI{
+		apiKey:    apiKey,
+		studies:   map[string]map[string]interface{}{},
+		resources: map[string][]string{},
+		thumbs:    map[string]string{},
+	}
+}
+
+func (f *fakeAdminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"status": "failed", "message": msg})
+	}
+
+	if r.Header.Get("X-API-KEY") != f.apiKey {
+		fail(http.StatusForbidden, "invalid API key")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == "POST" && len(parts) == 3 && parts[1] == "create":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		idno := body["study_desc"].(map[string]interface{})["title_statement"].(map[string]interface{})["idno"].(string)
+		if _, ok := f.studies[idno]; ok && body["overwrite"] != "yes" {
+			fail(http.StatusBadRequest, "study already exists")
+			return
+		}
+		body["idno"] = idno
+		f.studies[idno] = body
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "dataset": body})
+
+	case r.Method == "POST" && len(parts) == 4 && parts[1] == "update":
+		if _, ok := f.studies[parts[3]]; !ok {
+			fail(http.StatusNotFound, "study not found")
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.studies[parts[3]] = body
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "dataset": body})
+
+	case r.Method == "POST" && len(parts) == 3 && parts[1] == "options":
+		study, ok := f.studies[parts[2]]
+		if !ok {
+			fail(http.StatusNotFound, "study not found")
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		study["published"] = body["published"]
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "datasets":
+		if _, ok := f.studies[parts[1]]; !ok {
+			fail(http.StatusNotFound, "study not found")
+			return
+		}
+		delete(f.studies, parts[1])
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "import_ddi":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			fail(http.StatusBadRequest, "missing file")
+			return
+		}
+		meta, _, err := ParseDDI(file)
+		if err != nil {
+			fail(http.StatusBadRequest, "invalid DDI")
+			return
+		}
+		f.studies[meta.Idno] = meta.Data.(map[string]interface{})
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success", "dataset": meta.Data})
+
+	case r.Method == "POST" && len(parts) == 2 && parts[0] == "resources":
+		var title string
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			title = r.FormValue("title")
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				fail(http.StatusBadRequest, "missing file")
+				return
+			}
+			io.Copy(io.Discard, file)
+		} else {
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			title = body["title"].(string)
+		}
+		f.resources[parts[1]] = append(f.resources[parts[1]], title)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":   "success",
+			"resource": map[string]interface{}{"resource_id": len(f.resources[parts[1]]), "title": title},
+		})
+
+	case r.Method == "POST" && len(parts) == 3 && parts[1] == "thumbnail":
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			fail(http.StatusBadRequest, "missing file")
+			return
+		}
+		f.thumbs[parts[2]] = header.Filename
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+
+	default:
+		fail(http.StatusNotFound, "unknown endpoint")
+	}
+}
+
+func testStudyRequest() StudyRequest {
+	return StudyRequest{
+		RepositoryId: "central",
+		StudyDesc: StudyDesc{
+			TitleStatement: TitleStatement{
+				Idno:  "KEN_2022_HFS_v01_M",
+				Title: "High Frequency Survey 2022",
+			},
+			StudyInfo: StudyInfo{
+				Abstract: "Phone survey of households.",
+				Nation:   []Nation{{Name: "Kenya", Abbreviation: "KEN"}},
+			},
+		},
+	}
+}
+
+func TestAdminClient(t *testing.T) {
+	api := newFakeAdminAPI("secret")
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	admin := NewAdminClient(ts.URL, "secret")
+	ctx := context.Background()
+
+	t.Run("create, publish, update and delete a study", func(t *testing.T) {
+		meta, err := admin.CreateStudy(ctx, testStudyRequest())
+		assert.NoError(t, err)
+		assert.Equal(t, "KEN_2022_HFS_v01_M", meta.Idno)
+		assert.NotNil(t, meta.Data)
+
+		_, err = admin.CreateStudy(ctx, testStudyRequest())
+		assert.Equal(t, FetchErr{
+			Message:    "non-200 status code from the API: study already exists",
+			StatusCode: http.StatusBadRequest,
+		}, err)
+
+		assert.NoError(t, admin.PublishStudy(ctx, "KEN_2022_HFS_v01_M"))
+		assert.Equal(t, float64(1), api.studies["KEN_2022_HFS_v01_M"]["published"])
+
+		assert.NoError(t, admin.UnpublishStudy(ctx, "KEN_2022_HFS_v01_M"))
+		assert.Equal(t, float64(0), api.studies["KEN_2022_HFS_v01_M"]["published"])
+
+		update := testStudyRequest()
+		update.StudyDesc.TitleStatement.Title = "High Frequency Survey 2022, Round 1"
+		_, err = admin.UpdateStudy(ctx, update)
+		assert.NoError(t, err)
+
+		assert.NoError(t, admin.DeleteStudy(ctx, "KEN_2022_HFS_v01_M"))
+		assert.NotContains(t, api.studies, "KEN_2022_HFS_v01_M")
+
+		err = admin.DeleteStudy(ctx, "KEN_2022_HFS_v01_M")
+		assert.IsType(t, FetchErr{}, err)
+	})
+
+	t.Run("import ddi", func(t *testing.T) {
+		meta, err := admin.ImportDDI(ctx, strings.NewReader(expectedDDIResponse), "lfs.xml", false)
+		assert.NoError(t, err)
+		assert.NotNil(t, meta.Data)
+		assert.Equal(t, "ALB_2019_LFS_v01_M", meta.Idno)
+		assert.Contains(t, api.studies, "ALB_2019_LFS_v01_M")
+	})
+
+	t.Run("attach resources and thumbnail", func(t *testing.T) {
+		res, err := admin.AddResource(ctx, "ALB_2019_LFS_v01_M", ResourceRequest{
+			Type:  "doc/qst",
+			Title: "Questionnaire",
+			Url:   "https://example.org/questionnaire.pdf",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "Questionnaire", res.Title)
+
+		res, err = admin.AddResource(ctx, "ALB_2019_LFS_v01_M", ResourceRequest{
+			Type:     "doc/rep",
+			Title:    "Report",
+			File:     strings.NewReader("%PDF-1.4"),
+			FileName: "report.pdf",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, res.Id)
+		assert.Equal(t, []string{"Questionnaire", "Report"}, api.resources["ALB_2019_LFS_v01_M"])
+
+		err = admin.UploadThumbnail(ctx, "ALB_2019_LFS_v01_M", strings.NewReader("png"), "thumb.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "thumb.png", api.thumbs["ALB_2019_LFS_v01_M"])
+	})
+
+	t.Run("validates before sending", func(t *testing.T) {
+		study := testStudyRequest()
+		study.StudyDesc.TitleStatement.Title = ""
+		_, err := admin.CreateStudy(ctx, study)
+		assert.Equal(t, ValidationErr{Field: "study_desc.title_statement.title", Message: "is required"}, err)
+
+		study = testStudyRequest()
+		study.StudyDesc.TitleStatement.Idno = "bad idno"
+		_, err = admin.CreateStudy(ctx, study)
+		assert.IsType(t, ValidationErr{}, err)
+
+		study = testStudyRequest()
+		study.StudyDesc.StudyInfo.Nation[0].Abbreviation = "Kenya"
+		_, err = admin.CreateStudy(ctx, study)
+		assert.IsType(t, ValidationErr{}, err)
+
+		_, err = admin.AddResource(ctx, "ALB_2019_LFS_v01_M", ResourceRequest{Type: "doc/xyz", Title: "x", Url: "u"})
+		assert.IsType(t, ValidationErr{}, err)
+
+		_, err = admin.AddResource(ctx, "ALB_2019_LFS_v01_M", ResourceRequest{Type: "doc/qst", Title: "x"})
+		assert.IsType(t, ValidationErr{}, err)
+
+		assert.IsType(t, ValidationErr{}, admin.DeleteStudy(ctx, "../etc"))
+	})
+
+	t.Run("uploads are streamed", func(t *testing.T) {
+		received := make(chan string, 2)
+		upload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mr, err := r.MultipartReader()
+			assert.NoError(t, err)
+			part, err := mr.NextPart()
+			assert.NoError(t, err)
+			head := make([]byte, 5)
+			_, err = io.ReadFull(part, head)
+			assert.NoError(t, err)
+			received <- string(head)
+			rest, _ := io.ReadAll(part)
+			received <- string(rest)
+		}))
+		defer upload.Close()
+
+		// the rest of the file is only written once the server has read the start
+		file, fw := io.Pipe()
+		go func() {
+			fw.Write([]byte("first"))
+			select {
+			case <-received:
+				fw.Write([]byte(" second"))
+				fw.Close()
+			case <-time.After(5 * time.Second):
+				fw.CloseWithError(errors.New("upload was not streamed"))
+			}
+		}()
+
+		err := NewAdminClient(upload.URL, "secret").UploadThumbnail(ctx, "ALB_2019_LFS_v01_M", file, "thumb.png")
+		if assert.NoError(t, err) {
+			assert.Equal(t, " second", <-received)
+		}
+	})
+
+	t.Run("form fields in order", func(t *testing.T) {
+		body, contentType := multipartBody(map[string]string{"title": "Report", "dctype": "doc/rep", "author": "", "overwrite": "no"}, "file", "report.pdf", strings.NewReader("%PDF-1.4"))
+		defer body.Close()
+		_, params, err := mime.ParseMediaType(contentType)
+		assert.NoError(t, err)
+
+		var names []string
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				assert.Equal(t, io.EOF, err)
+				break
+			}
+			names = append(names, part.FormName())
+		}
+		assert.Equal(t, []string{"dctype", "overwrite", "title", "file"}, names)
+	})
+
+	t.Run("catalog options do not wrap writes", func(t *testing.T) {
+		hc := &http.Client{}
+		a := NewAdminClient(ts.URL, "secret", WithHTTPClient(hc), WithCache(time.Minute, 10),
+			WithRateLimit(1, 1), WithCircuitBreaker(BreakerConfig{}), WithRetry(3, time.Second))
+		assert.Same(t, hc, a.httpClient)
+		assert.Nil(t, hc.Transport)
+
+		a = NewAdminClient(ts.URL, "secret", WithCache(time.Minute, 10))
+		assert.Same(t, http.DefaultClient, a.httpClient)
+	})
+
+	t.Run("failed uploads", func(t *testing.T) {
+		file := io.MultiReader(strings.NewReader("png"), iotest.ErrReader(errors.New("disk error")))
+		err := admin.UploadThumbnail(ctx, "ALB_2019_LFS_v01_M", file, "thumb.png")
+		assert.IsType(t, AppErr{}, err)
+		assert.ErrorContains(t, err, "failed to encode file upload. disk error")
+	})
+
+	t.Run("requires api key", func(t *testing.T) {
+		_, err := NewAdminClient(ts.URL, "").CreateStudy(ctx, testStudyRequest())
+		assert.IsType(t, AppErr{}, err)
+
+		err = NewAdminClient(ts.URL, "wrong").PublishStudy(ctx, "ALB_2019_LFS_v01_M")
+		assert.Equal(t, FetchErr{
+			Message:    "non-200 status code from the API: invalid API key",
+			StatusCode: http.StatusForbidden,
+		}, err)
+	})
+}
@@ -0,0 +1,285 @@
+package nadago
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests with ErrCircuitOpen without sending them
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through to test the catalog
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures a circuit breaker. A request fails when it cannot
+// be completed or is answered with 429 or a 5xx status; other responses count
+// as successes. Requests cancelled by their caller do not count
+type BreakerConfig struct {
+	// ConsecutiveFailures trips the breaker after this many failures in a row.
+	// Zero disables the check
+	ConsecutiveFailures int
+
+	// ErrorRate trips the breaker when at least this fraction of the requests
+	// in the last Window failed, once MinRequests were made. Zero disables the
+	// check. Window defaults to a minute and is counted in ten slices, so
+	// windows shorter than ten nanoseconds are lengthened to that
+	ErrorRate   float64
+	MinRequests int
+	Window      time.Duration
+
+	// OpenFor is how long the breaker stays open before letting probes through.
+	// The default is 30 seconds
+	OpenFor time.Duration
+
+	// Probes is how many requests are let through while half-open. The breaker
+	// closes once they all succeed and opens again if any fails. The default is 1
+	Probes int
+
+	// OnStateChange is called with the catalog host on every state change
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// WithCircuitBreaker stops sending requests to the catalog while it is failing,
+// so calls fail fast with ErrCircuitOpen instead of waiting to time out.
+// Responses from the cache are still served while the breaker is open.
+// Requests to other hosts, such as resource downloads, neither count nor are
+// stopped, so a failing download server cannot cut off the catalog
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(c *Client) {
+		c.breaker = newCircuitBreaker(cfg)
+	}
+}
+
+// CircuitState reports the state of the circuit breaker, which is always
+// closed for clients without one
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.state
+}
+
+// windowBuckets is how many slices the error rate window is counted in
+const windowBuckets = 10
+
+type outcomeBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+type circuitBreaker struct {
+	cfg BreakerConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	state       CircuitState
+	consecutive int
+	buckets     [windowBuckets]outcomeBucket
+	openedAt    time.Time
+	probing     int
+	probed      int
+
+	// changes are reported once the lock is released
+	changes [][2]CircuitState
+}
+
+func newCircuitBreaker(cfg BreakerConfig) *circuitBreaker {
+	if cfg.OpenFor <= 0 {
+		cfg.OpenFor = 30 * time.Second
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = 1
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	if cfg.Window < windowBuckets {
+		cfg.Window = windowBuckets
+	}
+	return &circuitBreaker{cfg: cfg, now: time.Now}
+}
+
+// allow reports whether a request may be sent, and whether it is a probe
+func (b *circuitBreaker) allow(host string) (bool, error) {
+	b.mu.Lock()
+	defer b.unlock(host)
+
+	now := b.now()
+	if b.state == CircuitOpen {
+		until := b.openedAt.Add(b.cfg.OpenFor)
+		if now.Before(until) {
+			return false, ErrCircuitOpen{Host: host, Until: until}
+		}
+		b.setState(CircuitHalfOpen)
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probing+b.probed >= b.cfg.Probes {
+			return false, ErrCircuitOpen{Host: host, Until: now.Add(b.cfg.OpenFor)}
+		}
+		b.probing++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record counts the outcome of a request let through by allow. Requests that
+// neither failed nor succeeded, such as those cancelled by the caller, only
+// give back their probe
+func (b *circuitBreaker) record(host string, probe, counted, failed bool) {
+	b.mu.Lock()
+	defer b.unlock(host)
+
+	if probe {
+		b.probing--
+	}
+	if !counted {
+		return
+	}
+
+	if b.state == CircuitHalfOpen {
+		if !probe {
+			// sent before the breaker opened
+			return
+		}
+		if failed {
+			b.trip()
+			return
+		}
+		b.probed++
+		if b.probed >= b.cfg.Probes {
+			b.reset()
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+	if b.state == CircuitOpen {
+		return
+	}
+
+	bucket := b.bucket(b.now())
+	bucket.requests++
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+	bucket.failures++
+	b.consecutive++
+
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.trip()
+		return
+	}
+	if b.cfg.ErrorRate > 0 {
+		requests, failures := b.window(b.now())
+		if requests >= b.cfg.MinRequests && float64(failures)/float64(requests) >= b.cfg.ErrorRate {
+			b.trip()
+		}
+	}
+}
+
+func (b *circuitBreaker) trip() {
+	b.reset()
+	b.openedAt = b.now()
+	b.setState(CircuitOpen)
+}
+
+func (b *circuitBreaker) reset() {
+	b.consecutive = 0
+	b.buckets = [windowBuckets]outcomeBucket{}
+	b.probed = 0
+}
+
+func (b *circuitBreaker) setState(to CircuitState) {
+	if b.state != to {
+		b.changes = append(b.changes, [2]CircuitState{b.state, to})
+	}
+	b.state = to
+}
+
+// unlock releases the lock and then reports state changes, so the callback
+// may use the client
+func (b *circuitBreaker) unlock(host string) {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.cfg.OnStateChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.cfg.OnStateChange(host, c[0], c[1])
+	}
+}
+
+// bucket returns the bucket counting requests made at t, clearing it if it
+// was last used for an earlier slice of time
+func (b *circuitBreaker) bucket(t time.Time) *outcomeBucket {
+	width := b.cfg.Window / windowBuckets
+	start := t.Truncate(width)
+	bucket := &b.buckets[int(start.UnixNano()/int64(width))%windowBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = outcomeBucket{start: start}
+	}
+	return bucket
+}
+
+// window sums the requests counted in the window ending at t
+func (b *circuitBreaker) window(t time.Time) (requests, failures int) {
+	from := t.Add(-b.cfg.Window)
+	for _, bucket := range b.buckets {
+		if bucket.start.After(from) {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+type breakerTransport struct {
+	breaker *circuitBreaker
+	// host is the catalog host, requests elsewhere bypass the breaker
+	host string
+	next http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	if t.host != "" && host != t.host {
+		return t.next.RoundTrip(req)
+	}
+	probe, err := t.breaker.allow(host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		t.breaker.record(host, probe, req.Context().Err() == nil, true)
+	default:
+		t.breaker.record(host, probe, true, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500)
+	}
+	return resp, err
+}
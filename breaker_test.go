@@ -0,0 +1,213 @@
+package nadago
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	var status int32 = http.StatusServiceUnavailable
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if s := int(atomic.LoadInt32(&status)); s != http.StatusOK {
+			w.WriteHeader(s)
+			return
+		}
+		w.Write([]byte(`{"dataset":{"title":"Labour Force Survey"}}`))
+	}))
+	defer ts.Close()
+
+	var mu sync.Mutex
+	var changes []string
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewClient(ts.URL, WithRetry(5, time.Millisecond), WithCircuitBreaker(BreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenFor:             time.Minute,
+		OnStateChange: func(host string, from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, fmt.Sprintf("%s -> %s", from, to))
+		},
+	}))
+	client.breaker.now = clock.Now
+
+	// the third failed attempt trips the breaker, which stops the retries
+	_, err := client.GetSurveyMeta(ctx, "X")
+	assert.Equal(t, ErrCircuitOpen{Host: ts.Listener.Addr().String(), Until: clock.Now().Add(time.Minute)}, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	_, err = client.GetVarMeta(ctx, "X", "V1")
+	assert.IsType(t, ErrCircuitOpen{}, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+
+	// a failed probe opens the breaker again
+	clock.Add(time.Minute)
+	_, err = client.GetSurveyMeta(ctx, "X")
+	assert.IsType(t, ErrCircuitOpen{}, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&hits))
+
+	clock.Add(time.Minute)
+	atomic.StoreInt32(&status, http.StatusOK)
+	meta, err := client.GetSurveyMeta(ctx, "X")
+	assert.NoError(t, err)
+	assert.Equal(t, "Labour Force Survey", meta.Title())
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	assert.Equal(t, []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}, changes)
+
+	t.Run("client errors do not count", func(t *testing.T) {
+		atomic.StoreInt32(&status, http.StatusNotFound)
+		for i := 0; i < 5; i++ {
+			_, err := client.GetSurveyMeta(ctx, "X")
+			assert.IsType(t, FetchErr{}, err)
+		}
+		assert.Equal(t, CircuitClosed, client.CircuitState())
+	})
+
+	t.Run("cached responses are served while open", func(t *testing.T) {
+		atomic.StoreInt32(&status, http.StatusOK)
+		client := NewClient(ts.URL, WithCache(time.Minute, 10), WithCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1}))
+		_, err := client.GetSurveyMeta(ctx, "X")
+		assert.NoError(t, err)
+
+		atomic.StoreInt32(&status, http.StatusBadGateway)
+		_, err = client.GetVarMeta(ctx, "X", "V1")
+		assert.IsType(t, FetchErr{}, err)
+		assert.Equal(t, CircuitOpen, client.CircuitState())
+
+		_, err = client.GetSurveyMeta(ctx, "X")
+		assert.NoError(t, err)
+		_, err = client.GetVarMeta(ctx, "X", "V2")
+		assert.IsType(t, ErrCircuitOpen{}, err)
+	})
+
+	t.Run("downloads from other hosts do not count", func(t *testing.T) {
+		atomic.StoreInt32(&status, http.StatusOK)
+		files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer files.Close()
+
+		client := NewClient(ts.URL, WithCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1}))
+		for i := 0; i < 3; i++ {
+			_, err := client.DownloadResource(ctx, Resource{Url: files.URL + "/q.pdf"}, &bytes.Buffer{})
+			assert.IsType(t, FetchErr{}, err)
+		}
+		assert.Equal(t, CircuitClosed, client.CircuitState())
+
+		_, err := client.GetSurveyMeta(ctx, "X")
+		assert.NoError(t, err)
+	})
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(BreakerConfig{ErrorRate: 0.5, MinRequests: 4, Window: 10 * time.Second})
+	b.now = clock.Now
+
+	send := func(failed bool) {
+		probe, err := b.allow("catalog")
+		assert.NoError(t, err)
+		b.record("catalog", probe, true, failed)
+	}
+
+	// failures outside the window are forgotten
+	send(true)
+	send(true)
+	clock.Add(11 * time.Second)
+	send(true)
+	send(false)
+	send(false)
+	assert.Equal(t, CircuitClosed, b.state)
+
+	// too few requests to judge
+	clock.Add(11 * time.Second)
+	send(true)
+	send(true)
+	send(true)
+	assert.Equal(t, CircuitClosed, b.state)
+
+	clock.Add(time.Second)
+	send(false)
+	assert.Equal(t, CircuitClosed, b.state)
+	send(true)
+	assert.Equal(t, CircuitOpen, b.state)
+}
+
+func TestCircuitBreakerShortWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(BreakerConfig{ErrorRate: 0.5, MinRequests: 1, Window: time.Nanosecond})
+	b.now = clock.Now
+	assert.Equal(t, windowBuckets*time.Nanosecond, b.cfg.Window)
+
+	probe, err := b.allow("catalog")
+	assert.NoError(t, err)
+	b.record("catalog", probe, true, true)
+	assert.Equal(t, CircuitOpen, b.state)
+}
+
+func TestCircuitBreakerProbes(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := newCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenFor: time.Second, Probes: 2})
+	b.now = clock.Now
+
+	probe, _ := b.allow("catalog")
+	b.record("catalog", probe, true, true)
+	assert.Equal(t, CircuitOpen, b.state)
+
+	clock.Add(time.Second)
+	first, err := b.allow("catalog")
+	assert.NoError(t, err)
+	assert.True(t, first)
+	second, err := b.allow("catalog")
+	assert.NoError(t, err)
+	_, err = b.allow("catalog")
+	assert.IsType(t, ErrCircuitOpen{}, err)
+
+	// a cancelled probe gives back its place
+	b.record("catalog", first, false, true)
+	assert.Equal(t, CircuitHalfOpen, b.state)
+	third, err := b.allow("catalog")
+	assert.NoError(t, err)
+
+	b.record("catalog", second, true, false)
+	assert.Equal(t, CircuitHalfOpen, b.state)
+	b.record("catalog", third, true, false)
+	assert.Equal(t, CircuitClosed, b.state)
+}
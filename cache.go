@@ -0,0 +1,245 @@
+package nadago
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WithCache keeps successful GET responses in memory for ttl, holding at most
+// maxEntries responses and evicting the least recently used first. Catalog
+// metadata rarely changes, so repeated lookups of the same study or variable
+// are answered without a request. Responses larger than 4 MiB, downloads,
+// exports and range requests are not cached
+func WithCache(ttl time.Duration, maxEntries int) Option {
+	return func(c *Client) {
+		c.cache = newResponseCache(ttl, maxEntries)
+	}
+}
+
+// WithRateLimit limits requests to perSecond on average, allowing bursts of up
+// to burst requests. Requests answered from the cache are not counted. A rate
+// of zero or less means no limit
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		if !(perSecond > 0) {
+			c.limiter = nil
+			return
+		}
+		c.limiter = newRateLimiter(perSecond, burst)
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose calls skip the response cache, for
+// reads that must see the current state of the catalog. Their responses still
+// refresh the cache
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func skipsCache(ctx context.Context) bool {
+	skip, _ := ctx.Value(noCacheKey{}).(bool)
+	return skip
+}
+
+// ClearCache drops every cached response
+func (c *Client) ClearCache() {
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
+
+// wrapTransport installs the cache, circuit breaker and rate limiter in front
+// of the transport of a copy of the configured http client
+func (c *Client) wrapTransport() {
+	if c.cache == nil && c.limiter == nil && c.breaker == nil {
+		return
+	}
+
+	hc := *c.httpClient
+	next := hc.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if c.limiter != nil {
+		next = &limitedTransport{limiter: c.limiter, next: next}
+	}
+	if c.breaker != nil {
+		var host string
+		if u, err := url.Parse(c.apiURL); err == nil {
+			host = u.Host
+		}
+		next = &breakerTransport{breaker: c.breaker, host: host, next: next}
+	}
+	if c.cache != nil {
+		next = &cachingTransport{cache: c.cache, next: next}
+	}
+	hc.Transport = next
+	c.httpClient = &hc
+}
+
+type cachedResponse struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		max:     maxEntries,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (rc *responseCache) get(key string) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	el, ok := rc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cachedResponse)
+	if rc.now().After(entry.expires) {
+		rc.lru.Remove(el)
+		delete(rc.entries, key)
+		return nil, false
+	}
+	rc.lru.MoveToFront(el)
+	return entry, true
+}
+
+func (rc *responseCache) put(entry *cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry.expires = rc.now().Add(rc.ttl)
+	if el, ok := rc.entries[entry.key]; ok {
+		el.Value = entry
+		rc.lru.MoveToFront(el)
+		return
+	}
+	rc.entries[entry.key] = rc.lru.PushFront(entry)
+
+	for rc.max > 0 && rc.lru.Len() > rc.max {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+func (rc *responseCache) clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries = map[string]*list.Element{}
+	rc.lru.Init()
+}
+
+type cachingTransport struct {
+	cache *responseCache
+	next  http.RoundTripper
+}
+
+// maxCachedBody is the largest response body kept in the cache
+const maxCachedBody = 4 << 20
+
+// RoundTrip answers GET requests from the cache. Other responses are streamed
+// to the caller as they arrive and stored once they have been read to the end,
+// unless they are larger than maxCachedBody. Downloads, exports and range
+// requests are never cached
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state, _ := req.Context().Value(callStateKey{}).(*callState)
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" || (state != nil && state.uncached) {
+		return t.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	if !skipsCache(req.Context()) {
+		if entry, ok := t.cache.get(key); ok {
+			if state != nil {
+				state.cacheHit = true
+			}
+			return &http.Response{
+				Status:        http.StatusText(entry.status),
+				StatusCode:    entry.status,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        entry.header.Clone(),
+				Body:          io.NopCloser(bytes.NewReader(entry.body)),
+				ContentLength: int64(len(entry.body)),
+				Request:       req,
+			}, nil
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || resp.ContentLength > maxCachedBody {
+		return resp, err
+	}
+
+	header := resp.Header.Clone()
+	resp.Body = &cachingBody{
+		ReadCloser: resp.Body,
+		store: func(body []byte) {
+			t.cache.put(&cachedResponse{key: key, status: http.StatusOK, header: header, body: body})
+		},
+	}
+	return resp, nil
+}
+
+// cachingBody copies a response body as it is read, storing the copy when the
+// body has been read to the end. Decoders that stop early leave the rest to be
+// read on Close. Bodies that grow past maxCachedBody are not stored
+type cachingBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	store func([]byte)
+	full  bool
+	done  bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.full && !b.done {
+		if b.buf.Len()+n > maxCachedBody {
+			b.full = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.full && !b.done {
+		b.done = true
+		b.store(b.buf.Bytes())
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	if !b.full && !b.done {
+		io.Copy(io.Discard, io.LimitReader(b, maxCachedBody+1-int64(b.buf.Len())))
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,180 @@
+package nadago
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(fmt.Sprint(expectedSurveymetaResponse)))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	t.Run("repeated requests are served from the cache", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+
+		first, err := client.GetSurveyMeta(ctx, "ARG_2021_HFS-Q1Q2_v01_M")
+		assert.NoError(t, err)
+		second, err := client.GetSurveyMeta(ctx, "ARG_2021_HFS-Q1Q2_v01_M")
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+		client.ClearCache()
+		_, err = client.GetSurveyMeta(ctx, "ARG_2021_HFS-Q1Q2_v01_M")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		for i := 0; i < 2; i++ {
+			_, err := client.GetSurveyMeta(ctx, "missing")
+			assert.Error(t, err)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("calls without the cache refresh it", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		for i := 0; i < 2; i++ {
+			_, err := client.GetSurveyMeta(WithoutCache(ctx), "ARG_2021_HFS-Q1Q2_v01_M")
+			assert.NoError(t, err)
+		}
+		_, err := client.GetSurveyMeta(ctx, "ARG_2021_HFS-Q1Q2_v01_M")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("keeps the configured http client", func(t *testing.T) {
+		hc := &http.Client{Timeout: time.Second}
+		client := NewClient(ts.URL, WithHTTPClient(hc), WithCache(time.Minute, 10))
+		assert.Equal(t, time.Second, client.httpClient.Timeout)
+		assert.Nil(t, hc.Transport)
+	})
+}
+
+func TestResponseCache(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := newResponseCache(time.Minute, 2)
+	rc.now = func() time.Time { return now }
+
+	rc.put(&cachedResponse{key: "a"})
+	rc.put(&cachedResponse{key: "b"})
+	_, ok := rc.get("a")
+	assert.True(t, ok)
+
+	// b is least recently used
+	rc.put(&cachedResponse{key: "c"})
+	_, ok = rc.get("b")
+	assert.False(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = rc.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, rc.lru.Len())
+}
+
+func TestCacheStreaming(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	large := `{"dataset":{"title":"` + strings.Repeat("x", maxCachedBody) + `"}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/search":
+			w.Write([]byte(expectedSearchResponse))
+		case "/slow":
+			w.Write([]byte("first "))
+			w.(http.Flusher).Flush()
+			<-release
+			w.Write([]byte("second"))
+		case "/LARGE":
+			w.Write([]byte(large))
+		default:
+			w.Write([]byte(expectedDDIResponse))
+		}
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	count := func(fn func()) int32 {
+		atomic.StoreInt32(&hits, 0)
+		fn()
+		fn()
+		return atomic.LoadInt32(&hits)
+	}
+
+	t.Run("responses are streamed while they are cached", func(t *testing.T) {
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		resp, err := client.httpClient.Get(ts.URL + "/slow")
+		assert.NoError(t, err)
+		buf := make([]byte, 6)
+		_, err = io.ReadFull(resp.Body, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "first ", string(buf))
+		close(release)
+		rest, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", string(rest))
+		resp.Body.Close()
+
+		entry, ok := client.cache.get(ts.URL + "/slow")
+		assert.True(t, ok)
+		assert.Equal(t, "first second", string(entry.body))
+	})
+
+	t.Run("responses decoded partly are cached", func(t *testing.T) {
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		assert.Equal(t, int32(1), count(func() {
+			_, err := client.Search(ctx, NewDefaultSearchParams())
+			assert.NoError(t, err)
+		}))
+	})
+
+	t.Run("exports and range requests are not cached", func(t *testing.T) {
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		assert.Equal(t, int32(2), count(func() {
+			body, err := client.GetStudyExport(ctx, "X", ExportDDI)
+			assert.NoError(t, err)
+			body.Close()
+		}))
+		assert.Equal(t, int32(2), count(func() {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+"/X/ddi", nil)
+			req.Header.Set("Range", "bytes=10-")
+			resp, err := client.httpClient.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+		}))
+	})
+
+	t.Run("large responses are not cached", func(t *testing.T) {
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+		assert.Equal(t, int32(2), count(func() {
+			meta, err := client.GetSurveyMeta(ctx, "LARGE")
+			assert.NoError(t, err)
+			assert.Len(t, meta.Title(), maxCachedBody)
+		}))
+	})
+}
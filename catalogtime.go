@@ -0,0 +1,132 @@
+package nadago
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CatalogTime is a timestamp sent by a catalog. NADA sends RFC 3339 times,
+// MySQL style "2006-01-02 15:04:05" times without a zone, compact "20060102"
+// dates, Unix epochs in seconds or milliseconds as numbers or strings, and
+// empty strings or zero dates for unknown times, which are read as the zero
+// time
+type CatalogTime struct {
+	time.Time
+
+	// Raw is the value as sent, with numbers in their JSON form
+	Raw string
+
+	// AssumedUTC is set when the value had no time zone and was read as UTC
+	AssumedUTC bool
+}
+
+// compactDate is tried before epochs, as eight digit epochs would fall in 1970
+// to 1973
+const compactDate = "20060102"
+
+// minMillis is the smallest epoch read as milliseconds. Seconds this large
+// would be tens of thousands of years away
+const minMillis = 1e12
+
+// zonelessLayouts are read as UTC
+var zonelessLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseCatalogTime reads a timestamp in any of the formats NADA catalogs send
+func ParseCatalogTime(s string) (CatalogTime, error) {
+	t := CatalogTime{Raw: s}
+	v := strings.TrimSpace(s)
+	if v == "" || strings.HasPrefix(v, "0000-00-00") {
+		return t, nil
+	}
+
+	if len(v) == len(compactDate) {
+		if parsed, err := time.Parse(compactDate, v); err == nil {
+			t.Time = parsed
+			t.AssumedUTC = true
+			return t, nil
+		}
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		switch {
+		case sec >= minMillis:
+			t.Time = time.UnixMilli(sec).UTC()
+		case sec > 0:
+			t.Time = time.Unix(sec, 0).UTC()
+		}
+		return t, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		t.Time = parsed
+		return t, nil
+	}
+	for _, layout := range zonelessLayouts {
+		if parsed, err := time.Parse(layout, v); err == nil {
+			t.Time = parsed
+			t.AssumedUTC = true
+			return t, nil
+		}
+	}
+	return CatalogTime{}, fmt.Errorf("unrecognised catalog time %q", s)
+}
+
+func (t *CatalogTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*t = CatalogTime{}
+		return nil
+	}
+
+	var s string
+	if data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	} else {
+		// epochs sent as numbers, possibly with a fraction
+		f, err := strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("unrecognised catalog time %s", data)
+		}
+		s = strconv.FormatInt(int64(f), 10)
+	}
+
+	parsed, err := ParseCatalogTime(s)
+	if err != nil {
+		return err
+	}
+	parsed.Raw = string(data)
+	if data[0] == '"' {
+		parsed.Raw = s
+	}
+	*t = parsed
+	return nil
+}
+
+// catalogTimeOf reads a decoded JSON value as a CatalogTime. Values in an
+// unrecognised format give the zero time with only Raw set
+func catalogTimeOf(value interface{}) CatalogTime {
+	s := stringOf(value)
+	if f, ok := value.(float64); ok {
+		s = strconv.FormatInt(int64(f), 10)
+	}
+	t, err := ParseCatalogTime(s)
+	if err != nil {
+		return CatalogTime{Raw: s}
+	}
+	return t
+}
+
+// MarshalJSON writes the time in RFC 3339, or null for the zero time
+func (t CatalogTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return t.Time.MarshalJSON()
+}
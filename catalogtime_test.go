@@ -0,0 +1,96 @@
+package nadago
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogTime(t *testing.T) {
+	may11 := time.Date(2022, 5, 11, 11, 14, 45, 0, time.UTC)
+
+	t.Run("formats", func(t *testing.T) {
+		for _, tc := range []struct {
+			json   string
+			want   time.Time
+			raw    string
+			assume bool
+		}{
+			{`"2022-05-11T11:14:45+00:00"`, may11, "2022-05-11T11:14:45+00:00", false},
+			{`"2022-05-11T13:14:45.000+02:00"`, may11, "2022-05-11T13:14:45.000+02:00", false},
+			{`"2022-05-11 11:14:45"`, may11, "2022-05-11 11:14:45", true},
+			{`"2022-05-11T11:14:45"`, may11, "2022-05-11T11:14:45", true},
+			{`"2022-05-11"`, time.Date(2022, 5, 11, 0, 0, 0, 0, time.UTC), "2022-05-11", true},
+			{`"1652267685"`, may11, "1652267685", false},
+			{`1652267685`, may11, "1652267685", false},
+			{`1652267685.5`, may11, "1652267685.5", false},
+			{`"1652267685000"`, may11, "1652267685000", false},
+			{`1652267685000`, may11, "1652267685000", false},
+			{`"20220511"`, time.Date(2022, 5, 11, 0, 0, 0, 0, time.UTC), "20220511", true},
+			{`""`, time.Time{}, "", false},
+			{`" "`, time.Time{}, " ", false},
+			{`"0"`, time.Time{}, "0", false},
+			{`"0000-00-00 00:00:00"`, time.Time{}, "0000-00-00 00:00:00", false},
+			{`null`, time.Time{}, "", false},
+		} {
+			var got CatalogTime
+			assert.NoError(t, json.Unmarshal([]byte(tc.json), &got), tc.json)
+			assert.True(t, tc.want.Equal(got.Time), tc.json)
+			assert.Equal(t, tc.raw, got.Raw, tc.json)
+			assert.Equal(t, tc.assume, got.AssumedUTC, tc.json)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{`"yesterday"`, `"11/05/2022"`, `true`, `{}`} {
+			var got CatalogTime
+			assert.Error(t, json.Unmarshal([]byte(s), &got), s)
+		}
+	})
+
+	t.Run("marshal", func(t *testing.T) {
+		b, err := json.Marshal(struct {
+			Created CatalogTime
+			Changed CatalogTime
+		}{Created: CatalogTime{Time: may11, Raw: "2022-05-11 11:14:45", AssumedUTC: true}})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"Created":"2022-05-11T11:14:45Z","Changed":null}`, string(b))
+	})
+
+	t.Run("search rows in any format", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"result":{"rows":[
+				{"idno":"A","title":"A","created":"2022-05-11T11:14:45+00:00","changed":"2022-05-11 11:14:45"},
+				{"idno":"B","title":"B","created":1652267685,"changed":""},
+				{"idno":"C","title":"C","created":null}]}}`))
+		}))
+		defer ts.Close()
+
+		surveys, err := NewClient(ts.URL).Search(context.Background(), NewDefaultSearchParams())
+		assert.NoError(t, err)
+		assert.Len(t, surveys, 3)
+		for _, s := range surveys[:2] {
+			assert.True(t, may11.Equal(s.Created.Time), s.Idno)
+		}
+		assert.True(t, may11.Equal(surveys[0].Changed.Time))
+		assert.True(t, surveys[0].Changed.AssumedUTC)
+		assert.True(t, surveys[1].Changed.IsZero())
+		assert.True(t, surveys[2].Created.IsZero())
+	})
+
+	t.Run("study metadata", func(t *testing.T) {
+		meta := SurveyMeta{Data: map[string]interface{}{"created": "2022-05-11 11:14:45", "changed": float64(1652267685)}}
+		assert.Equal(t, CatalogTime{Time: may11, Raw: "2022-05-11 11:14:45", AssumedUTC: true}, meta.Created())
+		assert.True(t, may11.Equal(meta.Changed().Time))
+		assert.Equal(t, "1652267685", meta.Changed().Raw)
+
+		meta = SurveyMeta{Data: map[string]interface{}{"created": "soon"}}
+		assert.Equal(t, CatalogTime{Raw: "soon"}, meta.Created())
+		assert.Equal(t, CatalogTime{}, meta.Changed())
+	})
+}
@@ -2,6 +2,7 @@ package nadago
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 )
@@ -9,6 +10,17 @@ import (
 type Client struct {
 	apiURL     string
 	httpClient *http.Client
+	cache      *responseCache
+	limiter    *rateLimiter
+	flights    *flightGroup
+	breaker    *circuitBreaker
+	compat     *compatibility
+	driftHook  func(DriftReport)
+	retry      retryPolicy
+	metrics    Metrics
+	tracer     Tracer
+	logger     *slog.Logger
+	logLevels  logLevels
 }
 
 type Option func(c *Client)
@@ -17,11 +29,16 @@ func NewClient(baseurl string, opts ...Option) *Client {
 	client := &Client{
 		apiURL:     baseurl,
 		httpClient: http.DefaultClient,
+		metrics:    noopMetrics{},
+		tracer:     noopTracer{},
+		logLevels:  logLevels{success: slog.LevelDebug, retry: slog.LevelWarn, failure: slog.LevelError},
+		compat:     &compatibility{},
 	}
 
 	for _, o := range opts {
 		o(client)
 	}
+	client.wrapTransport()
 
 	return client
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/lint"
+)
+
+type lintConfig struct {
+	catalog string
+	files   bool
+	format  string
+	failOn  lint.Severity
+	timeout time.Duration
+	args    []string
+}
+
+func parseLintFlags(args []string, stderr io.Writer) (lintConfig, error) {
+	cfg := lintConfig{failOn: lint.Error}
+
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "Usage: nadago lint -catalog url [flags] idno...\n       nadago lint -files [flags] ddi.xml...\n\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cfg.catalog, "catalog", "", "url of the catalog API to fetch studies from")
+	fs.BoolVar(&cfg.files, "files", false, "lint DDI files instead of studies in a catalog")
+	fs.StringVar(&cfg.format, "format", "text", "output format, text, json or sarif")
+	fs.Func("fail-on", "lowest severity that makes the command fail, error, warning or info", func(s string) error {
+		sev, err := lint.ParseSeverity(s)
+		cfg.failOn = sev
+		return err
+	})
+	fs.DurationVar(&cfg.timeout, "timeout", 30*time.Second, "timeout of requests to the catalog")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	cfg.args = fs.Args()
+
+	switch cfg.format {
+	case "text", "json", "sarif":
+	default:
+		return cfg, fmt.Errorf("unknown format %q", cfg.format)
+	}
+	if cfg.files == (cfg.catalog != "") {
+		return cfg, errors.New("exactly one of -catalog and -files is required")
+	}
+	if len(cfg.args) == 0 {
+		if cfg.files {
+			return cfg, errors.New("no DDI files given")
+		}
+		return cfg, errors.New("no study idnos given")
+	}
+	return cfg, nil
+}
+
+// studies fetches or reads every study named by the arguments
+func (cfg lintConfig) studies(ctx context.Context) ([]lint.Study, error) {
+	studies := make([]lint.Study, 0, len(cfg.args))
+	if cfg.files {
+		for _, path := range cfg.args {
+			s, err := readDDI(path)
+			if err != nil {
+				return nil, err
+			}
+			studies = append(studies, s)
+		}
+		return studies, nil
+	}
+
+	client := nadago.NewClient(cfg.catalog,
+		nadago.WithHTTPClient(&http.Client{Timeout: cfg.timeout}),
+		nadago.WithRetry(2, time.Second),
+	)
+	for _, idno := range cfg.args {
+		s, err := fetchStudy(ctx, client, idno)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", idno, err)
+		}
+		studies = append(studies, s)
+	}
+	return studies, nil
+}
+
+func readDDI(path string) (lint.Study, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return lint.Study{}, err
+	}
+	defer f.Close()
+
+	meta, vars, err := nadago.ParseDDI(f)
+	if err != nil {
+		return lint.Study{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return lint.Study{Meta: meta, Variables: vars}, nil
+}
+
+// fetchStudy fetches a study with the metadata of all its variables from its
+// DDI export, or variable by variable when the catalog has no export
+func fetchStudy(ctx context.Context, client *nadago.Client, idno string) (lint.Study, error) {
+	meta, vars, err := client.GetStudyDDI(ctx, idno)
+	if err == nil {
+		return lint.Study{Meta: meta, Variables: vars}, nil
+	}
+	var fetchErr nadago.FetchErr
+	if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound {
+		return lint.Study{}, err
+	}
+
+	meta, err = client.GetSurveyMeta(ctx, idno)
+	if err != nil {
+		return lint.Study{}, err
+	}
+	var vids []string
+	err = client.EachSurveyVar(ctx, idno, func(v nadago.Variable) error {
+		vids = append(vids, v.Vid)
+		return nil
+	})
+	if err != nil {
+		return lint.Study{}, err
+	}
+	vars = make([]nadago.Variable, 0, len(vids))
+	for _, vid := range vids {
+		v, err := client.GetVarMeta(ctx, idno, vid)
+		if err != nil {
+			return lint.Study{}, err
+		}
+		vars = append(vars, v)
+	}
+	return lint.Study{Meta: meta, Variables: vars}, nil
+}
+
+func writeReport(w io.Writer, report lint.Report, format string) error {
+	switch format {
+	case "json":
+		return report.WriteJSON(w)
+	case "sarif":
+		return report.WriteSARIF(w)
+	default:
+		_, err := io.WriteString(w, report.Text())
+		return err
+	}
+}
+
+// runLint exits with 1 when a finding is at least as severe as -fail-on, and
+// with 2 when the studies cannot be linted
+func runLint(args []string, stdout, stderr io.Writer) int {
+	cfg, err := parseLintFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "nadago lint: %v\n", err)
+		return 2
+	}
+
+	studies, err := cfg.studies(context.Background())
+	if err != nil {
+		fmt.Fprintf(stderr, "nadago lint: %v\n", err)
+		return 2
+	}
+
+	report := lint.New().Check(studies...)
+	if err := writeReport(stdout, report, cfg.format); err != nil {
+		fmt.Fprintf(stderr, "nadago lint: %v\n", err)
+		return 2
+	}
+	if report.AtLeast(cfg.failOn) {
+		return 1
+	}
+	return 0
+}
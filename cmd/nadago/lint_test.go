@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var lintDDI = `<?xml version="1.0" encoding="UTF-8"?>
+<codeBook xmlns="ddi:codebook:2_5" ID="ALB_2019_LFS_v01_M" version="2.5">
+  <stdyDscr>
+    <citation>
+      <titlStmt>
+        <titl>Labour Force Survey 2019</titl>
+        <IDNo>ALB_2019_LFS_v01_M</IDNo>
+      </titlStmt>
+    </citation>
+    <stdyInfo>
+      <abstract>Quarterly labour force survey.</abstract>
+    </stdyInfo>
+  </stdyDscr>
+  <fileDscr ID="F1">
+    <fileTxt>
+      <fileName>lfs_2019.dta</fileName>
+    </fileTxt>
+  </fileDscr>
+  <dataDscr>
+    <var ID="V1" name="hhid" files="F1" intrvl="contin">
+      <labl>Household identifier</labl>
+      <sumStat type="vald">1200</sumStat>
+    </var>
+    <var ID="V2" name="sex" files="F1" intrvl="discrete">
+      <labl>Sex of respondent</labl>
+      <sumStat type="vald">1200</sumStat>
+      <catgry><catValu>1</catValu><labl>Male</labl><catStat type="freq">590</catStat></catgry>
+      <catgry><catValu>2</catValu><labl>Female</labl><catStat type="freq">600</catStat></catgry>
+    </var>
+  </dataDscr>
+</codeBook>`
+
+func TestParseLintFlags(t *testing.T) {
+	var stderr bytes.Buffer
+
+	cfg, err := parseLintFlags([]string{"-catalog", "http://localhost", "-format", "sarif", "-fail-on", "warning", "A", "B"}, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost", cfg.catalog)
+	assert.Equal(t, "sarif", cfg.format)
+	assert.Equal(t, "warning", string(cfg.failOn))
+	assert.Equal(t, []string{"A", "B"}, cfg.args)
+
+	_, err = parseLintFlags([]string{"A"}, &stderr)
+	assert.EqualError(t, err, "exactly one of -catalog and -files is required")
+
+	_, err = parseLintFlags([]string{"-catalog", "http://localhost"}, &stderr)
+	assert.EqualError(t, err, "no study idnos given")
+
+	_, err = parseLintFlags([]string{"-files", "-format", "xml", "study.xml"}, &stderr)
+	assert.EqualError(t, err, `unknown format "xml"`)
+
+	_, err = parseLintFlags([]string{"-files", "-fail-on", "fatal", "study.xml"}, &stderr)
+	assert.ErrorContains(t, err, `unknown severity "fatal"`)
+}
+
+func TestLintCatalog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ALB_2019_LFS_v01_M/ddi" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(lintDDI))
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"lint", "-catalog", srv.URL, "ALB_2019_LFS_v01_M"}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stderr.String())
+	assert.Equal(t, "ALB_2019_LFS_v01_M: warning: study has no sampling procedure [missing-sampling]\n"+
+		"ALB_2019_LFS_v01_M/V2 (sex): error: category frequencies sum to 1190 but the valid count is 1200 [frequency-mismatch]\n"+
+		"2 findings: 1 errors, 1 warnings, 0 info\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"lint", "-catalog", srv.URL, "-format", "json", "-fail-on", "info", "ALB_2019_LFS_v01_M"}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	var doc struct {
+		Findings []map[string]string `json:"findings"`
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &doc))
+	assert.Len(t, doc.Findings, 2)
+	assert.Equal(t, "missing-sampling", doc.Findings[0]["rule"])
+
+	stdout.Reset()
+	code = run([]string{"lint", "-catalog", srv.URL, "missing"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "nadago lint: missing:")
+}
+
+func TestLintFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "study.xml")
+	assert.NoError(t, os.WriteFile(path, []byte(lintDDI), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"lint", "-files", "-format", "sarif", path}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), `"ruleId": "frequency-mismatch"`)
+	assert.Contains(t, stdout.String(), `"fullyQualifiedName": "ALB_2019_LFS_v01_M/V2"`)
+
+	code = run([]string{"lint", "-files", filepath.Join(t.TempDir(), "absent.xml")}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+}
@@ -0,0 +1,49 @@
+// Command nadago provides command line tools built on the nadago packages.
+//
+// Usage:
+//
+//	nadago serve -catalog ihsn=https://catalog.ihsn.org/index.php/api/catalog [flags]
+//	nadago lint -catalog https://catalog.ihsn.org/index.php/api/catalog [flags] idno...
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	switch args[0] {
+	case "serve":
+		return serve(args[1:], stderr)
+	case "lint":
+		return runLint(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "nadago: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage: nadago <command> [flags]
+
+Commands:
+  serve   run an HTTP gateway in front of one or more catalogs
+  lint    check study and variable metadata for quality problems
+
+Run "nadago <command> -h" for the flags of a command.
+`)
+}
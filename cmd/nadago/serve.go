@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/gateway"
+)
+
+type serveConfig struct {
+	addr      string
+	catalogs  map[string]string
+	cacheTTL  time.Duration
+	cacheSize int
+	rate      float64
+	burst     int
+	timeout   time.Duration
+	origins   string
+
+	breakerFailures int
+	breakerOpen     time.Duration
+
+	// stderr receives circuit breaker state changes
+	stderr io.Writer
+}
+
+func parseServeFlags(args []string, stderr io.Writer) (serveConfig, error) {
+	cfg := serveConfig{catalogs: map[string]string{}, stderr: stderr}
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cfg.addr, "addr", ":8080", "address to listen on")
+	fs.Func("catalog", "catalog to serve as name=url, repeatable", func(s string) error {
+		name, url, ok := strings.Cut(s, "=")
+		if !ok || name == "" || url == "" {
+			return errors.New("expected name=url")
+		}
+		if strings.Contains(name, "/") {
+			return errors.New("catalog names cannot contain /")
+		}
+		cfg.catalogs[name] = url
+		return nil
+	})
+	fs.DurationVar(&cfg.cacheTTL, "cache-ttl", 10*time.Minute, "how long responses are cached, 0 disables caching")
+	fs.IntVar(&cfg.cacheSize, "cache-size", 1000, "maximum cached responses per catalog")
+	fs.Float64Var(&cfg.rate, "rate", 5, "maximum requests per second to each catalog, 0 disables limiting")
+	fs.IntVar(&cfg.burst, "burst", 10, "requests allowed in a burst above the rate")
+	fs.DurationVar(&cfg.timeout, "timeout", 30*time.Second, "timeout of requests to catalogs")
+	fs.StringVar(&cfg.origins, "origins", "*", "comma separated origins allowed by CORS")
+	fs.IntVar(&cfg.breakerFailures, "breaker-failures", 5, "consecutive failures after which requests to a catalog fail fast, 0 disables the circuit breaker")
+	fs.DurationVar(&cfg.breakerOpen, "breaker-open", 30*time.Second, "how long requests to a failing catalog fail fast before it is probed again")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if len(cfg.catalogs) == 0 {
+		return cfg, errors.New("at least one -catalog is required")
+	}
+	return cfg, nil
+}
+
+// handler serves the gateway, with the request metrics of every catalog at
+// /metrics
+func (cfg serveConfig) handler() http.Handler {
+	metrics := nadago.NewMetricsRegistry()
+	clients := make(map[string]*nadago.Client, len(cfg.catalogs))
+	var reportMu sync.Mutex
+	for name, url := range cfg.catalogs {
+		name := name
+		opts := []nadago.Option{
+			nadago.WithHTTPClient(&http.Client{Timeout: cfg.timeout}),
+			nadago.WithMetrics(metrics),
+			nadago.WithCoalescing(),
+		}
+		if cfg.cacheTTL > 0 {
+			opts = append(opts, nadago.WithCache(cfg.cacheTTL, cfg.cacheSize))
+		}
+		if cfg.rate > 0 {
+			opts = append(opts, nadago.WithRateLimit(cfg.rate, cfg.burst))
+		}
+		if cfg.breakerFailures > 0 {
+			opts = append(opts, nadago.WithCircuitBreaker(nadago.BreakerConfig{
+				ConsecutiveFailures: cfg.breakerFailures,
+				OpenFor:             cfg.breakerOpen,
+				OnStateChange: func(host string, from, to nadago.CircuitState) {
+					reportMu.Lock()
+					defer reportMu.Unlock()
+					fmt.Fprintf(cfg.stderr, "nadago serve: catalog %s (%s) circuit %s\n", name, host, to)
+				},
+			}))
+		}
+		clients[name] = nadago.NewClient(url, opts...)
+	}
+
+	var origins []string
+	for _, o := range strings.Split(cfg.origins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.Handle("/", gateway.New(clients, gateway.WithAllowedOrigins(origins...)))
+	return mux
+}
+
+func serve(args []string, stderr io.Writer) int {
+	cfg, err := parseServeFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "nadago serve: %v\n", err)
+		return 2
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.addr,
+		Handler:           cfg.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(stderr, "nadago serve: listening on %s\n", cfg.addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		fmt.Fprintf(stderr, "nadago serve: %v\n", err)
+		return 1
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdown); err != nil {
+		fmt.Fprintf(stderr, "nadago serve: %v\n", err)
+		return 1
+	}
+	return 0
+}
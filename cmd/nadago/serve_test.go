@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServeFlags(t *testing.T) {
+	var stderr bytes.Buffer
+
+	cfg, err := parseServeFlags([]string{
+		"-addr", ":9000",
+		"-catalog", "ihsn=https://catalog.ihsn.org/index.php/api/catalog",
+		"-catalog", "wb=https://microdata.worldbank.org/index.php/api/catalog",
+		"-cache-ttl", "1m",
+		"-rate", "2",
+		"-breaker-failures", "3",
+	}, &stderr)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9000", cfg.addr)
+	assert.Equal(t, map[string]string{
+		"ihsn": "https://catalog.ihsn.org/index.php/api/catalog",
+		"wb":   "https://microdata.worldbank.org/index.php/api/catalog",
+	}, cfg.catalogs)
+	assert.Equal(t, time.Minute, cfg.cacheTTL)
+	assert.Equal(t, float64(2), cfg.rate)
+	assert.Equal(t, 3, cfg.breakerFailures)
+	assert.Equal(t, 30*time.Second, cfg.breakerOpen)
+
+	_, err = parseServeFlags(nil, &stderr)
+	assert.EqualError(t, err, "at least one -catalog is required")
+
+	_, err = parseServeFlags([]string{"-catalog", "ihsn"}, &stderr)
+	assert.ErrorContains(t, err, "expected name=url")
+}
+
+func TestServeHandler(t *testing.T) {
+	cfg, err := parseServeFlags([]string{"-catalog", "ihsn=http://localhost", "-origins", "https://a.example, https://b.example"}, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/catalogs", nil)
+	req.Header.Set("Origin", "https://b.example")
+	cfg.handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"data":["ihsn"]}`, rec.Body.String())
+	assert.Equal(t, "https://b.example", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = httptest.NewRecorder()
+	cfg.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE nadago_requests_total counter")
+}
+
+func TestRun(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: nadago")
+
+	stderr.Reset()
+	assert.Equal(t, 2, run([]string{"bogus"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "bogus"`)
+
+	assert.Equal(t, 0, run([]string{"help"}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "serve")
+}
+
+func TestServeCircuitBreaker(t *testing.T) {
+	catalog := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer catalog.Close()
+
+	var stderr bytes.Buffer
+	cfg, err := parseServeFlags([]string{"-catalog", "ihsn=" + catalog.URL, "-cache-ttl", "0", "-breaker-failures", "1"}, &stderr)
+	assert.NoError(t, err)
+	handler := cfg.handler()
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/catalogs/ihsn/studies/X", nil))
+		assert.NotEqual(t, http.StatusOK, rec.Code)
+	}
+	assert.Contains(t, stderr.String(), "nadago serve: catalog ihsn ("+catalog.Listener.Addr().String()+") circuit open\n")
+}
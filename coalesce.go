@@ -0,0 +1,84 @@
+package nadago
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// WithCoalescing makes concurrent calls to GetSurveyMeta, GetVarMeta,
+// GetSurveyVars and Search with identical parameters share one request. Each
+// caller decodes its own copy of the response. The shared request is only
+// cancelled once every caller waiting on it has given up
+func WithCoalescing() Option {
+	return func(c *Client) {
+		c.flights = &flightGroup{flights: map[string]*flight{}}
+	}
+}
+
+// flightGroup tracks the requests in flight by key
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	body    []byte
+	url     string
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do joins the flight for key, starting one with fetch if there is none. The
+// flight runs detached from the context of the caller that started it, keeping
+// its values, and is cancelled when its last waiter leaves
+func (g *flightGroup) do(ctx context.Context, key string, fetch func(context.Context) ([]byte, string, error)) ([]byte, string, error) {
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if !ok {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		g.flights[key] = f
+		go func() {
+			f.body, f.url, f.err = fetch(fctx)
+			g.forget(key, f)
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.body, f.url, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// under the lock, so later callers start a new flight rather than
+			// join one that is being cancelled
+			g.forgetLocked(key, f)
+			f.cancel()
+		}
+		g.mu.Unlock()
+		return nil, "", AppErr{
+			Message:    fmt.Errorf("failed to complete http request. %w", ctx.Err()).Error(),
+			StatusCode: 1001,
+		}
+	}
+}
+
+func (g *flightGroup) forget(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.forgetLocked(key, f)
+}
+
+func (g *flightGroup) forgetLocked(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
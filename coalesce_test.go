@@ -0,0 +1,194 @@
+package nadago
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waiting counts the callers waiting on flights
+func (g *flightGroup) waiting() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var n int
+	for _, f := range g.flights {
+		n += f.waiters
+	}
+	return n
+}
+
+func TestCoalescing(t *testing.T) {
+	ctx := context.Background()
+
+	var hits int32
+	release := make(chan struct{})
+	cancelled := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			cancelled <- struct{}{}
+			return
+		}
+		switch r.URL.Path {
+		case "/X":
+			w.Write([]byte(`{"dataset":{"title":"Labour Force Survey"}}`))
+		case "/X/variables/V1", "/X/variables/V2":
+			w.Write([]byte(`{"variable":{"name":"age"}}`))
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, WithCoalescing())
+	reset := func() {
+		atomic.StoreInt32(&hits, 0)
+		release = make(chan struct{})
+	}
+
+	t.Run("identical calls share a request", func(t *testing.T) {
+		reset()
+		metas := make([]SurveyMeta, 5)
+		var wg sync.WaitGroup
+		for i := range metas {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				meta, err := client.GetSurveyMeta(ctx, "X")
+				assert.NoError(t, err)
+				metas[i] = meta
+			}(i)
+		}
+		assert.Eventually(t, func() bool { return client.flights.waiting() == 5 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+		for _, meta := range metas {
+			assert.Equal(t, "Labour Force Survey", meta.Title())
+		}
+		// every caller decodes its own copy
+		metas[0].Data.(map[string]interface{})["title"] = "changed"
+		assert.Equal(t, "Labour Force Survey", metas[1].Title())
+	})
+
+	t.Run("different calls do not", func(t *testing.T) {
+		reset()
+		var wg sync.WaitGroup
+		for _, vid := range []string{"V1", "V2"} {
+			wg.Add(1)
+			go func(vid string) {
+				defer wg.Done()
+				_, err := client.GetVarMeta(ctx, "X", vid)
+				assert.NoError(t, err)
+			}(vid)
+		}
+		assert.Eventually(t, func() bool { return client.flights.waiting() == 2 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("one caller giving up does not cancel the others", func(t *testing.T) {
+		reset()
+		cctx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.GetSurveyMeta(cctx, "X")
+			errs <- err
+		}()
+		assert.Eventually(t, func() bool { return client.flights.waiting() == 1 }, time.Second, time.Millisecond)
+
+		done := make(chan SurveyMeta)
+		go func() {
+			meta, err := client.GetSurveyMeta(ctx, "X")
+			assert.NoError(t, err)
+			done <- meta
+		}()
+		assert.Eventually(t, func() bool { return client.flights.waiting() == 2 }, time.Second, time.Millisecond)
+
+		cancel()
+		err := <-errs
+		assert.IsType(t, AppErr{}, err)
+		assert.ErrorContains(t, err, "context canceled")
+
+		close(release)
+		assert.Equal(t, "Labour Force Survey", (<-done).Title())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+		assert.Len(t, cancelled, 0)
+	})
+
+	t.Run("the request is cancelled with its last caller", func(t *testing.T) {
+		reset()
+		cctx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.Search(cctx, NewDefaultSearchParams())
+			errs <- err
+		}()
+		assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 1 }, time.Second, time.Millisecond)
+
+		cancel()
+		assert.ErrorContains(t, <-errs, "context canceled")
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("request was not cancelled")
+		}
+		assert.Equal(t, 0, client.flights.waiting())
+		assert.Empty(t, client.flights.flights)
+	})
+}
+
+func TestCoalescingLastWaiterLeaving(t *testing.T) {
+	for i := 0; i < 2000; i++ {
+		g := &flightGroup{flights: map[string]*flight{}}
+		release := make(chan struct{})
+		fetch := func(ctx context.Context) ([]byte, string, error) {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			if err := ctx.Err(); err != nil {
+				return nil, "", err
+			}
+			return []byte("ok"), "", nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		left := make(chan struct{})
+		go func() {
+			g.do(ctx, "k", fetch)
+			close(left)
+		}()
+		for g.waiting() == 0 {
+			time.Sleep(time.Microsecond)
+		}
+
+		joined := make(chan error, 8)
+		for j := 0; j < cap(joined); j++ {
+			go func() {
+				<-ctx.Done()
+				_, _, err := g.do(context.Background(), "k", fetch)
+				joined <- err
+			}()
+		}
+		cancel()
+		<-left
+		close(release)
+
+		// callers with a live context never get the cancellation of a flight
+		// they joined as its last waiter left
+		for j := 0; j < cap(joined); j++ {
+			if !assert.NoError(t, <-joined) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package nadago
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NADAVersion is the major version of the NADA software serving a catalog
+type NADAVersion int
+
+const (
+	NADAUnknown NADAVersion = 0
+	NADA4       NADAVersion = 4
+	NADA5       NADAVersion = 5
+)
+
+func (v NADAVersion) String() string {
+	switch v {
+	case NADA4:
+		return "4.x"
+	case NADA5:
+		return "5.x"
+	}
+	return "unknown"
+}
+
+// Capabilities describes a catalog as found by Probe. Endpoints are keyed by
+// the names used in metrics, such as "study" or "resources". Endpoints that
+// could not be checked, for example because they need a login or failed with
+// a server error, are left out
+type Capabilities struct {
+	Version   NADAVersion
+	Endpoints map[string]bool
+}
+
+// Supports reports whether the endpoint is available. Endpoints that were not
+// probed are assumed to be
+func (caps Capabilities) Supports(endpoint string) bool {
+	supported, probed := caps.Endpoints[endpoint]
+	return supported || !probed
+}
+
+// probedEndpoints are requested for a study found by search, with the path
+// after the study idno
+var probedEndpoints = []struct{ endpoint, path string }{
+	{"study", ""},
+	{"variables", "/variables"},
+	{"resources", "/resources"},
+	{"export", "/ddi"},
+}
+
+type compatibility struct {
+	mu     sync.Mutex
+	detect bool
+	caps   *Capabilities
+
+	// probing is closed when the probe in progress finishes
+	probing chan struct{}
+}
+
+// WithNADAVersion treats the catalog as running the given version of NADA,
+// normalising its responses without probing it
+func WithNADAVersion(v NADAVersion) Option {
+	return func(c *Client) {
+		c.compat.caps = &Capabilities{Version: v}
+	}
+}
+
+// WithVersionDetection probes the catalog with Probe before the first call
+// that needs it. Responses of NADA 4.x catalogs are then normalised into the
+// same models as 5.x, and calls to endpoints the catalog lacks fail without a
+// request
+func WithVersionDetection() Option {
+	return func(c *Client) {
+		c.compat.detect = true
+	}
+}
+
+// Probe detects the NADA version of the catalog from a one row search, then
+// requests the endpoints of the study found to see which are supported. Only
+// a failed search fails the probe. The result is used by later calls
+func (c *Client) Probe(ctx context.Context) (Capabilities, error) {
+	caps, err := c.probe(ctx)
+	if err != nil {
+		return Capabilities{}, err
+	}
+	c.compat.mu.Lock()
+	c.compat.caps = &caps
+	c.compat.mu.Unlock()
+	return caps, nil
+}
+
+func (c *Client) probe(ctx context.Context) (Capabilities, error) {
+	var response struct {
+		Result struct {
+			Rows   []map[string]interface{} `json:"rows"`
+			Counts json.RawMessage          `json:"search_counts_by_type"`
+		} `json:"result"`
+	}
+	err := c.get(ctx, request{endpoint: "search", path: "/search", query: url.Values{"ps": {"1"}}}, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&response)
+	})
+	if err != nil {
+		return Capabilities{}, err
+	}
+
+	caps := Capabilities{Endpoints: map[string]bool{"search": true}}
+	var idno string
+	switch rows := response.Result.Rows; {
+	case len(rows) > 0 && rows[0]["idno"] != nil:
+		caps.Version = NADA5
+		idno = stringOf(rows[0]["idno"])
+	case len(rows) > 0 && rows[0]["surveyid"] != nil:
+		caps.Version = NADA4
+		idno = stringOf(rows[0]["surveyid"])
+	case response.Result.Counts != nil:
+		// an empty 5.x catalog
+		caps.Version = NADA5
+	}
+	if idno == "" {
+		return caps, nil
+	}
+
+	for _, p := range probedEndpoints {
+		// only the status matters, so a large export is not read into the cache
+		body, err := c.open(ctx, request{
+			endpoint: p.endpoint,
+			path:     "/" + url.PathEscape(idno) + p.path,
+			attrs:    []Attribute{{Key: "nadago.idno", Value: idno}},
+			uncached: true,
+		})
+		var fetchErr FetchErr
+		switch {
+		case err == nil:
+			body.Close()
+			caps.Endpoints[p.endpoint] = true
+		case errors.As(err, &fetchErr) && (fetchErr.StatusCode == http.StatusNotFound || fetchErr.StatusCode == http.StatusMethodNotAllowed):
+			caps.Endpoints[p.endpoint] = false
+		case ctx.Err() != nil:
+			return Capabilities{}, err
+		default:
+			// login gated or failing for now, so calls are still let through
+		}
+	}
+	return caps, nil
+}
+
+// version returns the NADA version responses to the endpoint are normalised
+// from, probing the catalog first if detection is enabled
+func (c *Client) version(ctx context.Context, endpoint string) (NADAVersion, error) {
+	caps, err := c.capabilities(ctx)
+	if err != nil || caps == nil {
+		return NADAUnknown, err
+	}
+	if !caps.Supports(endpoint) {
+		return NADAUnknown, AppErr{
+			Message:    fmt.Sprintf("the catalog does not support the %s endpoint", endpoint),
+			StatusCode: 1001,
+		}
+	}
+	return caps.Version, nil
+}
+
+// capabilities returns the capabilities of the catalog, or nil when they are
+// neither pinned nor detected. Concurrent callers wait for a single probe,
+// which runs without the lock held. A failed probe is not kept, so the next
+// call probes again
+func (c *Client) capabilities(ctx context.Context) (*Capabilities, error) {
+	for {
+		c.compat.mu.Lock()
+		if c.compat.caps != nil || !c.compat.detect {
+			caps := c.compat.caps
+			c.compat.mu.Unlock()
+			return caps, nil
+		}
+		if wait := c.compat.probing; wait != nil {
+			c.compat.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, AppErr{
+					Message:    fmt.Errorf("failed to complete http request. %w", ctx.Err()).Error(),
+					StatusCode: 1001,
+				}
+			}
+		}
+		done := make(chan struct{})
+		c.compat.probing = done
+		c.compat.mu.Unlock()
+
+		caps, err := c.probe(ctx)
+
+		c.compat.mu.Lock()
+		c.compat.probing = nil
+		if err == nil {
+			c.compat.caps = &caps
+		}
+		c.compat.mu.Unlock()
+		close(done)
+
+		if err != nil {
+			return nil, err
+		}
+		return &caps, nil
+	}
+}
+
+// survey4 is a search row of NADA 4.x, which names fields after the DDI
+// elements and sends Unix timestamps
+type survey4 struct {
+	ID       flexInt     `json:"id"`
+	Surveyid string      `json:"surveyid"`
+	Titl     string      `json:"titl"`
+	Nation   string      `json:"nation"`
+	Start    flexInt     `json:"data_coll_start"`
+	End      flexInt     `json:"data_coll_end"`
+	Created  CatalogTime `json:"created"`
+	Changed  CatalogTime `json:"changed"`
+	Varcount flexInt     `json:"varcount"`
+}
+
+// decodeSurvey decodes a search row of the given version into a Survey
+func (c *Client) decodeSurvey(row json.RawMessage, v NADAVersion) (Survey, error) {
+	var s Survey
+	if v != NADA4 {
+		err := s.UnmarshalJSON(row)
+		return s, err
+	}
+
+	var old survey4
+	if err := json.Unmarshal(row, &old); err != nil {
+		return s, err
+	}
+	s = Survey{
+		Idno:     old.Surveyid,
+		Title:    old.Titl,
+		Nation:   old.Nation,
+		Start:    int(old.Start),
+		End:      int(old.End),
+		Created:  old.Created,
+		Changed:  old.Changed,
+		Varcount: int(old.Varcount),
+	}
+	if old.ID != 0 {
+		s.Url = c.studyURL(strconv.Itoa(int(old.ID)))
+	}
+	return s, nil
+}
+
+// studyURL is the catalog page of a study, which 4.x search rows leave out
+func (c *Client) studyURL(id string) string {
+	base, _, _ := strings.Cut(c.apiURL, "?")
+	base, ok := strings.CutSuffix(base, "/api/catalog")
+	if !ok {
+		return ""
+	}
+	return base + "/catalog/" + id
+}
+
+// normaliseStudy renames the fields of 4.x study metadata to their 5.x names,
+// leaving fields the catalog already sends under the new names alone
+func normaliseStudy(data interface{}, v NADAVersion) {
+	m, ok := data.(map[string]interface{})
+	if v != NADA4 || !ok {
+		return
+	}
+	for old, name := range map[string]string{
+		"surveyid":        "idno",
+		"titl":            "title",
+		"data_coll_start": "year_start",
+		"data_coll_end":   "year_end",
+	} {
+		if _, ok := m[name]; !ok && m[old] != nil {
+			m[name] = m[old]
+		}
+	}
+	for _, name := range []string{"created", "changed"} {
+		if t, err := ParseCatalogTime(stringOf(m[name])); err == nil && !t.IsZero() {
+			m[name] = t.Format(time.RFC3339)
+		}
+	}
+}
+
+// normaliseVariableRow turns the ids of a 4.x variable list row, which may be
+// sent as numbers, into the strings 5.x sends
+func normaliseVariableRow(row map[string]interface{}, v NADAVersion) {
+	if v != NADA4 || row == nil {
+		return
+	}
+	for _, key := range []string{"vid", "fid"} {
+		if s := stringOf(row[key]); s != "" {
+			row[key] = s
+		}
+	}
+}
+
+// normaliseVariable gives 4.x variable metadata, which is sent as flat fields,
+// the metadata object of 5.x so the Variable accessors read it the same way.
+// Categories are left as sent, as 4.x only has them as text
+func normaliseVariable(data interface{}, v NADAVersion) {
+	m, ok := data.(map[string]interface{})
+	if v != NADA4 || !ok {
+		return
+	}
+	normaliseVariableRow(m, v)
+	if _, ok := m["metadata"]; ok {
+		return
+	}
+	meta := map[string]interface{}{
+		"file_id": m["fid"],
+		"vid":     m["vid"],
+		"name":    m["name"],
+		"labl":    m["labl"],
+	}
+	if q := stringOf(m["qstn"]); q != "" {
+		meta["var_qstn_qstnlit"] = q
+	}
+	m["metadata"] = meta
+}
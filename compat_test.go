@@ -0,0 +1,251 @@
+package nadago
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCatalog serves the responses keyed by path and 404 for other paths,
+// counting requests
+func newCatalog(t *testing.T, responses map[string]string) (*httptest.Server, *int32) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &hits
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NADA 5", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search":                                 expectedSearchResponse,
+			"/ALB_2020_ES-COVID19-R1_v01_M":           expectedSurveymetaResponse,
+			"/ALB_2020_ES-COVID19-R1_v01_M/variables": expectedVariablesResponse,
+			"/ALB_2020_ES-COVID19-R1_v01_M/resources": expectedResourcesResponse,
+			"/ALB_2020_ES-COVID19-R1_v01_M/ddi":       expectedDDIResponse,
+		})
+
+		caps, err := NewClient(ts.URL).Probe(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, Capabilities{Version: NADA5, Endpoints: map[string]bool{
+			"search": true, "study": true, "variables": true, "resources": true, "export": true,
+		}}, caps)
+
+		// probed endpoints are not cached, only the one row search
+		cached := NewClient(ts.URL, WithCache(time.Minute, 10))
+		_, err = cached.Probe(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, cached.cache.entries, 1)
+	})
+
+	t.Run("NADA 4", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search":                        nada4SearchResponse,
+			"/ALB_2012_LSMS_v01_M":           nada4SurveymetaResponse,
+			"/ALB_2012_LSMS_v01_M/variables": expectedVariablesResponse,
+		})
+
+		caps, err := NewClient(ts.URL).Probe(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, Capabilities{Version: NADA4, Endpoints: map[string]bool{
+			"search": true, "study": true, "variables": true, "resources": false, "export": false,
+		}}, caps)
+		assert.True(t, caps.Supports("variable"))
+		assert.False(t, caps.Supports("resources"))
+	})
+
+	t.Run("empty catalog", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search": `{"result":{"rows":[],"found":0,"total":0,"search_counts_by_type":[]}}`,
+		})
+		caps, err := NewClient(ts.URL).Probe(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, NADA5, caps.Version)
+	})
+
+	t.Run("endpoints that cannot be checked are left out", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/search":
+				w.Write([]byte(nada4SearchResponse))
+			case "/ALB_2012_LSMS_v01_M":
+				w.WriteHeader(http.StatusInternalServerError)
+			case "/ALB_2012_LSMS_v01_M/variables":
+				w.WriteHeader(http.StatusUnauthorized)
+			case "/ALB_2012_LSMS_v01_M/ddi":
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer ts.Close()
+
+		caps, err := NewClient(ts.URL).Probe(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, NADA4, caps.Version)
+		assert.Equal(t, map[string]bool{"search": true, "resources": false}, caps.Endpoints)
+		assert.True(t, caps.Supports("export"))
+		assert.False(t, caps.Supports("resources"))
+	})
+
+	t.Run("search errors", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{})
+		_, err := NewClient(ts.URL).Probe(ctx)
+		assert.Equal(t, FetchErr{Message: "non-200 status code from the API", StatusCode: 404}, err)
+	})
+}
+
+func TestVersionDetection(t *testing.T) {
+	ctx := context.Background()
+	ts, hits := newCatalog(t, map[string]string{
+		"/api/catalog/search":                           nada4SearchResponse,
+		"/api/catalog/ALB_2012_LSMS_v01_M":              nada4SurveymetaResponse,
+		"/api/catalog/ALB_2012_LSMS_v01_M/variables":    nada4VariablesResponse,
+		"/api/catalog/ALB_2012_LSMS_v01_M/variables/V2": nada4VariableResponse,
+	})
+	// 4.x fields are read with the 4.x schemas, so at most coerced
+	var drifted []string
+	client := NewClient(ts.URL+"/api/catalog", WithVersionDetection(), WithDriftHook(func(r DriftReport) {
+		for _, issue := range r.Issues {
+			if issue.Kind != DriftCoerced {
+				drifted = append(drifted, r.Endpoint+" "+issue.Field)
+			}
+		}
+	}))
+
+	surveys, err := client.Search(ctx, NewDefaultSearchParams())
+	assert.NoError(t, err)
+	// the search and four endpoints probed, then the search itself
+	assert.Equal(t, int32(6), atomic.LoadInt32(hits))
+	assert.Len(t, surveys, 2)
+	assert.Equal(t, "ALB_2012_LSMS_v01_M", surveys[0].Idno)
+	assert.Equal(t, "Living Standards Measurement Survey 2012", surveys[0].Title)
+	assert.Equal(t, "Albania", surveys[0].Nation)
+	assert.Equal(t, 2012, surveys[0].Start)
+	assert.Equal(t, 2013, surveys[0].End)
+	assert.Equal(t, 1254, surveys[0].Varcount)
+	assert.Equal(t, time.Date(2013, 6, 19, 18, 17, 14, 0, time.UTC), surveys[0].Created.Time)
+	assert.Equal(t, time.Date(2014, 7, 14, 16, 13, 46, 0, time.UTC), surveys[0].Changed.Time)
+	assert.Equal(t, ts.URL+"/catalog/1970", surveys[0].Url)
+	assert.JSONEq(t, `{"id":"1970","repositoryid":"central","surveyid":"ALB_2012_LSMS_v01_M","titl":"Living Standards Measurement Survey 2012","nation":"Albania","authenty":"Institute of Statistics (INSTAT)","data_coll_start":"2012","data_coll_end":"2013","varcount":"1254","created":"1371665834","changed":"1405354426","form_model":"public"}`, string(surveys[0].Data))
+	assert.Equal(t, 0, surveys[1].Start)
+	assert.True(t, surveys[1].Created.IsZero())
+
+	meta, err := client.GetSurveyMeta(ctx, "ALB_2012_LSMS_v01_M")
+	assert.NoError(t, err)
+	assert.Equal(t, "Living Standards Measurement Survey 2012", meta.Title())
+	assert.Equal(t, "Albania", meta.Nation())
+	data := meta.Data.(map[string]interface{})
+	assert.Equal(t, "ALB_2012_LSMS_v01_M", data["idno"])
+	assert.Equal(t, "2012", data["year_start"])
+	assert.Equal(t, "2013-06-19T18:17:14Z", data["created"])
+
+	vars, err := client.GetSurveyVars(ctx, "ALB_2012_LSMS_v01_M")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"V1", "2"}, vars.Vids)
+	assert.Equal(t, "F1", vars.List()[1].FileID())
+
+	var streamed []string
+	err = client.EachSurveyVar(ctx, "ALB_2012_LSMS_v01_M", func(v Variable) error {
+		streamed = append(streamed, v.Vid)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, vars.Vids, streamed)
+
+	v, err := client.GetVarMeta(ctx, "ALB_2012_LSMS_v01_M", "V2")
+	assert.NoError(t, err)
+	assert.Equal(t, "sex", v.Name())
+	assert.Equal(t, "Sex of household member", v.Label())
+	assert.Equal(t, "F1", v.FileID())
+	assert.Equal(t, "Is [NAME] male or female?", v.Question())
+	assert.Equal(t, map[string]interface{}{
+		"file_id":          "F1",
+		"vid":              "V2",
+		"name":             "sex",
+		"labl":             "Sex of household member",
+		"var_qstn_qstnlit": "Is [NAME] male or female?",
+	}, v.Data.(map[string]interface{})["metadata"])
+	assert.Empty(t, drifted)
+
+	before := atomic.LoadInt32(hits)
+	_, err = client.GetResources(ctx, "ALB_2012_LSMS_v01_M")
+	assert.EqualError(t, err, "Application side error: the catalog does not support the resources endpoint with statuscode: 1001")
+	_, err = client.GetStudyExport(ctx, "ALB_2012_LSMS_v01_M", ExportDDI)
+	assert.Error(t, err)
+	assert.Equal(t, before, atomic.LoadInt32(hits))
+
+	t.Run("a pinned version is not probed", func(t *testing.T) {
+		ts, hits := newCatalog(t, map[string]string{"/search": nada4SearchResponse})
+		surveys, err := NewClient(ts.URL, WithNADAVersion(NADA4)).Search(ctx, NewDefaultSearchParams())
+		assert.NoError(t, err)
+		assert.Equal(t, "ALB_2012_LSMS_v01_M", surveys[0].Idno)
+		assert.Equal(t, "", surveys[0].Url)
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+	})
+
+	t.Run("5.x responses are unchanged", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{"/search": expectedSearchResponse})
+		detected, err := NewClient(ts.URL, WithVersionDetection()).Search(ctx, NewDefaultSearchParams())
+		assert.NoError(t, err)
+		plain, err := NewClient(ts.URL).Search(ctx, NewDefaultSearchParams())
+		assert.NoError(t, err)
+		assert.Equal(t, plain, detected)
+	})
+
+	t.Run("concurrent calls share one probe", func(t *testing.T) {
+		ts, hits := newCatalog(t, map[string]string{"/search": nada4SearchResponse})
+		client := NewClient(ts.URL, WithVersionDetection())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				surveys, err := client.Search(ctx, NewDefaultSearchParams())
+				assert.NoError(t, err)
+				assert.Equal(t, "ALB_2012_LSMS_v01_M", surveys[0].Idno)
+			}()
+		}
+		wg.Wait()
+		// one search and four endpoints probed, then the five searches
+		assert.Equal(t, int32(10), atomic.LoadInt32(hits))
+	})
+
+	t.Run("probe failures are returned", func(t *testing.T) {
+		ts, hits := newCatalog(t, nil)
+		client := NewClient(ts.URL, WithVersionDetection())
+		_, err := client.GetSurveyMeta(ctx, "X")
+		assert.Equal(t, FetchErr{Message: "non-200 status code from the API", StatusCode: 404}, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(hits))
+
+		// detection is tried again by the next call
+		_, err = client.GetSurveyMeta(ctx, "X")
+		assert.Error(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(hits))
+	})
+}
+
+var nada4SearchResponse = `{"result":{"found":2,"total":2,"limit":15,"offset":0,"rows":[{"id":"1970","repositoryid":"central","surveyid":"ALB_2012_LSMS_v01_M","titl":"Living Standards Measurement Survey 2012","nation":"Albania","authenty":"Institute of Statistics (INSTAT)","data_coll_start":"2012","data_coll_end":"2013","varcount":"1254","created":"1371665834","changed":"1405354426","form_model":"public"},{"id":"2011","repositoryid":"central","surveyid":"ALB_2002_LSMS_v01_M","titl":"Living Standards Measurement Survey 2002","nation":"Albania","authenty":"Institute of Statistics (INSTAT)","data_coll_start":null,"data_coll_end":"","varcount":0,"created":"0","changed":null,"form_model":"licensed"}]}}`
+
+var nada4VariablesResponse = `{"total":2,"variables":[{"uid":"51201","sid":"1970","fid":"F1","vid":"V1","name":"hhid","labl":"Household identifier"},{"uid":51202,"sid":1970,"fid":"F1","vid":2,"name":"sex","labl":"Sex of household member"}]}`
+
+var nada4VariableResponse = `{"variable":{"uid":"51202","sid":"1970","fid":"F1","vid":"V2","name":"sex","labl":"Sex of household member","qstn":"Is [NAME] male or female?","catgry":"Male Female","keywords":null}}`
+
+var nada4SurveymetaResponse = `{"status":"success","dataset":{"id":"1970","repositoryid":"central","surveyid":"ALB_2012_LSMS_v01_M","titl":"Living Standards Measurement Survey 2012","titlstmt":"","authenty":"Institute of Statistics (INSTAT)","geogcover":"National coverage","nation":"Albania","topic":"","scope":"","sername":"Living Standards Measurement Study [hh\/lsms]","producer":"","sponsor":"World Bank","refno":"ALB_2012_LSMS_v01_M","proddate":"2013-06","varcount":"1254","link_technical":"","link_study":"","link_report":"","link_indicator":"","ddi_sh":"","formid":"1","isshared":"1","isdeleted":"0","changed":"1405354426","created":"1371665834","data_coll_start":"2012","data_coll_end":"2013","abbreviation":"LSMS 2012","kindofdata":"Sample survey data [ssd]","keywords":"","ie_program":"","ie_project_id":"","ie_project_name":"","ie_project_uri":"","ie_team_leaders":"","project_id":"","project_name":"","project_uri":"","link_da":"","published":"1","total_views":"4415","total_downloads":"732","stats_last_updated":null}}`
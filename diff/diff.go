@@ -0,0 +1,460 @@
+// Package diff compares snapshots of study and variable metadata taken from a
+// NADA catalog and reports what changed between them.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+)
+
+type Kind string
+
+const (
+	Added   Kind = "added"
+	Removed Kind = "removed"
+	Renamed Kind = "renamed"
+	Changed Kind = "changed"
+)
+
+// Change is a difference at a JSON pointer path within a metadata document
+type Change struct {
+	Kind Kind        `json:"kind"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// FieldChange is a semantic difference within a variable. Key identifies the
+// category value or statistic type for category and statistic changes
+type FieldChange struct {
+	Field string `json:"field"`
+	Key   string `json:"key,omitempty"`
+	Kind  Kind   `json:"kind"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// VariableChange is a difference in one variable, identified by its data file
+// and name
+type VariableChange struct {
+	Kind    Kind          `json:"kind"`
+	Vid     string        `json:"vid"`
+	File    string        `json:"file,omitempty"`
+	Name    string        `json:"name"`
+	OldFile string        `json:"old_file,omitempty"`
+	OldName string        `json:"old_name,omitempty"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+
+	// Raw holds the changes to the variable document that JSONPatch is built
+	// from, so changesets loaded from JSON give the same patch
+	Raw []Change `json:"raw,omitempty"`
+}
+
+// Changeset holds every change between two snapshots of a study
+type Changeset struct {
+	Idno      string           `json:"idno"`
+	Study     []Change         `json:"study,omitempty"`
+	Variables []VariableChange `json:"variables,omitempty"`
+}
+
+// PatchOp is a single RFC 6902 JSON Patch operation
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ignoredStudyFields change on every page view and are skipped when comparing studies
+var ignoredStudyFields = map[string]bool{
+	"/total_views":     true,
+	"/total_downloads": true,
+}
+
+// Compare diffs two snapshots of a study and its variables
+func Compare(oldMeta, newMeta nadago.SurveyMeta, oldVars, newVars []nadago.Variable) Changeset {
+	idno := newMeta.Idno
+	if idno == "" {
+		idno = oldMeta.Idno
+	}
+	return Changeset{
+		Idno:      idno,
+		Study:     Studies(oldMeta, newMeta),
+		Variables: Variables(oldVars, newVars),
+	}
+}
+
+// Studies diffs the metadata documents of two snapshots of a study
+func Studies(oldMeta, newMeta nadago.SurveyMeta) []Change {
+	var changes []Change
+	for _, c := range values("", oldMeta.Data, newMeta.Data) {
+		if !ignoredStudyFields[c.Path] {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// Variables diffs two variable sets. Variables are matched by data file and
+// name, as studies often repeat a name such as a household id in each file.
+// Unmatched variables with the same vid or label are reported as renamed
+func Variables(oldVars, newVars []nadago.Variable) []VariableChange {
+	oldByKey := make(map[string]nadago.Variable, len(oldVars))
+	for _, v := range oldVars {
+		oldByKey[variableKey(v)] = v
+	}
+	newByKey := make(map[string]nadago.Variable, len(newVars))
+	for _, v := range newVars {
+		newByKey[variableKey(v)] = v
+	}
+
+	var changes []VariableChange
+	var removed, added []nadago.Variable
+
+	for _, nv := range newVars {
+		ov, ok := oldByKey[variableKey(nv)]
+		if !ok {
+			added = append(added, nv)
+			continue
+		}
+		if c, changed := variable(ov, nv); changed {
+			changes = append(changes, c)
+		}
+	}
+	for _, ov := range oldVars {
+		if _, ok := newByKey[variableKey(ov)]; !ok {
+			removed = append(removed, ov)
+		}
+	}
+
+	// pair up renames, preferring a shared vid over a shared label
+	renamed := map[int]int{}
+	usedNew := map[int]bool{}
+	for _, sameVid := range []bool{true, false} {
+		for i, ov := range removed {
+			if _, ok := renamed[i]; ok {
+				continue
+			}
+			for j, nv := range added {
+				if usedNew[j] {
+					continue
+				}
+				if (sameVid && ov.Vid != "" && ov.Vid == nv.Vid && sameLabel(ov, nv)) ||
+					(!sameVid && ov.Label() != "" && sameLabel(ov, nv)) {
+					renamed[i] = j
+					usedNew[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	for i, ov := range removed {
+		j, ok := renamed[i]
+		if !ok {
+			changes = append(changes, VariableChange{Kind: Removed, Vid: ov.Vid, File: ov.FileID(), Name: ov.Name(), Raw: []Change{{Kind: Removed, Path: "", Old: ov.Data}}})
+			continue
+		}
+		c, _ := variable(ov, added[j])
+		c.Kind = Renamed
+		c.OldFile = ov.FileID()
+		c.OldName = ov.Name()
+		changes = append(changes, c)
+	}
+	for j, nv := range added {
+		if !usedNew[j] {
+			changes = append(changes, VariableChange{Kind: Added, Vid: nv.Vid, File: nv.FileID(), Name: nv.Name(), Raw: []Change{{Kind: Added, Path: "", New: nv.Data}}})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].File < changes[j].File
+	})
+	return changes
+}
+
+// variableKey identifies a variable within a study by its data file and name
+func variableKey(v nadago.Variable) string {
+	return documentKey(v.FileID(), v.Name())
+}
+
+// documentKey is the key of a variable in the document patched by JSONPatch
+func documentKey(file, name string) string {
+	if file == "" {
+		return name
+	}
+	return file + "/" + name
+}
+
+func sameLabel(a, b nadago.Variable) bool {
+	return strings.EqualFold(strings.TrimSpace(a.Label()), strings.TrimSpace(b.Label()))
+}
+
+func variable(ov, nv nadago.Variable) (VariableChange, bool) {
+	c := VariableChange{Kind: Changed, Vid: nv.Vid, File: nv.FileID(), Name: nv.Name()}
+
+	if ov.Label() != nv.Label() {
+		c.Fields = append(c.Fields, FieldChange{Field: "label", Kind: Changed, Old: ov.Label(), New: nv.Label()})
+	}
+	if ov.Question() != nv.Question() {
+		c.Fields = append(c.Fields, FieldChange{Field: "question", Kind: Changed, Old: ov.Question(), New: nv.Question()})
+	}
+	c.Fields = append(c.Fields, categories(ov.Categories(), nv.Categories())...)
+	c.Fields = append(c.Fields, statistics(ov.SumStats(), nv.SumStats())...)
+	c.Raw = values("", ov.Data, nv.Data)
+
+	return c, len(c.Fields) > 0 || len(c.Raw) > 0
+}
+
+func categories(oldCats, newCats []nadago.Category) []FieldChange {
+	oldByValue := make(map[string]nadago.Category, len(oldCats))
+	for _, c := range oldCats {
+		oldByValue[c.Value] = c
+	}
+	newByValue := make(map[string]bool, len(newCats))
+
+	var changes []FieldChange
+	for _, nc := range newCats {
+		newByValue[nc.Value] = true
+		oc, ok := oldByValue[nc.Value]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: "category", Key: nc.Value, Kind: Added, New: nc.Label})
+		case oc.Label != nc.Label:
+			changes = append(changes, FieldChange{Field: "category", Key: nc.Value, Kind: Changed, Old: oc.Label, New: nc.Label})
+		default:
+			of, _ := oc.Frequency()
+			nf, _ := nc.Frequency()
+			if of != nf {
+				changes = append(changes, FieldChange{Field: "frequency", Key: nc.Value, Kind: Changed, Old: fmt.Sprint(of), New: fmt.Sprint(nf)})
+			}
+		}
+	}
+	for _, oc := range oldCats {
+		if !newByValue[oc.Value] {
+			changes = append(changes, FieldChange{Field: "category", Key: oc.Value, Kind: Removed, Old: oc.Label})
+		}
+	}
+	return changes
+}
+
+func statistics(oldStats, newStats []nadago.SumStat) []FieldChange {
+	key := func(s nadago.SumStat) string {
+		if s.Weighted {
+			return s.Type + " (weighted)"
+		}
+		return s.Type
+	}
+	oldByType := make(map[string]string, len(oldStats))
+	for _, s := range oldStats {
+		oldByType[key(s)] = s.Value
+	}
+	newByType := make(map[string]bool, len(newStats))
+
+	var changes []FieldChange
+	for _, s := range newStats {
+		k := key(s)
+		newByType[k] = true
+		old, ok := oldByType[k]
+		switch {
+		case !ok:
+			changes = append(changes, FieldChange{Field: "statistic", Key: k, Kind: Added, New: s.Value})
+		case old != s.Value:
+			changes = append(changes, FieldChange{Field: "statistic", Key: k, Kind: Changed, Old: old, New: s.Value})
+		}
+	}
+	for _, s := range oldStats {
+		if k := key(s); !newByType[k] {
+			changes = append(changes, FieldChange{Field: "statistic", Key: k, Kind: Removed, Old: s.Value})
+		}
+	}
+	return changes
+}
+
+// values deep compares two decoded JSON values. Arrays of differing length are
+// reported as a single change so the resulting patch never depends on index shifts
+func values(path string, a, b interface{}) []Change {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var changes []Change
+		for _, k := range keys {
+			p := path + "/" + escapePointer(k)
+			av, ainok := am[k]
+			bv, binok := bm[k]
+			switch {
+			case !ainok:
+				changes = append(changes, Change{Kind: Added, Path: p, New: bv})
+			case !binok:
+				changes = append(changes, Change{Kind: Removed, Path: p, Old: av})
+			default:
+				changes = append(changes, values(p, av, bv)...)
+			}
+		}
+		return changes
+	}
+
+	as, aok := a.([]interface{})
+	bs, bok := b.([]interface{})
+	if aok && bok && len(as) == len(bs) {
+		var changes []Change
+		for i := range as {
+			changes = append(changes, values(fmt.Sprintf("%s/%d", path, i), as[i], bs[i])...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []Change{{Kind: Changed, Path: path, Old: a, New: b}}
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func (c Changeset) Empty() bool {
+	return len(c.Study) == 0 && len(c.Variables) == 0
+}
+
+// JSONPatch expresses the changeset as a patch over a document of the form
+// {"study": <dataset>, "variables": {"<fid>/<name>": <variable>}}, where
+// variables without a data file are keyed by name alone
+func (c Changeset) JSONPatch() []PatchOp {
+	ops := make([]PatchOp, 0, len(c.Study))
+	for _, s := range c.Study {
+		ops = append(ops, patchOp("/study", s))
+	}
+	for _, v := range c.Variables {
+		base := "/variables/" + escapePointer(documentKey(v.File, v.Name))
+		if v.Kind == Renamed {
+			ops = append(ops, PatchOp{Op: "move", From: "/variables/" + escapePointer(documentKey(v.OldFile, v.OldName)), Path: base})
+		}
+		for _, r := range v.Raw {
+			ops = append(ops, patchOp(base, r))
+		}
+	}
+	return ops
+}
+
+// MarshalJSON always writes the value of add, replace and test operations,
+// which RFC 6902 requires even when the value is null
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type plain PatchOp
+	switch op.Op {
+	case "add", "replace", "test":
+		return json.Marshal(struct {
+			plain
+			Value interface{} `json:"value"`
+		}{plain(op), op.Value})
+	}
+	return json.Marshal(plain(op))
+}
+
+func patchOp(base string, c Change) PatchOp {
+	switch c.Kind {
+	case Added:
+		return PatchOp{Op: "add", Path: base + c.Path, Value: c.New}
+	case Removed:
+		return PatchOp{Op: "remove", Path: base + c.Path}
+	default:
+		return PatchOp{Op: "replace", Path: base + c.Path, Value: c.New}
+	}
+}
+
+// WriteJSONPatch writes the changeset as an RFC 6902 JSON Patch document
+func (c Changeset) WriteJSONPatch(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.JSONPatch())
+}
+
+// Text renders the changeset for people reading it in a terminal or report
+func (c Changeset) Text() string {
+	var b strings.Builder
+
+	if c.Empty() {
+		fmt.Fprintf(&b, "%s: no changes\n", c.Idno)
+		return b.String()
+	}
+
+	if len(c.Study) > 0 {
+		fmt.Fprintf(&b, "Study %s\n", c.Idno)
+		for _, s := range c.Study {
+			switch s.Kind {
+			case Added:
+				fmt.Fprintf(&b, "  + %s: %s\n", s.Path, brief(s.New))
+			case Removed:
+				fmt.Fprintf(&b, "  - %s: %s\n", s.Path, brief(s.Old))
+			default:
+				fmt.Fprintf(&b, "  ~ %s: %s -> %s\n", s.Path, brief(s.Old), brief(s.New))
+			}
+		}
+	}
+
+	if len(c.Variables) > 0 {
+		fmt.Fprintf(&b, "Variables\n")
+		for _, v := range c.Variables {
+			switch v.Kind {
+			case Added:
+				fmt.Fprintf(&b, "  + %s (%s)\n", v.Name, v.Vid)
+			case Removed:
+				fmt.Fprintf(&b, "  - %s (%s)\n", v.Name, v.Vid)
+			case Renamed:
+				fmt.Fprintf(&b, "  > %s -> %s (%s)\n", v.OldName, v.Name, v.Vid)
+			default:
+				fmt.Fprintf(&b, "  ~ %s (%s)\n", v.Name, v.Vid)
+			}
+			for _, f := range v.Fields {
+				field := f.Field
+				if f.Key != "" {
+					field += " " + f.Key
+				}
+				switch f.Kind {
+				case Added:
+					fmt.Fprintf(&b, "      + %s: %q\n", field, f.New)
+				case Removed:
+					fmt.Fprintf(&b, "      - %s: %q\n", field, f.Old)
+				default:
+					fmt.Fprintf(&b, "      ~ %s: %q -> %q\n", field, f.Old, f.New)
+				}
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func brief(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	s := string(b)
+	// cut by runes so labels in other scripts are not split mid character
+	if r := []rune(s); len(r) > 80 {
+		s = string(r[:77]) + "..."
+	}
+	return s
+}
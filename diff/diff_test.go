@@ -0,0 +1,202 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/fixture"
+	"github.com/stretchr/testify/assert"
+)
+
+func testVariable(vid, name, label string, cats ...map[string]interface{}) nadago.Variable {
+	return fixture.Variable("KEN_2021_HFS_v01_M", vid, name, label, fixture.Stat("vald", "100"), fixture.Categories(cats...))
+}
+
+func TestStudies(t *testing.T) {
+	oldMeta := nadago.SurveyMeta{Idno: "KEN_2021_HFS_v01_M", Data: map[string]interface{}{
+		"title":       "High Frequency Survey",
+		"total_views": 10,
+		"metadata": map[string]interface{}{
+			"study_desc": map[string]interface{}{"abstract": "old", "a/b": 1},
+			"keywords":   []interface{}{"covid"},
+		},
+	}}
+	newMeta := nadago.SurveyMeta{Idno: "KEN_2021_HFS_v01_M", Data: map[string]interface{}{
+		"title":       "High Frequency Survey, Round 2",
+		"total_views": 99,
+		"nation":      "Kenya",
+		"metadata": map[string]interface{}{
+			"study_desc": map[string]interface{}{"abstract": "new"},
+			"keywords":   []interface{}{"covid", "phone"},
+		},
+	}}
+
+	changes := Studies(oldMeta, newMeta)
+	assert.Equal(t, []Change{
+		{Kind: Changed, Path: "/metadata/keywords", Old: []interface{}{"covid"}, New: []interface{}{"covid", "phone"}},
+		{Kind: Removed, Path: "/metadata/study_desc/a~1b", Old: 1},
+		{Kind: Changed, Path: "/metadata/study_desc/abstract", Old: "old", New: "new"},
+		{Kind: Added, Path: "/nation", New: "Kenya"},
+		{Kind: Changed, Path: "/title", Old: "High Frequency Survey", New: "High Frequency Survey, Round 2"},
+	}, changes)
+
+	assert.Empty(t, Studies(oldMeta, oldMeta))
+}
+
+func TestVariables(t *testing.T) {
+	oldVars := []nadago.Variable{
+		testVariable("V1", "hhid", "Household identifier"),
+		testVariable("V2", "sex", "Sex", fixture.Category("1", "M", "50"), fixture.Category("2", "F", "50")),
+		testVariable("V3", "hh_size", "Household size"),
+		testVariable("V4", "pilot", "Pilot flag"),
+	}
+	newVars := []nadago.Variable{
+		testVariable("V1", "hhid", "Household identifier"),
+		testVariable("V2", "sex", "Sex of respondent", fixture.Category("1", "Male", "50"), fixture.Category("2", "F", "48"), fixture.Category("3", "Other", "2")),
+		testVariable("V3", "hhsize", "Household size"),
+		testVariable("V4", "income", "Household income"),
+	}
+
+	changes := Variables(oldVars, newVars)
+	assert.Len(t, changes, 4)
+
+	assert.Equal(t, Renamed, changes[0].Kind)
+	assert.Equal(t, "hhsize", changes[0].Name)
+	assert.Equal(t, "hh_size", changes[0].OldName)
+
+	assert.Equal(t, Added, changes[1].Kind)
+	assert.Equal(t, "income", changes[1].Name)
+
+	assert.Equal(t, Removed, changes[2].Kind)
+	assert.Equal(t, "pilot", changes[2].Name)
+
+	assert.Equal(t, Changed, changes[3].Kind)
+	assert.Equal(t, "sex", changes[3].Name)
+	assert.Equal(t, []FieldChange{
+		{Field: "label", Kind: Changed, Old: "Sex", New: "Sex of respondent"},
+		{Field: "category", Key: "1", Kind: Changed, Old: "M", New: "Male"},
+		{Field: "frequency", Key: "2", Kind: Changed, Old: "50", New: "48"},
+		{Field: "category", Key: "3", Kind: Added, New: "Other"},
+	}, changes[3].Fields)
+
+	t.Run("statistics and questions", func(t *testing.T) {
+		ov := testVariable("V1", "age", "Age")
+		nv := testVariable("V1", "age", "Age")
+		nv.Data.(map[string]interface{})["metadata"] = map[string]interface{}{
+			"var_qstn_qstnlit": "How old are you?",
+			"var_sumstat":      []interface{}{map[string]interface{}{"type": "vald", "value": "120", "wgtd": nil}},
+		}
+
+		changes := Variables([]nadago.Variable{ov}, []nadago.Variable{nv})
+		assert.Len(t, changes, 1)
+		assert.Equal(t, []FieldChange{
+			{Field: "question", Kind: Changed, Old: "", New: "How old are you?"},
+			{Field: "statistic", Key: "vald", Kind: Changed, Old: "100", New: "120"},
+		}, changes[0].Fields)
+	})
+
+	t.Run("variable list rows", func(t *testing.T) {
+		oldList := nadago.Variables{Idno: "X", Variables: []map[string]interface{}{{"vid": "V1", "name": "a", "labl": "A"}}}
+		newList := nadago.Variables{Idno: "X", Variables: []map[string]interface{}{{"vid": "V1", "name": "a", "labl": "A"}}}
+		assert.Empty(t, Variables(oldList.List(), newList.List()))
+	})
+
+	t.Run("duplicate names across data files", func(t *testing.T) {
+		hhid := func(vid, fid, label string) nadago.Variable {
+			return fixture.Variable("KEN_2021_HFS_v01_M", vid, "hhid", label, fixture.File(fid))
+		}
+		oldVars := []nadago.Variable{hhid("V1", "F1", "Household id"), hhid("V9", "F2", "Household id")}
+		assert.Empty(t, Variables(oldVars, oldVars))
+
+		newVars := []nadago.Variable{hhid("V1", "F1", "Household id"), hhid("V9", "F2", "Household identifier")}
+		changes := Variables(oldVars, newVars)
+		assert.Len(t, changes, 1)
+		assert.Equal(t, "F2", changes[0].File)
+		assert.Equal(t, "V9", changes[0].Vid)
+
+		patch := Changeset{Variables: changes}.JSONPatch()
+		assert.Equal(t, PatchOp{Op: "replace", Path: "/variables/F2~1hhid/labl", Value: "Household identifier"}, patch[0])
+	})
+}
+
+func TestChangesetOutput(t *testing.T) {
+	oldMeta := nadago.SurveyMeta{Idno: "KEN_2021_HFS_v01_M", Data: map[string]interface{}{"title": "HFS"}}
+	newMeta := nadago.SurveyMeta{Idno: "KEN_2021_HFS_v01_M", Data: map[string]interface{}{"title": "HFS Round 2"}}
+	oldVars := []nadago.Variable{testVariable("V1", "hh_size", "Household size"), testVariable("V2", "pilot", "Pilot")}
+	newVars := []nadago.Variable{testVariable("V1", "hhsize", "Household size"), testVariable("V2", "sex", "Sex")}
+
+	cs := Compare(oldMeta, newMeta, oldVars, newVars)
+	assert.False(t, cs.Empty())
+
+	t.Run("text", func(t *testing.T) {
+		assert.Equal(t, `Study KEN_2021_HFS_v01_M
+  ~ /title: "HFS" -> "HFS Round 2"
+Variables
+  > hh_size -> hhsize (V1)
+  - pilot (V2)
+  + sex (V2)
+`, cs.Text())
+
+		assert.Equal(t, "KEN_2021_HFS_v01_M: no changes\n", Compare(oldMeta, oldMeta, oldVars, oldVars).Text())
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		ops := cs.JSONPatch()
+		assert.Equal(t, PatchOp{Op: "replace", Path: "/study/title", Value: "HFS Round 2"}, ops[0])
+		assert.Equal(t, PatchOp{Op: "move", From: "/variables/hh_size", Path: "/variables/hhsize"}, ops[1])
+		assert.Equal(t, PatchOp{Op: "replace", Path: "/variables/hhsize/name", Value: "hhsize"}, ops[2])
+		assert.Equal(t, PatchOp{Op: "remove", Path: "/variables/pilot"}, ops[3])
+		assert.Equal(t, "add", ops[4].Op)
+		assert.Equal(t, "/variables/sex", ops[4].Path)
+
+		var buf bytes.Buffer
+		assert.NoError(t, cs.WriteJSONPatch(&buf))
+		var decoded []map[string]interface{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Len(t, decoded, 5)
+	})
+
+	t.Run("json patch from a saved changeset", func(t *testing.T) {
+		b, err := json.Marshal(cs)
+		assert.NoError(t, err)
+		var loaded Changeset
+		assert.NoError(t, json.Unmarshal(b, &loaded))
+		assert.Equal(t, len(cs.JSONPatch()), len(loaded.JSONPatch()))
+		assert.Equal(t, cs.JSONPatch()[2], loaded.JSONPatch()[2])
+	})
+
+	t.Run("json patch null values", func(t *testing.T) {
+		b, err := json.Marshal([]PatchOp{
+			{Op: "replace", Path: "/study/abstract"},
+			{Op: "add", Path: "/study/notes", Value: nil},
+			{Op: "remove", Path: "/study/title"},
+			{Op: "move", From: "/variables/a", Path: "/variables/b"},
+		})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"op":"replace","path":"/study/abstract","value":null},
+			{"op":"add","path":"/study/notes","value":null},
+			{"op":"remove","path":"/study/title"},
+			{"op":"move","path":"/variables/b","from":"/variables/a"}
+		]`, string(b))
+	})
+
+	t.Run("text cuts long values by rune", func(t *testing.T) {
+		long := strings.Repeat("Обследование ", 10)
+		s := brief(long)
+		assert.True(t, utf8.ValidString(s))
+		assert.Equal(t, 80, utf8.RuneCountInString(s))
+		assert.True(t, strings.HasSuffix(s, "..."))
+	})
+
+	t.Run("structured json", func(t *testing.T) {
+		b, err := json.Marshal(cs)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), `"kind":"renamed"`)
+		assert.Contains(t, string(b), `"old_name":"hh_size"`)
+	})
+}
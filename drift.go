@@ -0,0 +1,450 @@
+package nadago
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DriftKind classifies a difference between a response and the fields the
+// client expects
+type DriftKind string
+
+const (
+	// DriftUnknownField is a field the client does not know
+	DriftUnknownField DriftKind = "unknown_field"
+	// DriftMissingField is an expected field that is absent
+	DriftMissingField DriftKind = "missing_field"
+	// DriftCoerced is a value converted to the expected type, such as a number
+	// sent as a string or a null read as a zero value
+	DriftCoerced DriftKind = "coerced"
+	// DriftTypeMismatch is a value that cannot be read as the expected type
+	DriftTypeMismatch DriftKind = "type_mismatch"
+)
+
+// DriftIssue is one kind of difference found for a field. Field is a dotted
+// path within a search row, study dataset or variable, and Count is how many
+// times the issue was found in the response
+type DriftIssue struct {
+	Kind     DriftKind
+	Field    string
+	Expected string
+	Found    string
+	Count    int
+}
+
+// DriftReport lists the differences found in one response
+type DriftReport struct {
+	Endpoint string
+	Idno     string
+	Version  NADAVersion
+	Issues   []DriftIssue
+}
+
+// WithDriftHook checks search rows, study metadata, variable lists and
+// variables against the fields the client expects, and calls fn with a report
+// for each response that differs. Responses that fail to decode are reported
+// too, so a changed field type can be told apart from other failures. Checking
+// decodes every response into maps, so it costs allocations
+func WithDriftHook(fn func(DriftReport)) Option {
+	return func(c *Client) {
+		c.driftHook = fn
+	}
+}
+
+type fieldKind int
+
+const (
+	kindAny fieldKind = iota
+	kindString
+	// kindText is read with stringOf, which also accepts numbers and booleans
+	kindText
+	kindInt
+	kindTime
+	kindUnix
+	kindObject
+	kindArray
+)
+
+func (k fieldKind) String() string {
+	switch k {
+	case kindString, kindText:
+		return "string"
+	case kindInt:
+		return "integer"
+	case kindTime:
+		return "RFC 3339 time"
+	case kindUnix:
+		return "Unix time"
+	case kindObject:
+		return "object"
+	case kindArray:
+		return "array"
+	}
+	return "any"
+}
+
+type fieldSpec struct {
+	kind     fieldKind
+	required bool
+	fields   *schema
+}
+
+// schema describes the fields of an object. Open schemas do not report
+// unknown fields
+type schema struct {
+	fields map[string]fieldSpec
+	open   bool
+}
+
+func requiredField(k fieldKind) fieldSpec {
+	return fieldSpec{kind: k, required: true}
+}
+
+// objectField is an object whose listed fields are checked, ignoring others
+func objectField(fields map[string]fieldSpec) fieldSpec {
+	return fieldSpec{kind: kindObject, fields: &schema{fields: fields, open: true}}
+}
+
+var searchSchema = schema{fields: map[string]fieldSpec{
+	"idno":             requiredField(kindString),
+	"title":            requiredField(kindString),
+	"nation":           {kind: kindString},
+	"year_start":       {kind: kindInt},
+	"year_end":         {kind: kindInt},
+	"created":          {kind: kindTime},
+	"changed":          {kind: kindTime},
+	"url":              {kind: kindString},
+	"varcount":         {kind: kindInt},
+	"id":               {},
+	"type":             {},
+	"formid":           {},
+	"form_model":       {},
+	"repositoryid":     {},
+	"authoring_entity": {},
+	"total_views":      {},
+	"total_downloads":  {},
+	"rank":             {},
+	"link_da":          {},
+	"subtitle":         {},
+	"thumbnail":        {},
+}}
+
+var search4Schema = schema{fields: map[string]fieldSpec{
+	"surveyid":        requiredField(kindString),
+	"titl":            requiredField(kindString),
+	"nation":          {kind: kindString},
+	"data_coll_start": {kind: kindInt},
+	"data_coll_end":   {kind: kindInt},
+	"created":         {kind: kindUnix},
+	"changed":         {kind: kindUnix},
+	"varcount":        {kind: kindInt},
+	"id":              {kind: kindInt},
+	"repositoryid":    {},
+	"authenty":        {},
+	"form_model":      {},
+}}
+
+var studySchema = schema{fields: map[string]fieldSpec{
+	"idno":       requiredField(kindText),
+	"title":      requiredField(kindText),
+	"nation":     {kind: kindText},
+	"year_start": {kind: kindInt},
+	"year_end":   {kind: kindInt},
+	"created":    {kind: kindTime},
+	"changed":    {kind: kindTime},
+	"varcount":   {kind: kindInt},
+	"data_files": {kind: kindArray},
+	"metadata": objectField(map[string]fieldSpec{
+		"study_desc": objectField(map[string]fieldSpec{
+			"study_info": objectField(map[string]fieldSpec{"abstract": {kind: kindText}}),
+			"method": objectField(map[string]fieldSpec{
+				"data_collection": objectField(map[string]fieldSpec{"sampling_procedure": {kind: kindText}}),
+			}),
+		}),
+		"data_files": {kind: kindArray},
+	}),
+	"id":               {},
+	"repositoryid":     {},
+	"type":             {},
+	"authoring_entity": {},
+	"published":        {},
+	"total_views":      {},
+	"total_downloads":  {},
+	"formid":           {},
+	"data_access_type": {},
+	"remote_data_url":  {},
+	"data_class_id":    {},
+	"data_class_code":  {},
+	"data_class_title": {},
+	"thumbnail":        {},
+	"link_study":       {},
+	"link_indicator":   {},
+	"link_report":      {},
+	"link_technical":   {},
+	"link_da":          {},
+}}
+
+// study4Schema is open, as 4.x study metadata has a column for each DDI
+// element the catalog indexes
+var study4Schema = schema{open: true, fields: map[string]fieldSpec{
+	"surveyid":        requiredField(kindText),
+	"titl":            requiredField(kindText),
+	"nation":          {kind: kindText},
+	"data_coll_start": {kind: kindInt},
+	"data_coll_end":   {kind: kindInt},
+	"created":         {kind: kindUnix},
+	"changed":         {kind: kindUnix},
+	"varcount":        {kind: kindInt},
+}}
+
+var variableRowSchema = schema{fields: map[string]fieldSpec{
+	"vid":    requiredField(kindString),
+	"name":   requiredField(kindText),
+	"labl":   {kind: kindText},
+	"fid":    {kind: kindText},
+	"uid":    {},
+	"sid":    {},
+	"qstn":   {},
+	"catgry": {},
+}}
+
+// variableRow4Schema and variable4Schema describe 4.x variables, whose ids may
+// be numbers and whose metadata is kept in flat fields
+var variableRow4Schema = schema{fields: map[string]fieldSpec{
+	"vid":      requiredField(kindText),
+	"name":     requiredField(kindText),
+	"labl":     {kind: kindText},
+	"fid":      {kind: kindText},
+	"uid":      {},
+	"sid":      {},
+	"qstn":     {},
+	"catgry":   {},
+	"keywords": {},
+}}
+
+var variable4Schema = variableRow4Schema
+
+var variableSchema = schema{fields: map[string]fieldSpec{
+	"vid":  {kind: kindText},
+	"name": requiredField(kindText),
+	"labl": {kind: kindText},
+	"fid":  {kind: kindText},
+	"metadata": objectField(map[string]fieldSpec{
+		"file_id":          {kind: kindText},
+		"var_qstn_qstnlit": {kind: kindText},
+		"var_catgry":       {kind: kindArray},
+		"var_sumstat":      {kind: kindArray},
+	}),
+	"uid":      {},
+	"sid":      {},
+	"qstn":     {},
+	"catgry":   {},
+	"keywords": {},
+}}
+
+type driftKey struct {
+	kind  DriftKind
+	field string
+	found string
+}
+
+// driftCheck collects the issues of one response. A nil check does nothing,
+// so calls need no guard when the client has no drift hook
+type driftCheck struct {
+	report DriftReport
+	index  map[driftKey]int
+}
+
+func (c *Client) driftCheck(endpoint, idno string, v NADAVersion) *driftCheck {
+	if c.driftHook == nil {
+		return nil
+	}
+	return &driftCheck{
+		report: DriftReport{Endpoint: endpoint, Idno: idno, Version: v},
+		index:  map[driftKey]int{},
+	}
+}
+
+// reportDrift calls the drift hook if the check found any issues
+func (c *Client) reportDrift(d *driftCheck) {
+	if d == nil || len(d.report.Issues) == 0 {
+		return
+	}
+	sort.SliceStable(d.report.Issues, func(i, j int) bool {
+		return d.report.Issues[i].Field < d.report.Issues[j].Field
+	})
+	c.driftHook(d.report)
+}
+
+// decode decodes the JSON body into v, first passing it to check when there
+// is a drift hook. The check runs even if v cannot hold the response
+func (d *driftCheck) decode(r io.Reader, v interface{}, check func(raw json.RawMessage)) error {
+	if d == nil {
+		return json.NewDecoder(r).Decode(v)
+	}
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return err
+	}
+	check(raw)
+	return json.Unmarshal(raw, v)
+}
+
+// checkMember checks the object held by key in a JSON response, or each
+// object in the array held by key when list is set
+func (d *driftCheck) checkMember(raw json.RawMessage, key string, s schema, list bool) {
+	var top map[string]interface{}
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return
+	}
+	v, ok := top[key]
+	switch {
+	case !ok && list:
+		d.add(DriftMissingField, key, kindArray.String(), "")
+	case !ok:
+		d.add(DriftMissingField, key, kindObject.String(), "")
+	case !list:
+		if _, ok := v.(map[string]interface{}); !ok {
+			d.add(DriftTypeMismatch, key, kindObject.String(), jsonType(v))
+			return
+		}
+		d.check("", v, s)
+	default:
+		rows, ok := v.([]interface{})
+		if !ok {
+			d.add(DriftTypeMismatch, key, kindArray.String(), jsonType(v))
+			return
+		}
+		for _, row := range rows {
+			d.check("", row, s)
+		}
+	}
+}
+
+// checkRaw checks a JSON object against s
+func (d *driftCheck) checkRaw(raw json.RawMessage, s schema) {
+	if d == nil {
+		return
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return
+	}
+	d.check("", v, s)
+}
+
+// check checks a decoded JSON object against s, naming fields after prefix
+func (d *driftCheck) check(prefix string, v interface{}, s schema) {
+	if d == nil {
+		return
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		d.add(DriftTypeMismatch, strings.TrimSuffix(prefix, "."), kindObject.String(), jsonType(v))
+		return
+	}
+
+	for name, value := range m {
+		spec, known := s.fields[name]
+		if !known {
+			if !s.open {
+				d.add(DriftUnknownField, prefix+name, "", jsonType(value))
+			}
+			continue
+		}
+		d.checkValue(prefix+name, value, spec)
+	}
+	for name, spec := range s.fields {
+		if _, ok := m[name]; !ok && spec.required {
+			d.add(DriftMissingField, prefix+name, spec.kind.String(), "")
+		}
+	}
+}
+
+func (d *driftCheck) checkValue(field string, v interface{}, spec fieldSpec) {
+	if spec.kind == kindAny {
+		return
+	}
+	if v == nil {
+		d.add(DriftCoerced, field, spec.kind.String(), "null")
+		return
+	}
+
+	kind := DriftTypeMismatch
+	switch v := v.(type) {
+	case string:
+		switch spec.kind {
+		case kindString, kindText:
+			return
+		case kindTime:
+			if _, err := time.Parse(time.RFC3339, v); err == nil {
+				return
+			}
+			if _, err := ParseCatalogTime(v); err == nil {
+				kind = DriftCoerced
+			}
+		case kindInt, kindUnix:
+			if _, err := strconv.Atoi(v); err == nil || v == "" {
+				kind = DriftCoerced
+			}
+		}
+	case float64:
+		switch spec.kind {
+		case kindInt, kindUnix:
+			if v == float64(int64(v)) {
+				return
+			}
+			kind = DriftCoerced
+		case kindText, kindTime:
+			kind = DriftCoerced
+		}
+	case bool:
+		if spec.kind == kindText {
+			kind = DriftCoerced
+		}
+	case map[string]interface{}:
+		if spec.kind == kindObject {
+			if spec.fields != nil {
+				d.check(field+".", v, *spec.fields)
+			}
+			return
+		}
+	case []interface{}:
+		if spec.kind == kindArray {
+			return
+		}
+	}
+	d.add(kind, field, spec.kind.String(), jsonType(v))
+}
+
+func (d *driftCheck) add(kind DriftKind, field, expected, found string) {
+	key := driftKey{kind: kind, field: field, found: found}
+	if i, ok := d.index[key]; ok {
+		d.report.Issues[i].Count++
+		return
+	}
+	d.index[key] = len(d.report.Issues)
+	d.report.Issues = append(d.report.Issues, DriftIssue{Kind: kind, Field: field, Expected: expected, Found: found, Count: 1})
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "unknown"
+}
@@ -0,0 +1,130 @@
+package nadago
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type driftRecorder struct {
+	mu      sync.Mutex
+	reports []DriftReport
+}
+
+func (r *driftRecorder) hook(report DriftReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+}
+
+func TestDriftHook(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fixtures match", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search":          expectedSearchResponse,
+			"/X":               expectedSurveymetaResponse,
+			"/X/variables":     expectedVariablesResponse,
+			"/X/variables/V1":  expectedVarMetaResponse,
+			"/X/variables/V22": expectedCategoricalVarMetaResponse,
+		})
+		rec := &driftRecorder{}
+		client := NewClient(ts.URL, WithDriftHook(rec.hook))
+
+		_, err := client.Search(ctx, NewDefaultSearchParams())
+		assert.NoError(t, err)
+		_, err = client.GetSurveyMeta(ctx, "X")
+		assert.NoError(t, err)
+		_, err = client.GetSurveyVars(ctx, "X")
+		assert.NoError(t, err)
+		_, err = client.GetVarMeta(ctx, "X", "V1")
+		assert.NoError(t, err)
+		_, err = client.GetVarMeta(ctx, "X", "V22")
+		assert.NoError(t, err)
+		// the fixtures only differ from the expected types in ways that are coerced
+		assert.Equal(t, []DriftReport{
+			{Endpoint: "search", Issues: []DriftIssue{
+				{Kind: DriftCoerced, Field: "varcount", Expected: "integer", Found: "string", Count: 1},
+				{Kind: DriftCoerced, Field: "year_start", Expected: "integer", Found: "string", Count: 1},
+			}},
+			{Endpoint: "study", Idno: "X", Issues: []DriftIssue{
+				{Kind: DriftCoerced, Field: "varcount", Expected: "integer", Found: "string", Count: 1},
+				{Kind: DriftCoerced, Field: "year_end", Expected: "integer", Found: "string", Count: 1},
+				{Kind: DriftCoerced, Field: "year_start", Expected: "integer", Found: "string", Count: 1},
+			}},
+			{Endpoint: "variable", Idno: "X", Issues: []DriftIssue{
+				{Kind: DriftCoerced, Field: "metadata.var_qstn_qstnlit", Expected: "string", Found: "null", Count: 1},
+			}},
+		}, rec.reports)
+	})
+
+	t.Run("drifted responses", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search":         `{"result":{"rows":[{"idno":"A","title":"A","year_start":"2020","doi":"10.1/a"},{"idno":"B","title":"B","year_start":"2021","doi":null},{"title":"C","created":"2021-01-01 10:00:00"},{"idno":"D","title":4}]}}`,
+			"/X":              `{"status":"success","study":{"idno":"X"}}`,
+			"/X/variables":    `{"variables":{"V1":{"vid":"V1","name":"age"}}}`,
+			"/Y/variables":    `{"variables":[{"vid":"V1","name":"age","labl":7,"format":"numeric"},{"vid":2,"name":"sex"}]}`,
+			"/Y/variables/V1": `{"variable":{"vid":"V1","name":"age","metadata":{"var_catgry":{"1":"Male"}}}}`,
+		})
+		rec := &driftRecorder{}
+		client := NewClient(ts.URL, WithDriftHook(rec.hook))
+
+		_, err := client.Search(ctx, NewDefaultSearchParams())
+		assert.IsType(t, AppErr{}, err)
+		_, err = client.GetSurveyMeta(ctx, "X")
+		assert.NoError(t, err)
+		_, err = client.GetSurveyVars(ctx, "X")
+		assert.IsType(t, AppErr{}, err)
+		_, err = client.GetSurveyVars(ctx, "Y")
+		assert.IsType(t, AppErr{}, err)
+		_, err = client.GetVarMeta(ctx, "Y", "V1")
+		assert.NoError(t, err)
+
+		assert.Len(t, rec.reports, 5)
+		assert.Equal(t, DriftReport{Endpoint: "search", Issues: []DriftIssue{
+			{Kind: DriftCoerced, Field: "created", Expected: "RFC 3339 time", Found: "string", Count: 1},
+			{Kind: DriftUnknownField, Field: "doi", Found: "string", Count: 1},
+			{Kind: DriftUnknownField, Field: "doi", Found: "null", Count: 1},
+			{Kind: DriftMissingField, Field: "idno", Expected: "string", Count: 1},
+			{Kind: DriftTypeMismatch, Field: "title", Expected: "string", Found: "number", Count: 1},
+			{Kind: DriftCoerced, Field: "year_start", Expected: "integer", Found: "string", Count: 2},
+		}}, rec.reports[0])
+		assert.Equal(t, []DriftIssue{{Kind: DriftMissingField, Field: "dataset", Expected: "object", Count: 1}}, rec.reports[1].Issues)
+		assert.Equal(t, []DriftIssue{{Kind: DriftTypeMismatch, Field: "variables", Expected: "array", Found: "object", Count: 1}}, rec.reports[2].Issues)
+		assert.Equal(t, DriftReport{Endpoint: "variables", Idno: "Y", Issues: []DriftIssue{
+			{Kind: DriftUnknownField, Field: "format", Found: "string", Count: 1},
+			{Kind: DriftCoerced, Field: "labl", Expected: "string", Found: "number", Count: 1},
+			{Kind: DriftTypeMismatch, Field: "vid", Expected: "string", Found: "number", Count: 1},
+		}}, rec.reports[3])
+		assert.Equal(t, []DriftIssue{
+			{Kind: DriftTypeMismatch, Field: "metadata.var_catgry", Expected: "array", Found: "object", Count: 1},
+		}, rec.reports[4].Issues)
+	})
+
+	t.Run("streamed variables and 4.x", func(t *testing.T) {
+		ts, _ := newCatalog(t, map[string]string{
+			"/search":      nada4SearchResponse,
+			"/X/variables": `{"variables":[{"vid":"V1","name":"age","wgt":1},{"vid":"V2","name":"sex","wgt":0}]}`,
+		})
+		rec := &driftRecorder{}
+		client := NewClient(ts.URL, WithDriftHook(rec.hook), WithNADAVersion(NADA4))
+
+		_, err := client.Search(ctx, NewDefaultSearchParams())
+		assert.NoError(t, err)
+		err = client.EachSurveyVar(ctx, "X", func(Variable) error { return nil })
+		assert.NoError(t, err)
+
+		assert.Len(t, rec.reports, 2)
+		assert.Equal(t, NADA4, rec.reports[0].Version)
+		for _, issue := range rec.reports[0].Issues {
+			assert.Equal(t, DriftCoerced, issue.Kind, issue.Field)
+		}
+		assert.Equal(t, []DriftIssue{{Kind: DriftUnknownField, Field: "wgt", Found: "number", Count: 2}}, rec.reports[1].Issues)
+	})
+
+	t.Run("no hook", func(t *testing.T) {
+		assert.Nil(t, NewClient("http://localhost").driftCheck("search", "", NADA5))
+	})
+}
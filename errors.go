@@ -2,6 +2,7 @@ package nadago
 
 import (
 	"fmt"
+	"time"
 )
 
 type FetchErr struct {
@@ -14,6 +15,18 @@ type AppErr struct {
 	Message    string
 }
 
+type ValidationErr struct {
+	Field   string
+	Message string
+}
+
+// ErrCircuitOpen is returned without sending a request while the circuit
+// breaker of the client is open
+type ErrCircuitOpen struct {
+	Host  string
+	Until time.Time
+}
+
 func (e FetchErr) Error() string {
 	return fmt.Sprintf("failed to fetch response: %s with statuscode: %d", e.Message, e.StatusCode)
 }
@@ -21,3 +34,11 @@ func (e FetchErr) Error() string {
 func (e AppErr) Error() string {
 	return fmt.Sprintf("Application side error: %s with statuscode: %d", e.Message, e.StatusCode)
 }
+
+func (e ValidationErr) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s until %s", e.Host, e.Until.Format(time.RFC3339))
+}
@@ -0,0 +1,306 @@
+package nadago
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+type ExportFormat string
+
+const (
+	ExportDDI  ExportFormat = "ddi"
+	ExportJSON ExportFormat = "json"
+)
+
+// GetStudyExport streams the catalog's native DDI-Codebook XML or JSON export
+// for a study. The caller must close the returned reader
+func (c *Client) GetStudyExport(ctx context.Context, idno string, format ExportFormat) (io.ReadCloser, error) {
+	if format != ExportDDI && format != ExportJSON {
+		return nil, AppErr{
+			Message:    fmt.Sprintf("unsupported export format: %q", format),
+			StatusCode: 1001,
+		}
+	}
+
+	if _, err := c.version(ctx, "export"); err != nil {
+		return nil, err
+	}
+
+	body, err := c.open(ctx, request{
+		endpoint: "export",
+		path:     "/" + url.PathEscape(idno) + "/" + string(format),
+		uncached: true,
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}, {Key: "nadago.format", Value: string(format)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// GetStudyDDI fetches the DDI export of a study and parses it with ParseDDI
+func (c *Client) GetStudyDDI(ctx context.Context, idno string) (SurveyMeta, []Variable, error) {
+	body, err := c.GetStudyExport(ctx, idno, ExportDDI)
+	if err != nil {
+		return SurveyMeta{}, nil, err
+	}
+	defer body.Close()
+
+	meta, vars, err := ParseDDI(body)
+	if err != nil {
+		return SurveyMeta{}, nil, AppErr{
+			Message:    fmt.Errorf("failed to parse DDI export. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	if meta.Idno == "" {
+		meta.Idno = idno
+	}
+	for i := range vars {
+		vars[i].Idno = meta.Idno
+	}
+
+	return meta, vars, nil
+}
+
+type ddiCodebook struct {
+	StudyDscr struct {
+		Citation struct {
+			Title  string `xml:"titlStmt>titl"`
+			IDNo   string `xml:"titlStmt>IDNo"`
+			AltTtl string `xml:"titlStmt>altTitl"`
+			SubTtl string `xml:"titlStmt>subTitl"`
+		} `xml:"citation"`
+		StdyInfo struct {
+			Abstract string `xml:"abstract"`
+			SumDscr  struct {
+				Nation []struct {
+					Abbr string `xml:"abbr,attr"`
+					Name string `xml:",chardata"`
+				} `xml:"nation"`
+				CollDate []struct {
+					Event string `xml:"event,attr"`
+					Date  string `xml:"date,attr"`
+				} `xml:"collDate"`
+				GeogCover string `xml:"geogCover"`
+				AnlyUnit  string `xml:"anlyUnit"`
+				Universe  string `xml:"universe"`
+				DataKind  string `xml:"dataKind"`
+			} `xml:"sumDscr"`
+		} `xml:"stdyInfo"`
+		Method struct {
+			SampProc string `xml:"dataColl>sampProc"`
+			CollMode string `xml:"dataColl>collMode"`
+		} `xml:"method"`
+	} `xml:"stdyDscr"`
+	FileDscr []struct {
+		ID       string `xml:"ID,attr"`
+		FileName string `xml:"fileTxt>fileName"`
+		Contents string `xml:"fileTxt>fileCont"`
+	} `xml:"fileDscr"`
+	Vars []ddiVar `xml:"dataDscr>var"`
+}
+
+type ddiVar struct {
+	ID       string `xml:"ID,attr"`
+	Name     string `xml:"name,attr"`
+	Files    string `xml:"files,attr"`
+	Intrvl   string `xml:"intrvl,attr"`
+	Labl     string `xml:"labl"`
+	PreQTxt  string `xml:"qstn>preQTxt"`
+	QstnLit  string `xml:"qstn>qstnLit"`
+	PostQTxt string `xml:"qstn>postQTxt"`
+	Universe string `xml:"universe"`
+	SumStat  []struct {
+		Type  string `xml:"type,attr"`
+		Wgtd  string `xml:"wgtd,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"sumStat"`
+	Catgry []struct {
+		Value   string `xml:"catValu"`
+		Labl    string `xml:"labl"`
+		CatStat []struct {
+			Type  string `xml:"type,attr"`
+			Wgtd  string `xml:"wgtd,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"catStat"`
+	} `xml:"catgry"`
+	Format struct {
+		Type string `xml:"type,attr"`
+	} `xml:"varFormat"`
+}
+
+// ParseDDI decodes a DDI-Codebook document into the same study and variable
+// models returned by GetSurveyMeta and GetVarMeta, with Data laid out like the
+// catalog's JSON responses
+func ParseDDI(r io.Reader) (SurveyMeta, []Variable, error) {
+	var cb ddiCodebook
+	if err := xml.NewDecoder(r).Decode(&cb); err != nil {
+		return SurveyMeta{}, nil, err
+	}
+
+	sd := cb.StudyDscr
+	idno := strings.TrimSpace(sd.Citation.IDNo)
+
+	nations := make([]interface{}, 0, len(sd.StdyInfo.SumDscr.Nation))
+	names := make([]string, 0, len(sd.StdyInfo.SumDscr.Nation))
+	for _, n := range sd.StdyInfo.SumDscr.Nation {
+		name := strings.TrimSpace(n.Name)
+		names = append(names, name)
+		nations = append(nations, map[string]interface{}{
+			"name":         name,
+			"abbreviation": n.Abbr,
+		})
+	}
+
+	var start, end string
+	for _, d := range sd.StdyInfo.SumDscr.CollDate {
+		switch d.Event {
+		case "start", "single":
+			if start == "" || d.Date < start {
+				start = d.Date
+			}
+			if d.Event == "single" && d.Date > end {
+				end = d.Date
+			}
+		case "end":
+			if d.Date > end {
+				end = d.Date
+			}
+		}
+	}
+
+	files := make([]interface{}, 0, len(cb.FileDscr))
+	for _, f := range cb.FileDscr {
+		files = append(files, map[string]interface{}{
+			"file_id":     f.ID,
+			"file_name":   strings.TrimSpace(f.FileName),
+			"description": strings.TrimSpace(f.Contents),
+		})
+	}
+
+	meta := SurveyMeta{
+		Idno: idno,
+		Data: map[string]interface{}{
+			"idno":       idno,
+			"title":      strings.TrimSpace(sd.Citation.Title),
+			"nation":     strings.Join(names, ", "),
+			"year_start": yearOf(start),
+			"year_end":   yearOf(end),
+			"data_files": files,
+			"metadata": map[string]interface{}{
+				"study_desc": map[string]interface{}{
+					"title_statement": map[string]interface{}{
+						"idno":      idno,
+						"title":     strings.TrimSpace(sd.Citation.Title),
+						"sub_title": strings.TrimSpace(sd.Citation.SubTtl),
+						"alt_title": strings.TrimSpace(sd.Citation.AltTtl),
+					},
+					"study_info": map[string]interface{}{
+						"abstract":      strings.TrimSpace(sd.StdyInfo.Abstract),
+						"nation":        nations,
+						"geog_coverage": strings.TrimSpace(sd.StdyInfo.SumDscr.GeogCover),
+						"analysis_unit": strings.TrimSpace(sd.StdyInfo.SumDscr.AnlyUnit),
+						"universe":      strings.TrimSpace(sd.StdyInfo.SumDscr.Universe),
+						"data_kind":     strings.TrimSpace(sd.StdyInfo.SumDscr.DataKind),
+					},
+					"method": map[string]interface{}{
+						"data_collection": map[string]interface{}{
+							"sampling_procedure": strings.TrimSpace(sd.Method.SampProc),
+							"coll_mode":          strings.TrimSpace(sd.Method.CollMode),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	vars := make([]Variable, 0, len(cb.Vars))
+	for _, dv := range cb.Vars {
+		vars = append(vars, Variable{
+			Idno: idno,
+			Vid:  dv.ID,
+			Data: dv.toMap(),
+		})
+	}
+
+	return meta, vars, nil
+}
+
+func (dv ddiVar) toMap() map[string]interface{} {
+	fid := strings.Fields(dv.Files)
+	file := ""
+	if len(fid) > 0 {
+		file = fid[0]
+	}
+
+	sumstats := make([]interface{}, 0, len(dv.SumStat))
+	for _, s := range dv.SumStat {
+		sumstats = append(sumstats, map[string]interface{}{
+			"type":  s.Type,
+			"value": strings.TrimSpace(s.Value),
+			"wgtd":  nullIfEmpty(s.Wgtd),
+		})
+	}
+
+	catgry := make([]interface{}, 0, len(dv.Catgry))
+	for _, c := range dv.Catgry {
+		stats := make([]interface{}, 0, len(c.CatStat))
+		for _, s := range c.CatStat {
+			stats = append(stats, map[string]interface{}{
+				"type":  s.Type,
+				"value": strings.TrimSpace(s.Value),
+				"wgtd":  nullIfEmpty(s.Wgtd),
+			})
+		}
+		catgry = append(catgry, map[string]interface{}{
+			"value": strings.TrimSpace(c.Value),
+			"labl":  strings.TrimSpace(c.Labl),
+			"stats": stats,
+		})
+	}
+
+	name := strings.TrimSpace(dv.Name)
+	labl := strings.TrimSpace(dv.Labl)
+	qstn := strings.TrimSpace(dv.QstnLit)
+
+	return map[string]interface{}{
+		"vid":  dv.ID,
+		"fid":  file,
+		"name": name,
+		"labl": labl,
+		"qstn": nullIfEmpty(qstn),
+		"metadata": map[string]interface{}{
+			"file_id":           file,
+			"vid":               dv.ID,
+			"name":              name,
+			"labl":              labl,
+			"var_intrvl":        dv.Intrvl,
+			"var_qstn_preqtxt":  nullIfEmpty(strings.TrimSpace(dv.PreQTxt)),
+			"var_qstn_qstnlit":  nullIfEmpty(qstn),
+			"var_qstn_postqtxt": nullIfEmpty(strings.TrimSpace(dv.PostQTxt)),
+			"var_universe":      nullIfEmpty(strings.TrimSpace(dv.Universe)),
+			"var_sumstat":       sumstats,
+			"var_catgry":        catgry,
+			"var_format":        map[string]interface{}{"type": dv.Format.Type},
+		},
+	}
+}
+
+func yearOf(date string) interface{} {
+	if len(date) < 4 {
+		return nil
+	}
+	return date[:4]
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,689 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/northeastloon/nadago"
+)
+
+// ColumnType is the logical type of a Parquet column
+type ColumnType int
+
+const (
+	StringColumn ColumnType = iota
+	Int32Column
+	Int64Column
+	DoubleColumn
+	BooleanColumn
+	// TimestampColumn stores time.Time values as UTC milliseconds
+	TimestampColumn
+)
+
+type Column struct {
+	Name     string
+	Type     ColumnType
+	Optional bool
+}
+
+// physical types, converted types and encodings from parquet.thrift
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+func (t ColumnType) physical() int32 {
+	switch t {
+	case Int32Column:
+		return typeInt32
+	case Int64Column, TimestampColumn:
+		return typeInt64
+	case DoubleColumn:
+		return typeDouble
+	case BooleanColumn:
+		return typeBoolean
+	default:
+		return typeByteArray
+	}
+}
+
+var parquetMagic = []byte("PAR1")
+
+// DefaultRowGroupSize is the number of rows buffered before a row group is written
+const DefaultRowGroupSize = 10000
+
+type ParquetOption func(w *ParquetWriter)
+
+// WithRowGroupSize sets how many rows are held in memory before being written
+// out as a row group
+func WithRowGroupSize(n int) ParquetOption {
+	return func(w *ParquetWriter) {
+		if n > 0 {
+			w.groupSize = n
+		}
+	}
+}
+
+// ParquetWriter writes rows to an uncompressed, PLAIN encoded Parquet file.
+// Rows are buffered until a row group is full, so memory use is bounded by the
+// row group size rather than the size of the file
+type ParquetWriter struct {
+	w         *countingWriter
+	columns   []Column
+	chunks    []*columnChunk
+	groupSize int
+	rows      int
+	groups    []rowGroup
+	numRows   int64
+	closed    bool
+}
+
+type columnChunk struct {
+	defs   []byte
+	values bytes.Buffer
+	bools  []bool
+}
+
+type rowGroup struct {
+	columns []chunkMeta
+	size    int64
+	rows    int64
+}
+
+type chunkMeta struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+func NewParquetWriter(w io.Writer, columns []Column, opts ...ParquetOption) *ParquetWriter {
+	pw := &ParquetWriter{
+		w:         &countingWriter{w: w},
+		columns:   columns,
+		chunks:    make([]*columnChunk, len(columns)),
+		groupSize: DefaultRowGroupSize,
+	}
+	for i := range pw.chunks {
+		pw.chunks[i] = &columnChunk{}
+	}
+	for _, o := range opts {
+		o(pw)
+	}
+	return pw
+}
+
+// Write appends a row with one value per column. Optional columns accept nil
+func (pw *ParquetWriter) Write(values ...interface{}) error {
+	if pw.closed {
+		return errors.New("parquet writer is closed")
+	}
+	if len(values) != len(pw.columns) {
+		return fmt.Errorf("expected %d values, got %d", len(pw.columns), len(values))
+	}
+
+	// convert the whole row first so a bad value never leaves a partial row
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		c, err := convert(pw.columns[i], v)
+		if err != nil {
+			return err
+		}
+		row[i] = c
+	}
+
+	for i, v := range row {
+		col, chunk := pw.columns[i], pw.chunks[i]
+		if col.Optional {
+			if v == nil {
+				chunk.defs = append(chunk.defs, 0)
+				continue
+			}
+			chunk.defs = append(chunk.defs, 1)
+		}
+		switch v := v.(type) {
+		case string:
+			binary.Write(&chunk.values, binary.LittleEndian, uint32(len(v)))
+			chunk.values.WriteString(v)
+		case int32, int64:
+			binary.Write(&chunk.values, binary.LittleEndian, v)
+		case float64:
+			binary.Write(&chunk.values, binary.LittleEndian, math.Float64bits(v))
+		case bool:
+			chunk.bools = append(chunk.bools, v)
+		}
+	}
+
+	pw.rows++
+	if pw.rows >= pw.groupSize {
+		return pw.Flush()
+	}
+	return nil
+}
+
+func convert(col Column, v interface{}) (interface{}, error) {
+	if v == nil {
+		if !col.Optional {
+			return nil, fmt.Errorf("column %s is required", col.Name)
+		}
+		return nil, nil
+	}
+
+	switch col.Type {
+	case StringColumn:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		}
+	case Int32Column:
+		switch v := v.(type) {
+		case int32:
+			return v, nil
+		case int:
+			if v >= math.MinInt32 && v <= math.MaxInt32 {
+				return int32(v), nil
+			}
+			return nil, fmt.Errorf("value %d overflows int32 column %s", v, col.Name)
+		}
+	case Int64Column:
+		switch v := v.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		}
+	case DoubleColumn:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		}
+	case BooleanColumn:
+		if v, ok := v.(bool); ok {
+			return v, nil
+		}
+	case TimestampColumn:
+		if v, ok := v.(time.Time); ok {
+			return v.UnixMilli(), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported value %T for column %s", v, col.Name)
+}
+
+// Flush writes buffered rows as a row group
+func (pw *ParquetWriter) Flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	if err := pw.start(); err != nil {
+		return err
+	}
+
+	group := rowGroup{rows: int64(pw.rows)}
+	for i, col := range pw.columns {
+		chunk := pw.chunks[i]
+
+		var body bytes.Buffer
+		if col.Optional {
+			levels := encodeLevels(chunk.defs)
+			binary.Write(&body, binary.LittleEndian, uint32(len(levels)))
+			body.Write(levels)
+		}
+		if col.Type == BooleanColumn {
+			body.Write(packBools(chunk.bools))
+		} else {
+			body.Write(chunk.values.Bytes())
+		}
+
+		header := pageHeader(pw.rows, body.Len())
+		offset := pw.w.n
+		if _, err := pw.w.Write(header); err != nil {
+			return err
+		}
+		if _, err := pw.w.Write(body.Bytes()); err != nil {
+			return err
+		}
+
+		size := int64(len(header) + body.Len())
+		group.columns = append(group.columns, chunkMeta{offset: offset, size: size, values: int64(pw.rows)})
+		group.size += size
+		pw.chunks[i] = &columnChunk{}
+	}
+
+	pw.groups = append(pw.groups, group)
+	pw.numRows += group.rows
+	pw.rows = 0
+	return nil
+}
+
+// Close flushes any buffered rows and writes the file footer. It does not close
+// the underlying writer
+func (pw *ParquetWriter) Close() error {
+	if pw.closed {
+		return nil
+	}
+	if err := pw.Flush(); err != nil {
+		return err
+	}
+	if err := pw.start(); err != nil {
+		return err
+	}
+	pw.closed = true
+
+	footer := pw.fileMetaData()
+	if _, err := pw.w.Write(footer); err != nil {
+		return err
+	}
+	if err := binary.Write(pw.w, binary.LittleEndian, uint32(len(footer))); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(parquetMagic)
+	return err
+}
+
+func (pw *ParquetWriter) start() error {
+	if pw.w.n > 0 {
+		return nil
+	}
+	_, err := pw.w.Write(parquetMagic)
+	return err
+}
+
+// encodeLevels encodes definition levels as runs of the RLE/bit-packing hybrid
+// encoding with a bit width of one
+func encodeLevels(levels []byte) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, levels[i])
+		i = j
+	}
+	return out
+}
+
+func packBools(values []bool) []byte {
+	out := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+func pageHeader(numValues, size int) []byte {
+	var t thrift
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.structField(5, func() {
+		t.i32(1, int32(numValues))
+		t.i32(2, encodingPlain)
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+	})
+	t.stop()
+	return t.buf.Bytes()
+}
+
+func (pw *ParquetWriter) fileMetaData() []byte {
+	var t thrift
+	t.i32(1, 1)
+
+	t.listField(2, thriftStruct, len(pw.columns)+1)
+	t.structure(func() {
+		t.binary(4, "schema")
+		t.i32(5, int32(len(pw.columns)))
+	})
+	for _, col := range pw.columns {
+		t.structure(func() {
+			t.i32(1, col.Type.physical())
+			if col.Optional {
+				t.i32(3, 1)
+			} else {
+				t.i32(3, 0)
+			}
+			t.binary(4, col.Name)
+			switch col.Type {
+			case StringColumn:
+				t.i32(6, convertedUTF8)
+			case TimestampColumn:
+				t.i32(6, convertedTimestampMillis)
+			}
+		})
+	}
+
+	t.i64(3, pw.numRows)
+
+	t.listField(4, thriftStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		t.structure(func() {
+			t.listField(1, thriftStruct, len(g.columns))
+			for i, c := range g.columns {
+				col := pw.columns[i]
+				t.structure(func() {
+					t.i64(2, c.offset)
+					t.structField(3, func() {
+						t.i32(1, col.Type.physical())
+						t.listField(2, thriftI32, 2)
+						t.writeI32(encodingPlain)
+						t.writeI32(encodingRLE)
+						t.listField(3, thriftBinary, 1)
+						t.writeBinary(col.Name)
+						t.i32(4, 0) // UNCOMPRESSED
+						t.i64(5, c.values)
+						t.i64(6, c.size)
+						t.i64(7, c.size)
+						t.i64(9, c.offset)
+					})
+				})
+			}
+			t.i64(2, g.size)
+			t.i64(3, g.rows)
+		})
+	}
+
+	t.binary(6, "nadago")
+	t.stop()
+	return t.buf.Bytes()
+}
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thrift is a minimal encoder for the thrift compact protocol, covering the
+// types used by Parquet file metadata
+type thrift struct {
+	buf   bytes.Buffer
+	last  int16
+	stack []int16
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.writeVarint(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thrift) writeVarint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63))))
+}
+
+func (t *thrift) writeI32(v int32) {
+	t.writeVarint(int64(v))
+}
+
+func (t *thrift) writeBinary(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.writeI32(v)
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.writeVarint(v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.writeBinary(s)
+}
+
+// listField writes a list header. The n elements must be written next
+func (t *thrift) listField(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+// structure writes a struct whose fields are written by fn, as a list element
+// or after a field header
+func (t *thrift) structure(fn func()) {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+	fn()
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thrift) structField(id int16, fn func()) {
+	t.field(id, thriftStruct)
+	t.structure(fn)
+}
+
+func (t *thrift) stop() {
+	t.buf.WriteByte(0)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// SurveyColumns is the schema of survey files written by SurveyParquet:
+//
+//	idno        string     required
+//	title       string     optional
+//	nation      string     optional
+//	year_start  int32      optional, null when the catalog reports no year
+//	year_end    int32      optional
+//	created     timestamp  optional, milliseconds UTC
+//	changed     timestamp  optional
+//	url         string     optional
+//	varcount    int32      required
+var SurveyColumns = []Column{
+	{Name: "idno", Type: StringColumn},
+	{Name: "title", Type: StringColumn, Optional: true},
+	{Name: "nation", Type: StringColumn, Optional: true},
+	{Name: "year_start", Type: Int32Column, Optional: true},
+	{Name: "year_end", Type: Int32Column, Optional: true},
+	{Name: "created", Type: TimestampColumn, Optional: true},
+	{Name: "changed", Type: TimestampColumn, Optional: true},
+	{Name: "url", Type: StringColumn, Optional: true},
+	{Name: "varcount", Type: Int32Column},
+}
+
+// VariableColumns is the schema of variable files written by VariableParquet:
+//
+//	idno      string  required
+//	vid       string  required
+//	fid       string  optional
+//	name      string  optional
+//	label     string  optional
+//	question  string  optional, literal question text
+var VariableColumns = []Column{
+	{Name: "idno", Type: StringColumn},
+	{Name: "vid", Type: StringColumn},
+	{Name: "fid", Type: StringColumn, Optional: true},
+	{Name: "name", Type: StringColumn, Optional: true},
+	{Name: "label", Type: StringColumn, Optional: true},
+	{Name: "question", Type: StringColumn, Optional: true},
+}
+
+// CategoryColumns is the schema of category files written by VariableParquet,
+// one row per value label of a variable:
+//
+//	idno       string  required
+//	vid        string  required
+//	value      string  required
+//	label      string  optional
+//	frequency  double  optional, the unweighted frequency when reported
+var CategoryColumns = []Column{
+	{Name: "idno", Type: StringColumn},
+	{Name: "vid", Type: StringColumn},
+	{Name: "value", Type: StringColumn},
+	{Name: "label", Type: StringColumn, Optional: true},
+	{Name: "frequency", Type: DoubleColumn, Optional: true},
+}
+
+// StatisticColumns is the schema of summary statistic files written by
+// VariableParquet, one row per statistic of a variable:
+//
+//	idno      string   required
+//	vid       string   required
+//	type      string   required, e.g. vald, invd, mean
+//	weighted  boolean  required
+//	value     string   optional, as reported by the catalog
+var StatisticColumns = []Column{
+	{Name: "idno", Type: StringColumn},
+	{Name: "vid", Type: StringColumn},
+	{Name: "type", Type: StringColumn},
+	{Name: "weighted", Type: BooleanColumn},
+	{Name: "value", Type: StringColumn, Optional: true},
+}
+
+// SurveyParquet writes search results using SurveyColumns
+type SurveyParquet struct {
+	w *ParquetWriter
+}
+
+func NewSurveyParquet(w io.Writer, opts ...ParquetOption) *SurveyParquet {
+	return &SurveyParquet{w: NewParquetWriter(w, SurveyColumns, opts...)}
+}
+
+func (p *SurveyParquet) Write(surveys ...nadago.Survey) error {
+	for _, s := range surveys {
+		err := p.w.Write(s.Idno, optional(s.Title), optional(s.Nation), optionalInt(s.Start), optionalInt(s.End),
+			optionalTime(s.Created.Time), optionalTime(s.Changed.Time), optional(s.Url), s.Varcount)
+		if err != nil {
+			return fmt.Errorf("failed to write study %s: %w", s.Idno, err)
+		}
+	}
+	return nil
+}
+
+func (p *SurveyParquet) Close() error {
+	return p.w.Close()
+}
+
+// VariableParquet writes variables using VariableColumns and, when their
+// writers are not nil, categories and statistics to separate files joined on
+// idno and vid
+type VariableParquet struct {
+	variables  *ParquetWriter
+	categories *ParquetWriter
+	statistics *ParquetWriter
+}
+
+func NewVariableParquet(variables, categories, statistics io.Writer, opts ...ParquetOption) *VariableParquet {
+	p := &VariableParquet{variables: NewParquetWriter(variables, VariableColumns, opts...)}
+	if categories != nil {
+		p.categories = NewParquetWriter(categories, CategoryColumns, opts...)
+	}
+	if statistics != nil {
+		p.statistics = NewParquetWriter(statistics, StatisticColumns, opts...)
+	}
+	return p
+}
+
+// Write accepts rows from a variable list or details from GetVarMeta. Only
+// details carry categories and statistics
+func (p *VariableParquet) Write(vars ...nadago.Variable) error {
+	for _, v := range vars {
+		err := p.variables.Write(v.Idno, v.Vid, optional(v.FileID()), optional(v.Name()), optional(v.Label()), optional(v.Question()))
+		if err != nil {
+			return fmt.Errorf("failed to write variable %s/%s: %w", v.Idno, v.Vid, err)
+		}
+
+		if p.categories != nil {
+			for _, c := range v.Categories() {
+				var freq interface{}
+				if f, ok := c.Frequency(); ok {
+					freq = f
+				}
+				if err := p.categories.Write(v.Idno, v.Vid, c.Value, optional(c.Label), freq); err != nil {
+					return fmt.Errorf("failed to write category %s of %s/%s: %w", c.Value, v.Idno, v.Vid, err)
+				}
+			}
+		}
+
+		if p.statistics != nil {
+			for _, s := range v.SumStats() {
+				if err := p.statistics.Write(v.Idno, v.Vid, s.Type, s.Weighted, optional(s.Value)); err != nil {
+					return fmt.Errorf("failed to write statistic %s of %s/%s: %w", s.Type, v.Idno, v.Vid, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Close writes the footers of every file, returning the first error
+func (p *VariableParquet) Close() error {
+	var first error
+	for _, w := range []*ParquetWriter{p.variables, p.categories, p.statistics} {
+		if w == nil {
+			continue
+		}
+		if err := w.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func optionalInt(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
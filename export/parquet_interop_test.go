@@ -0,0 +1,53 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+// TestParquetInterop reads a file written by ParquetWriter with another Parquet
+// implementation
+func TestParquetInterop(t *testing.T) {
+	created := time.Date(2022, 5, 11, 11, 14, 45, 0, time.UTC)
+
+	var buf bytes.Buffer
+	w := NewParquetWriter(&buf, []Column{
+		{Name: "idno", Type: StringColumn},
+		{Name: "title", Type: StringColumn, Optional: true},
+		{Name: "year", Type: Int32Column, Optional: true},
+		{Name: "cases", Type: Int64Column},
+		{Name: "weight", Type: DoubleColumn, Optional: true},
+		{Name: "public", Type: BooleanColumn},
+		{Name: "created", Type: TimestampColumn, Optional: true},
+	}, WithRowGroupSize(2))
+	assert.NoError(t, w.Write("KEN_2021_HFS", "Ménage", 2021, 1200, 1.5, true, created))
+	assert.NoError(t, w.Write("UGA_2019_LFS", nil, nil, 0, nil, false, nil))
+	assert.NoError(t, w.Write("ALB_2012_LSMS", "家庭", 2012, 6671, 0.25, true, nil))
+	assert.NoError(t, w.Close())
+
+	f, err := buffer.NewBufferFile(buf.Bytes())
+	assert.NoError(t, err)
+	pr, err := reader.NewParquetColumnReader(f, 1)
+	assert.NoError(t, err)
+	defer pr.ReadStop()
+	assert.Equal(t, int64(3), pr.GetNumRows())
+
+	column := func(name string) []interface{} {
+		values, _, _, err := pr.ReadColumnByPath(common.ReformPathStr("schema."+name), pr.GetNumRows())
+		assert.NoError(t, err, name)
+		return values
+	}
+	assert.Equal(t, []interface{}{"KEN_2021_HFS", "UGA_2019_LFS", "ALB_2012_LSMS"}, column("idno"))
+	assert.Equal(t, []interface{}{"Ménage", nil, "家庭"}, column("title"))
+	assert.Equal(t, []interface{}{int32(2021), nil, int32(2012)}, column("year"))
+	assert.Equal(t, []interface{}{int64(1200), int64(0), int64(6671)}, column("cases"))
+	assert.Equal(t, []interface{}{1.5, nil, 0.25}, column("weight"))
+	assert.Equal(t, []interface{}{true, false, true}, column("public"))
+	assert.Equal(t, []interface{}{created.UnixMilli(), nil, nil}, column("created"))
+}
@@ -0,0 +1,267 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+)
+
+// thriftReader decodes thrift compact structs into maps keyed by field id
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) byte() byte {
+	b := r.b[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.b[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.byte()
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(elem)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic("unexpected thrift type")
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	m := map[int16]interface{}{}
+	var last int16
+	for {
+		h := r.byte()
+		if h == 0 {
+			return m
+		}
+		if delta := int16(h >> 4); delta == 0 {
+			last = int16(r.varint())
+		} else {
+			last += delta
+		}
+		m[last] = r.value(h & 0x0f)
+	}
+}
+
+type parquetFile struct {
+	b    []byte
+	meta map[int16]interface{}
+}
+
+func readParquet(t *testing.T, b []byte) parquetFile {
+	assert.Equal(t, parquetMagic, b[:4])
+	assert.Equal(t, parquetMagic, b[len(b)-4:])
+	n := int(binary.LittleEndian.Uint32(b[len(b)-8:]))
+	r := thriftReader{b: b, pos: len(b) - 8 - n}
+	meta := r.structure()
+	assert.Equal(t, len(b)-8, r.pos)
+	return parquetFile{b: b, meta: meta}
+}
+
+func (f parquetFile) schema() []string {
+	var names []string
+	for _, e := range f.meta[2].([]interface{})[1:] {
+		names = append(names, e.(map[int16]interface{})[4].(string))
+	}
+	return names
+}
+
+// column decodes every value of a column across row groups, with nil for nulls
+func (f parquetFile) column(name string) []interface{} {
+	idx, optional, physical := -1, false, int64(0)
+	for i, e := range f.meta[2].([]interface{})[1:] {
+		el := e.(map[int16]interface{})
+		if el[4] == name {
+			idx, optional, physical = i, el[3] == int64(1), el[1].(int64)
+		}
+	}
+
+	var out []interface{}
+	for _, g := range f.meta[4].([]interface{}) {
+		chunk := g.(map[int16]interface{})[1].([]interface{})[idx].(map[int16]interface{})
+		offset := chunk[3].(map[int16]interface{})[9].(int64)
+
+		r := thriftReader{b: f.b, pos: int(offset)}
+		header := r.structure()
+		body := f.b[r.pos : r.pos+int(header[3].(int64))]
+		n := int(header[5].(map[int16]interface{})[1].(int64))
+
+		defs := make([]byte, 0, n)
+		if optional {
+			l := int(binary.LittleEndian.Uint32(body))
+			lr := thriftReader{b: body[4 : 4+l]}
+			for lr.pos < l {
+				run := int(lr.uvarint() >> 1)
+				v := lr.byte()
+				for i := 0; i < run; i++ {
+					defs = append(defs, v)
+				}
+			}
+			body = body[4+l:]
+		} else {
+			for i := 0; i < n; i++ {
+				defs = append(defs, 1)
+			}
+		}
+
+		pos, bit := 0, 0
+		for _, d := range defs {
+			if d == 0 {
+				out = append(out, nil)
+				continue
+			}
+			switch physical {
+			case typeByteArray:
+				l := int(binary.LittleEndian.Uint32(body[pos:]))
+				out = append(out, string(body[pos+4:pos+4+l]))
+				pos += 4 + l
+			case typeInt32:
+				out = append(out, int32(binary.LittleEndian.Uint32(body[pos:])))
+				pos += 4
+			case typeInt64:
+				out = append(out, int64(binary.LittleEndian.Uint64(body[pos:])))
+				pos += 8
+			case typeDouble:
+				out = append(out, math.Float64frombits(binary.LittleEndian.Uint64(body[pos:])))
+				pos += 8
+			case typeBoolean:
+				out = append(out, body[bit/8]&(1<<(bit%8)) != 0)
+				bit++
+			}
+		}
+	}
+	return out
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: Int64Column},
+		{Name: "label", Type: StringColumn, Optional: true},
+		{Name: "ok", Type: BooleanColumn},
+	}
+
+	t.Run("row groups", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewParquetWriter(&buf, columns, WithRowGroupSize(2))
+		assert.NoError(t, w.Write(1, "Ménage", true))
+		assert.NoError(t, w.Write(2, nil, false))
+		assert.NoError(t, w.Write(3, "家庭", true))
+		assert.NoError(t, w.Close())
+
+		f := readParquet(t, buf.Bytes())
+		assert.Equal(t, []string{"id", "label", "ok"}, f.schema())
+		assert.Equal(t, int64(3), f.meta[3])
+		assert.Len(t, f.meta[4], 2)
+		assert.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, f.column("id"))
+		assert.Equal(t, []interface{}{"Ménage", nil, "家庭"}, f.column("label"))
+		assert.Equal(t, []interface{}{true, false, true}, f.column("ok"))
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, NewParquetWriter(&buf, columns).Close())
+		f := readParquet(t, buf.Bytes())
+		assert.Equal(t, int64(0), f.meta[3])
+	})
+
+	t.Run("invalid rows", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewParquetWriter(&buf, columns)
+		assert.ErrorContains(t, w.Write(nil, "x", true), "column id is required")
+		assert.ErrorContains(t, w.Write(1, 2, true), "unsupported value int for column label")
+		assert.ErrorContains(t, w.Write(1), "expected 3 values, got 1")
+		assert.NoError(t, w.Close())
+		assert.Equal(t, int64(0), readParquet(t, buf.Bytes()).meta[3])
+	})
+}
+
+func TestSurveyParquet(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewSurveyParquet(&buf)
+	created := time.Date(2022, 5, 11, 11, 14, 45, 0, time.UTC)
+	err := p.Write(
+		nadago.Survey{Idno: "KEN_2021_HFS", Title: "HFS", Nation: "Kenya", Start: 2021, End: 2021, Created: nadago.CatalogTime{Time: created}, Varcount: 2},
+		nadago.Survey{Idno: "ALB_2019_LFS"},
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Close())
+
+	f := readParquet(t, buf.Bytes())
+	assert.Equal(t, []string{"idno", "title", "nation", "year_start", "year_end", "created", "changed", "url", "varcount"}, f.schema())
+	assert.Equal(t, []interface{}{"KEN_2021_HFS", "ALB_2019_LFS"}, f.column("idno"))
+	assert.Equal(t, []interface{}{int32(2021), nil}, f.column("year_start"))
+	assert.Equal(t, []interface{}{created.UnixMilli(), nil}, f.column("created"))
+	assert.Equal(t, []interface{}{int32(2), int32(0)}, f.column("varcount"))
+
+	// timestamps carry the TIMESTAMP_MILLIS converted type
+	createdCol := f.meta[2].([]interface{})[6].(map[int16]interface{})
+	assert.Equal(t, int64(convertedTimestampMillis), createdCol[6])
+}
+
+func TestVariableParquet(t *testing.T) {
+	var vars, cats, stats bytes.Buffer
+	p := NewVariableParquet(&vars, &cats, &stats, WithRowGroupSize(1))
+	assert.NoError(t, p.Write(testVariables()...))
+	assert.NoError(t, p.Close())
+
+	vf := readParquet(t, vars.Bytes())
+	assert.Equal(t, []interface{}{"hhid", "sex"}, vf.column("name"))
+	assert.Equal(t, []interface{}{nil, "What is your sex?"}, vf.column("question"))
+	assert.Len(t, vf.meta[4], 2)
+
+	cf := readParquet(t, cats.Bytes())
+	assert.Equal(t, []interface{}{"V2", "V2"}, cf.column("vid"))
+	assert.Equal(t, []interface{}{"Male", "Female"}, cf.column("label"))
+	assert.Equal(t, []interface{}{float64(590), nil}, cf.column("frequency"))
+
+	sf := readParquet(t, stats.Bytes())
+	assert.Equal(t, []interface{}{"vald"}, sf.column("type"))
+	assert.Equal(t, []interface{}{false}, sf.column("weighted"))
+	assert.Equal(t, []interface{}{"1200"}, sf.column("value"))
+
+	t.Run("variables only", func(t *testing.T) {
+		var vars bytes.Buffer
+		p := NewVariableParquet(&vars, nil, nil)
+		assert.NoError(t, p.Write(testVariables()...))
+		assert.NoError(t, p.Close())
+		assert.Equal(t, int64(2), readParquet(t, vars.Bytes()).meta[3])
+	})
+}
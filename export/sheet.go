@@ -0,0 +1,218 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+)
+
+// Sheet is a flat table of text cells, written by WriteCSV and WriteXLSX.
+// Columns named in Numeric are written as numbers in workbooks
+type Sheet struct {
+	Name    string
+	Header  []string
+	Rows    [][]string
+	Numeric map[string]bool
+}
+
+// Select returns a copy of the sheet with only the named columns, in the given
+// order. Selecting no columns keeps every column
+func (s Sheet) Select(columns ...string) (Sheet, error) {
+	if len(columns) == 0 {
+		return s, nil
+	}
+
+	index := make(map[string]int, len(s.Header))
+	for i, h := range s.Header {
+		index[h] = i
+	}
+	picks := make([]int, len(columns))
+	for i, c := range columns {
+		j, ok := index[c]
+		if !ok {
+			return Sheet{}, fmt.Errorf("sheet %s has no column %s", s.Name, c)
+		}
+		picks[i] = j
+	}
+
+	out := Sheet{Name: s.Name, Header: append([]string{}, columns...), Numeric: s.Numeric}
+	out.Rows = make([][]string, len(s.Rows))
+	for i, row := range s.Rows {
+		r := make([]string, len(picks))
+		for k, j := range picks {
+			r[k] = row[j]
+		}
+		out.Rows[i] = r
+	}
+	return out, nil
+}
+
+// SurveySheet lists search results with the same columns as SurveyColumns
+func SurveySheet(surveys []nadago.Survey) Sheet {
+	s := Sheet{
+		Name:    "Studies",
+		Header:  []string{"idno", "title", "nation", "year_start", "year_end", "created", "changed", "url", "varcount"},
+		Numeric: map[string]bool{"year_start": true, "year_end": true, "varcount": true},
+	}
+	for _, sv := range surveys {
+		s.Rows = append(s.Rows, []string{sv.Idno, sv.Title, sv.Nation, formatYear(sv.Start), formatYear(sv.End),
+			formatTime(sv.Created.Time).String, formatTime(sv.Changed.Time).String, sv.Url, strconv.Itoa(sv.Varcount)})
+	}
+	return s
+}
+
+// VariableSheet lists variables from a variable list or GetVarMeta, with the
+// number of value labels each one has
+func VariableSheet(vars []nadago.Variable) Sheet {
+	s := Sheet{
+		Name:    "Variables",
+		Header:  []string{"idno", "vid", "fid", "name", "label", "question", "categories"},
+		Numeric: map[string]bool{"categories": true},
+	}
+	for _, v := range vars {
+		s.Rows = append(s.Rows, []string{v.Idno, v.Vid, v.FileID(), v.Name(), v.Label(), v.Question(), strconv.Itoa(len(v.Categories()))})
+	}
+	return s
+}
+
+// ValueLabelSheet lists the categories of every variable, one row per value
+func ValueLabelSheet(vars []nadago.Variable) Sheet {
+	s := Sheet{
+		Name:    "Value labels",
+		Header:  []string{"idno", "vid", "name", "value", "label", "frequency"},
+		Numeric: map[string]bool{"frequency": true},
+	}
+	for _, v := range vars {
+		for _, c := range v.Categories() {
+			var freq string
+			if f, ok := c.Frequency(); ok {
+				freq = strconv.FormatFloat(f, 'f', -1, 64)
+			}
+			s.Rows = append(s.Rows, []string{v.Idno, v.Vid, v.Name(), c.Value, c.Label, freq})
+		}
+	}
+	return s
+}
+
+// StudySheet lists descriptive study metadata as field and value pairs
+func StudySheet(meta nadago.SurveyMeta) Sheet {
+	return Sheet{
+		Name:   "Study info",
+		Header: []string{"field", "value"},
+		Rows: [][]string{
+			{"idno", meta.Idno},
+			{"title", meta.Title()},
+			{"nation", meta.Nation()},
+			{"abstract", meta.Abstract()},
+			{"sampling_procedure", meta.SamplingProcedure()},
+		},
+	}
+}
+
+// Dictionary returns the sheets of a study's data dictionary: variables, value
+// labels and study info
+func Dictionary(meta nadago.SurveyMeta, vars []nadago.Variable) []Sheet {
+	return []Sheet{VariableSheet(vars), ValueLabelSheet(vars), StudySheet(meta)}
+}
+
+func formatYear(y int) string {
+	if y == 0 {
+		return ""
+	}
+	return strconv.Itoa(y)
+}
+
+type CSVOption func(c *csvConfig)
+
+type csvConfig struct {
+	bom      bool
+	comma    rune
+	formulas bool
+}
+
+// WithBOM prefixes the output with a UTF-8 byte order mark, which spreadsheet
+// applications need to detect the encoding of non-Latin labels
+func WithBOM() CSVOption {
+	return func(c *csvConfig) {
+		c.bom = true
+	}
+}
+
+// WithDelimiter sets the field delimiter. The default is a comma
+func WithDelimiter(r rune) CSVOption {
+	return func(c *csvConfig) {
+		c.comma = r
+	}
+}
+
+// WithFormulas writes cells that look like formulas as they are, instead of
+// escaping them with a leading quote
+func WithFormulas() CSVOption {
+	return func(c *csvConfig) {
+		c.formulas = true
+	}
+}
+
+// WriteCSV writes a sheet with its header row. Fields containing delimiters,
+// quotes or line breaks are quoted. Text starting with =, +, -, @, a tab or a
+// carriage return would be run as a formula by spreadsheet applications, so it
+// is prefixed with a quote unless WithFormulas is given
+func WriteCSV(w io.Writer, s Sheet, opts ...CSVOption) error {
+	cfg := csvConfig{comma: ','}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	if cfg.bom {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+
+	escape := escapeFormulas
+	if cfg.formulas {
+		escape = func(cells []string) []string { return cells }
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = cfg.comma
+	if err := cw.Write(escape(s.Header)); err != nil {
+		return err
+	}
+	for _, row := range s.Rows {
+		if err := cw.Write(escape(row)); err != nil {
+			return fmt.Errorf("failed to write sheet %s: %w", s.Name, err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write sheet %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+// escapeFormulas returns the cells with a quote before text that spreadsheet
+// applications would evaluate. Numbers such as -1 are left as they are
+func escapeFormulas(cells []string) []string {
+	var out []string
+	for i, c := range cells {
+		if c == "" || !strings.ContainsRune("=+-@\t\r", rune(c[0])) {
+			continue
+		}
+		if _, err := strconv.ParseFloat(c, 64); err == nil {
+			continue
+		}
+		if out == nil {
+			out = append([]string{}, cells...)
+		}
+		out[i] = "'" + c
+	}
+	if out == nil {
+		return cells
+	}
+	return out
+}
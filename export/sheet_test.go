@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSheets(t *testing.T) {
+	t.Run("surveys", func(t *testing.T) {
+		created := time.Date(2022, 5, 11, 11, 14, 45, 0, time.UTC)
+		s := SurveySheet([]nadago.Survey{{Idno: "KEN_2021_HFS", Title: "HFS", Nation: "Kenya", Start: 2021, End: 2021, Created: nadago.CatalogTime{Time: created}, Varcount: 2}})
+		assert.Equal(t, [][]string{{"KEN_2021_HFS", "HFS", "Kenya", "2021", "2021", "2022-05-11T11:14:45Z", "", "", "2"}}, s.Rows)
+	})
+
+	t.Run("dictionary", func(t *testing.T) {
+		meta := nadago.SurveyMeta{Idno: "KEN_2021_HFS", Data: map[string]interface{}{"title": "HFS", "nation": "Kenya"}}
+		sheets := Dictionary(meta, testVariables())
+		assert.Len(t, sheets, 3)
+
+		assert.Equal(t, "Variables", sheets[0].Name)
+		assert.Equal(t, []string{"KEN_2021_HFS", "V2", "F1", "sex", "Sex", "What is your sex?", "2"}, sheets[0].Rows[1])
+
+		assert.Equal(t, "Value labels", sheets[1].Name)
+		assert.Equal(t, [][]string{
+			{"KEN_2021_HFS", "V2", "sex", "1", "Male", "590"},
+			{"KEN_2021_HFS", "V2", "sex", "2", "Female", ""},
+		}, sheets[1].Rows)
+
+		assert.Equal(t, "Study info", sheets[2].Name)
+		assert.Equal(t, []string{"title", "HFS"}, sheets[2].Rows[1])
+	})
+
+	t.Run("select", func(t *testing.T) {
+		s, err := VariableSheet(testVariables()).Select("name", "label")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"name", "label"}, s.Header)
+		assert.Equal(t, [][]string{{"hhid", "Household identifier"}, {"sex", "Sex"}}, s.Rows)
+
+		_, err = s.Select("vid")
+		assert.EqualError(t, err, "sheet Variables has no column vid")
+	})
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := Sheet{
+		Name:   "Value labels",
+		Header: []string{"value", "label"},
+		Rows: [][]string{
+			{"1", "Ménage, rural"},
+			{"2", `Dit "non"`},
+			{"3", "Домохозяйство\nгородское"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteCSV(&buf, s, WithBOM()))
+	assert.Equal(t, "\ufeffvalue,label\n1,\"Ménage, rural\"\n2,\"Dit \"\"non\"\"\"\n3,\"Домохозяйство\nгородское\"\n", buf.String())
+
+	records, err := csv.NewReader(bytes.NewReader(buf.Bytes()[3:])).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, s.Rows, records[1:])
+
+	buf.Reset()
+	assert.NoError(t, WriteCSV(&buf, s, WithDelimiter(';')))
+	assert.Contains(t, buf.String(), "value;label\n1;Ménage, rural\n")
+
+	t.Run("formulas are escaped", func(t *testing.T) {
+		s := Sheet{
+			Name:   "Value labels",
+			Header: []string{"value", "label"},
+			Rows: [][]string{
+				{"-1", `=HYPERLINK("http://example.org","Refused")`},
+				{"-2.5", "+1 or more"},
+				{"3", "@SUM(A1:A2)"},
+				{"4", "- none"},
+				{"5", "\tTab"},
+			},
+		}
+
+		var buf bytes.Buffer
+		assert.NoError(t, WriteCSV(&buf, s))
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"value", "label"},
+			{"-1", `'=HYPERLINK("http://example.org","Refused")`},
+			{"-2.5", "'+1 or more"},
+			{"3", "'@SUM(A1:A2)"},
+			{"4", "'- none"},
+			{"5", "'\tTab"},
+		}, records)
+		assert.Equal(t, `=HYPERLINK("http://example.org","Refused")`, s.Rows[0][1])
+
+		buf.Reset()
+		assert.NoError(t, WriteCSV(&buf, s, WithFormulas()))
+		records, err = csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Equal(t, s.Rows, records[1:])
+	})
+}
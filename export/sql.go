@@ -0,0 +1,285 @@
+// Package export writes catalog metadata to external formats: relational
+// databases, Parquet files and spreadsheets.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/northeastloon/nadago"
+)
+
+// Dialect captures the SQL differences between database engines
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+	MySQL
+)
+
+func (d Dialect) placeholder(n int) string {
+	if d == Postgres {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// upsert builds an insert that updates the given columns when a row with the
+// same key already exists. Columns in keep only replace stored values when the
+// new value is not null
+func (d Dialect) upsert(table string, columns, keys []string, keep ...string) string {
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = d.placeholder(i + 1)
+	}
+
+	isKey := map[string]bool{}
+	for _, k := range keys {
+		isKey[k] = true
+	}
+	isKept := map[string]bool{}
+	for _, k := range keep {
+		isKept[k] = true
+	}
+	var updates []string
+	for _, c := range columns {
+		if isKey[c] {
+			continue
+		}
+		value := "excluded." + c
+		if d == MySQL {
+			value = "VALUES(" + c + ")"
+		}
+		switch {
+		case isKept[c] && d == MySQL:
+			value = "COALESCE(" + value + ", " + c + ")"
+		case isKept[c]:
+			value = "COALESCE(" + value + ", " + table + "." + c + ")"
+		}
+		updates = append(updates, c+" = "+value)
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	switch {
+	case d == MySQL && len(updates) == 0:
+		return strings.Replace(q, "INSERT", "INSERT IGNORE", 1)
+	case d == MySQL:
+		return q + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	case len(updates) == 0:
+		return q + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO NOTHING"
+	default:
+		return q + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+}
+
+// Schema is the normalised layout written by SQLExporter. Keys are limited to
+// VARCHAR(255) so the same statements work on MySQL
+var Schema = []string{
+	`CREATE TABLE IF NOT EXISTS studies (
+	idno VARCHAR(255) NOT NULL PRIMARY KEY,
+	title TEXT,
+	nation TEXT,
+	year_start INTEGER,
+	year_end INTEGER,
+	created VARCHAR(64),
+	changed VARCHAR(64),
+	url TEXT,
+	varcount INTEGER,
+	abstract TEXT
+)`,
+	`CREATE TABLE IF NOT EXISTS data_files (
+	idno VARCHAR(255) NOT NULL,
+	fid VARCHAR(255) NOT NULL,
+	name TEXT,
+	description TEXT,
+	case_count INTEGER,
+	var_count INTEGER,
+	PRIMARY KEY (idno, fid)
+)`,
+	`CREATE TABLE IF NOT EXISTS variables (
+	idno VARCHAR(255) NOT NULL,
+	vid VARCHAR(255) NOT NULL,
+	fid VARCHAR(255),
+	name TEXT,
+	label TEXT,
+	question TEXT,
+	PRIMARY KEY (idno, vid)
+)`,
+	`CREATE TABLE IF NOT EXISTS categories (
+	idno VARCHAR(255) NOT NULL,
+	vid VARCHAR(255) NOT NULL,
+	value VARCHAR(255) NOT NULL,
+	label TEXT,
+	frequency DOUBLE PRECISION,
+	PRIMARY KEY (idno, vid, value)
+)`,
+	`CREATE TABLE IF NOT EXISTS statistics (
+	idno VARCHAR(255) NOT NULL,
+	vid VARCHAR(255) NOT NULL,
+	type VARCHAR(64) NOT NULL,
+	weighted INTEGER NOT NULL,
+	value TEXT,
+	PRIMARY KEY (idno, vid, type, weighted)
+)`,
+}
+
+// SQLExporter writes metadata into the tables in Schema through any
+// database/sql driver. Every write is an upsert keyed by idno and vid, so
+// repeated harvests update rows instead of duplicating them
+type SQLExporter struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func NewSQLExporter(db *sql.DB, dialect Dialect) *SQLExporter {
+	return &SQLExporter{db: db, dialect: dialect}
+}
+
+// CreateSchema creates any missing tables
+func (e *SQLExporter) CreateSchema(ctx context.Context) error {
+	for _, stmt := range Schema {
+		if _, err := e.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// WriteSurveys upserts search results into studies
+func (e *SQLExporter) WriteSurveys(ctx context.Context, surveys []nadago.Survey) error {
+	stmt := e.dialect.upsert("studies",
+		[]string{"idno", "title", "nation", "year_start", "year_end", "created", "changed", "url", "varcount"},
+		[]string{"idno"})
+
+	return e.tx(ctx, func(tx *sql.Tx) error {
+		for _, s := range surveys {
+			_, err := tx.ExecContext(ctx, stmt, s.Idno, s.Title, s.Nation, s.Start, s.End,
+				formatTime(s.Created.Time), formatTime(s.Changed.Time), s.Url, s.Varcount)
+			if err != nil {
+				return fmt.Errorf("failed to write study %s: %w", s.Idno, err)
+			}
+		}
+		return nil
+	})
+}
+
+// WriteStudy upserts the descriptive fields of study metadata into studies,
+// leaving columns only known from search results untouched, and its data files
+// into data_files
+func (e *SQLExporter) WriteStudy(ctx context.Context, meta nadago.SurveyMeta) error {
+	stmt := e.dialect.upsert("studies", []string{"idno", "title", "nation", "abstract"}, []string{"idno"})
+	fileStmt := e.dialect.upsert("data_files",
+		[]string{"idno", "fid", "name", "description", "case_count", "var_count"},
+		[]string{"idno", "fid"})
+
+	return e.tx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, stmt, meta.Idno, meta.Title(), meta.Nation(), meta.Abstract()); err != nil {
+			return fmt.Errorf("failed to write study %s: %w", meta.Idno, err)
+		}
+		for _, f := range meta.DataFiles() {
+			if f.ID == "" {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, fileStmt, meta.Idno, f.ID, nullString(f.Name), nullString(f.Description),
+				nullInt(f.CaseCount), nullInt(f.VarCount))
+			if err != nil {
+				return fmt.Errorf("failed to write data file %s/%s: %w", meta.Idno, f.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// WriteVariables upserts variables along with their data files, categories and
+// summary statistics. Categories and statistics of a variable that carries
+// either are replaced so values dropped upstream do not linger. Variable list
+// rows carry neither, so writing them keeps the details and question stored
+// from GetVarMeta
+func (e *SQLExporter) WriteVariables(ctx context.Context, vars []nadago.Variable) error {
+	d := e.dialect
+	fileStmt := d.upsert("data_files", []string{"idno", "fid"}, []string{"idno", "fid"})
+	varStmt := d.upsert("variables", []string{"idno", "vid", "fid", "name", "label", "question"}, []string{"idno", "vid"}, "fid", "question")
+	catStmt := d.upsert("categories", []string{"idno", "vid", "value", "label", "frequency"}, []string{"idno", "vid", "value"})
+	statStmt := d.upsert("statistics", []string{"idno", "vid", "type", "weighted", "value"}, []string{"idno", "vid", "type", "weighted"})
+	where := " WHERE idno = " + d.placeholder(1) + " AND vid = " + d.placeholder(2)
+
+	return e.tx(ctx, func(tx *sql.Tx) error {
+		files := map[string]bool{}
+		for _, v := range vars {
+			fid := v.FileID()
+			if fid != "" && !files[v.Idno+"/"+fid] {
+				files[v.Idno+"/"+fid] = true
+				if _, err := tx.ExecContext(ctx, fileStmt, v.Idno, fid); err != nil {
+					return fmt.Errorf("failed to write data file %s/%s: %w", v.Idno, fid, err)
+				}
+			}
+
+			if _, err := tx.ExecContext(ctx, varStmt, v.Idno, v.Vid, nullString(fid), v.Name(), v.Label(), nullString(v.Question())); err != nil {
+				return fmt.Errorf("failed to write variable %s/%s: %w", v.Idno, v.Vid, err)
+			}
+
+			cats, stats := v.Categories(), v.SumStats()
+			if len(cats) == 0 && len(stats) == 0 {
+				continue
+			}
+
+			for _, table := range []string{"categories", "statistics"} {
+				if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+where, v.Idno, v.Vid); err != nil {
+					return fmt.Errorf("failed to clear %s of %s/%s: %w", table, v.Idno, v.Vid, err)
+				}
+			}
+
+			for _, c := range cats {
+				var freq sql.NullFloat64
+				freq.Float64, freq.Valid = c.Frequency()
+				if _, err := tx.ExecContext(ctx, catStmt, v.Idno, v.Vid, c.Value, c.Label, freq); err != nil {
+					return fmt.Errorf("failed to write category %s of %s/%s: %w", c.Value, v.Idno, v.Vid, err)
+				}
+			}
+
+			for _, s := range stats {
+				weighted := 0
+				if s.Weighted {
+					weighted = 1
+				}
+				if _, err := tx.ExecContext(ctx, statStmt, v.Idno, v.Vid, s.Type, weighted, s.Value); err != nil {
+					return fmt.Errorf("failed to write statistic %s of %s/%s: %w", s.Type, v.Idno, v.Vid, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (e *SQLExporter) tx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func formatTime(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339), Valid: true}
+}
+
+// nullInt treats zero as unknown, as catalogs leave counts they lack at zero
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,281 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+// recordingDriver is a database/sql driver that records executed statements
+type recordingDriver struct {
+	mu      sync.Mutex
+	execs   []execution
+	commits int
+	fail    string
+}
+
+type execution struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c.d, query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return &recordingTx{c.d}, nil }
+
+type recordingTx struct{ d *recordingDriver }
+
+func (t *recordingTx) Commit() error {
+	t.d.mu.Lock()
+	defer t.d.mu.Unlock()
+	t.d.commits++
+	return nil
+}
+func (t *recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.fail != "" && strings.Contains(s.query, s.d.fail) {
+		return nil, errors.New("constraint failed")
+	}
+	s.d.execs = append(s.d.execs, execution{s.query, args})
+	return driver.RowsAffected(1), nil
+}
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var driverCount int
+
+func openRecording(t *testing.T) (*sql.DB, *recordingDriver) {
+	d := &recordingDriver{}
+	driverCount++
+	name := "recording" + strings.Repeat("_", driverCount)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+func testVariables() []nadago.Variable {
+	return []nadago.Variable{
+		{Idno: "KEN_2021_HFS", Vid: "V1", Data: map[string]interface{}{
+			"vid": "V1", "fid": "F1", "name": "hhid", "labl": "Household identifier",
+			"metadata": map[string]interface{}{
+				"var_sumstat": []interface{}{map[string]interface{}{"type": "vald", "value": "1200", "wgtd": nil}},
+			},
+		}},
+		{Idno: "KEN_2021_HFS", Vid: "V2", Data: map[string]interface{}{
+			"vid": "V2", "fid": "F1", "name": "sex", "labl": "Sex",
+			"metadata": map[string]interface{}{
+				"var_qstn_qstnlit": "What is your sex?",
+				"var_catgry": []interface{}{
+					map[string]interface{}{"value": "1", "labl": "Male", "stats": []interface{}{map[string]interface{}{"type": "freq", "value": "590"}}},
+					map[string]interface{}{"value": "2", "labl": "Female"},
+				},
+			},
+		}},
+	}
+}
+
+func testStudy() nadago.SurveyMeta {
+	return nadago.SurveyMeta{Idno: "KEN_2021_HFS", Data: map[string]interface{}{
+		"title": "HFS 2021", "nation": "Kenya",
+		"metadata": map[string]interface{}{
+			"data_files": []interface{}{
+				map[string]interface{}{"file_id": "F1", "file_name": "hfs_2021", "description": "Household roster", "case_count": float64(1200), "var_count": "2"},
+			},
+		},
+	}}
+}
+
+func TestDialectUpsert(t *testing.T) {
+	cols := []string{"idno", "vid", "label"}
+	keys := []string{"idno", "vid"}
+
+	assert.Equal(t,
+		"INSERT INTO variables (idno, vid, label) VALUES (?, ?, ?) ON CONFLICT (idno, vid) DO UPDATE SET label = excluded.label",
+		SQLite.upsert("variables", cols, keys))
+	assert.Equal(t,
+		"INSERT INTO variables (idno, vid, label) VALUES ($1, $2, $3) ON CONFLICT (idno, vid) DO UPDATE SET label = excluded.label",
+		Postgres.upsert("variables", cols, keys))
+	assert.Equal(t,
+		"INSERT INTO variables (idno, vid, label) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE label = VALUES(label)",
+		MySQL.upsert("variables", cols, keys))
+
+	assert.Equal(t,
+		"INSERT INTO variables (idno, vid, label) VALUES ($1, $2, $3) ON CONFLICT (idno, vid) DO UPDATE SET label = COALESCE(excluded.label, variables.label)",
+		Postgres.upsert("variables", cols, keys, "label"))
+	assert.Equal(t,
+		"INSERT INTO variables (idno, vid, label) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE label = COALESCE(VALUES(label), label)",
+		MySQL.upsert("variables", cols, keys, "label"))
+
+	assert.Equal(t,
+		"INSERT INTO data_files (idno, fid) VALUES ($1, $2) ON CONFLICT (idno, fid) DO NOTHING",
+		Postgres.upsert("data_files", []string{"idno", "fid"}, []string{"idno", "fid"}))
+	assert.Equal(t,
+		"INSERT IGNORE INTO data_files (idno, fid) VALUES (?, ?)",
+		MySQL.upsert("data_files", []string{"idno", "fid"}, []string{"idno", "fid"}))
+}
+
+func TestSQLExporter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("schema", func(t *testing.T) {
+		db, rec := openRecording(t)
+		assert.NoError(t, NewSQLExporter(db, SQLite).CreateSchema(ctx))
+		assert.Len(t, rec.execs, len(Schema))
+		assert.Contains(t, rec.execs[0].query, "CREATE TABLE IF NOT EXISTS studies")
+	})
+
+	t.Run("surveys and study metadata", func(t *testing.T) {
+		db, rec := openRecording(t)
+		e := NewSQLExporter(db, Postgres)
+
+		created := time.Date(2022, 5, 11, 11, 14, 45, 0, time.UTC)
+		err := e.WriteSurveys(ctx, []nadago.Survey{{Idno: "KEN_2021_HFS", Title: "HFS", Nation: "Kenya", Start: 2021, End: 2021, Created: nadago.CatalogTime{Time: created}, Varcount: 2}})
+		assert.NoError(t, err)
+
+		err = e.WriteStudy(ctx, nadago.SurveyMeta{Idno: "KEN_2021_HFS", Data: map[string]interface{}{"title": "HFS 2021", "nation": "Kenya"}})
+		assert.NoError(t, err)
+
+		assert.Len(t, rec.execs, 2)
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "HFS", "Kenya", int64(2021), int64(2021), "2022-05-11T11:14:45Z", nil, "", int64(2)}, rec.execs[0].args)
+		assert.Contains(t, rec.execs[1].query, "ON CONFLICT (idno) DO UPDATE SET title = excluded.title, nation = excluded.nation, abstract = excluded.abstract")
+		assert.Equal(t, 2, rec.commits)
+	})
+
+	t.Run("data files", func(t *testing.T) {
+		db, rec := openRecording(t)
+		assert.NoError(t, NewSQLExporter(db, Postgres).WriteStudy(ctx, testStudy()))
+
+		assert.Len(t, rec.execs, 2)
+		assert.Contains(t, rec.execs[1].query, "INSERT INTO data_files (idno, fid, name, description, case_count, var_count)")
+		assert.Contains(t, rec.execs[1].query, "ON CONFLICT (idno, fid) DO UPDATE SET name = excluded.name")
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "F1", "hfs_2021", "Household roster", int64(1200), int64(2)}, rec.execs[1].args)
+	})
+
+	t.Run("variables with categories and statistics", func(t *testing.T) {
+		db, rec := openRecording(t)
+		e := NewSQLExporter(db, SQLite)
+		assert.NoError(t, e.WriteVariables(ctx, testVariables()))
+
+		var tables []string
+		for _, x := range rec.execs {
+			f := strings.Fields(x.query)
+			if f[0] == "DELETE" {
+				tables = append(tables, "-"+f[2])
+			} else {
+				tables = append(tables, f[2])
+			}
+		}
+		assert.Equal(t, []string{
+			"data_files", "variables", "-categories", "-statistics", "statistics",
+			"variables", "-categories", "-statistics", "categories", "categories",
+		}, tables)
+
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "V2", "F1", "sex", "Sex", "What is your sex?"}, rec.execs[5].args)
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "V2", "1", "Male", float64(590)}, rec.execs[8].args)
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "V2", "2", "Female", nil}, rec.execs[9].args)
+		assert.Equal(t, []driver.Value{"KEN_2021_HFS", "V1", "vald", int64(0), "1200"}, rec.execs[4].args)
+
+		// a second harvest issues the same upserts rather than new rows
+		first := len(rec.execs)
+		assert.NoError(t, e.WriteVariables(ctx, testVariables()))
+		assert.Equal(t, rec.execs[:first], rec.execs[first:])
+	})
+
+	t.Run("errors roll back", func(t *testing.T) {
+		db, rec := openRecording(t)
+		rec.fail = "INSERT INTO categories"
+		err := NewSQLExporter(db, SQLite).WriteVariables(ctx, testVariables())
+		assert.ErrorContains(t, err, "failed to write category 1 of KEN_2021_HFS/V2")
+		assert.Equal(t, 0, rec.commits)
+	})
+}
+
+func TestSQLiteHarvest(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "nada.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	e := NewSQLExporter(db, SQLite)
+	assert.NoError(t, e.CreateSchema(ctx))
+
+	harvest := func() {
+		assert.NoError(t, e.WriteSurveys(ctx, []nadago.Survey{{Idno: "KEN_2021_HFS", Title: "HFS", Nation: "Kenya", Start: 2021, End: 2021, Varcount: 2}}))
+		assert.NoError(t, e.WriteStudy(ctx, testStudy()))
+		assert.NoError(t, e.WriteVariables(ctx, testVariables()))
+	}
+	counts := func() map[string]int {
+		n := map[string]int{}
+		for _, table := range []string{"studies", "data_files", "variables", "categories", "statistics"} {
+			var c int
+			assert.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&c))
+			n[table] = c
+		}
+		return n
+	}
+
+	harvest()
+	first := counts()
+	assert.Equal(t, map[string]int{"studies": 1, "data_files": 1, "variables": 2, "categories": 2, "statistics": 1}, first)
+
+	// a second harvest updates the rows it wrote the first time
+	harvest()
+	assert.Equal(t, first, counts())
+
+	var title, abstract sql.NullString
+	var varcount int
+	assert.NoError(t, db.QueryRowContext(ctx, "SELECT title, abstract, varcount FROM studies").Scan(&title, &abstract, &varcount))
+	assert.Equal(t, "HFS 2021", title.String)
+	assert.Equal(t, 2, varcount)
+
+	var name, description string
+	var cases, vars int
+	assert.NoError(t, db.QueryRowContext(ctx, "SELECT name, description, case_count, var_count FROM data_files WHERE idno = ? AND fid = ?", "KEN_2021_HFS", "F1").
+		Scan(&name, &description, &cases, &vars))
+	assert.Equal(t, []interface{}{"hfs_2021", "Household roster", 1200, 2}, []interface{}{name, description, cases, vars})
+
+	t.Run("variable list rows keep details", func(t *testing.T) {
+		list := nadago.Variables{Idno: "KEN_2021_HFS", Variables: []map[string]interface{}{
+			{"vid": "V1", "fid": "F1", "name": "hhid", "labl": "Household id"},
+			{"vid": "V2", "name": "sex", "labl": "Sex"},
+		}}
+		assert.NoError(t, e.WriteVariables(ctx, list.List()))
+		assert.Equal(t, first, counts())
+
+		var label, question, fid sql.NullString
+		assert.NoError(t, db.QueryRowContext(ctx, "SELECT label, question, fid FROM variables WHERE vid = ?", "V2").Scan(&label, &question, &fid))
+		assert.Equal(t, "Sex", label.String)
+		assert.Equal(t, "What is your sex?", question.String)
+		assert.Equal(t, "F1", fid.String)
+	})
+}
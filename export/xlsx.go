@@ -0,0 +1,225 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	nsMain          = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPackageRels   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	xmlHeader       = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+)
+
+const stylesXML = xmlHeader + `<styleSheet xmlns="` + nsMain + `">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// maxCellLength is the most characters Excel keeps in a cell, counted in
+// UTF-16 code units
+const maxCellLength = 32767
+
+// truncatedMarker ends text cut to fit in a cell
+const truncatedMarker = "… [truncated]"
+
+// decimalPattern matches the plain decimal numbers stored as numeric cells.
+// strconv.ParseFloat also reads NaN, Inf, hex floats and underscores, which
+// Excel does not
+var decimalPattern = regexp.MustCompile(`^-?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+
+// WriteXLSX writes sheets as an Excel workbook, one worksheet per sheet with a
+// bold, frozen header row. Text is stored as inline strings so labels in any
+// script survive without a shared string table, and text longer than an Excel
+// cell holds is truncated with a marker
+func WriteXLSX(w io.Writer, sheets ...Sheet) error {
+	zw := zip.NewWriter(w)
+	names := sheetNames(sheets)
+
+	var types, rels, book bytes.Buffer
+	types.WriteString(xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	rels.WriteString(xmlHeader + `<Relationships xmlns="` + nsPackageRels + `">`)
+	book.WriteString(xmlHeader + `<workbook xmlns="` + nsMain + `" xmlns:r="` + nsRelationships + `"><sheets>`)
+
+	for i, name := range names {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, n, nsRelationships, n)
+		fmt.Fprintf(&book, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), n, n)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/></Relationships>`, len(sheets)+1, nsRelationships)
+	types.WriteString(`</Types>`)
+	book.WriteString(`</sheets></workbook>`)
+
+	parts := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="` + nsPackageRels + `">` +
+			`<Relationship Id="rId1" Type="` + nsRelationships + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", book.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, p := range parts {
+		if err := writePart(zw, p.name, []byte(p.body)); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range sheets {
+		if err := writePart(zw, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(s)); err != nil {
+			return fmt.Errorf("failed to write sheet %s: %w", s.Name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func writePart(zw *zip.Writer, name string, body []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(body)
+	return err
+}
+
+func worksheet(s Sheet) []byte {
+	var b bytes.Buffer
+	b.WriteString(xmlHeader + `<worksheet xmlns="` + nsMain + `">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	b.WriteString(`<sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for j, h := range s.Header {
+		fmt.Fprintf(&b, `<c r="%s1" t="inlineStr" s="1"><is><t xml:space="preserve">%s</t></is></c>`, columnName(j), escape(cellText(h)))
+	}
+	b.WriteString(`</row>`)
+
+	for i, row := range s.Rows {
+		r := i + 2
+		fmt.Fprintf(&b, `<row r="%d">`, r)
+		for j, v := range row {
+			if v == "" {
+				continue
+			}
+			ref := columnName(j) + strconv.Itoa(r)
+			if j < len(s.Header) && s.Numeric[s.Header[j]] && numeric(v) {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, v)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(cellText(v)))
+		}
+		b.WriteString(`</row>`)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.Bytes()
+}
+
+// numeric reports whether v is a finite decimal number
+func numeric(v string) bool {
+	if !decimalPattern.MatchString(v) {
+		return false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return err == nil && !math.IsInf(f, 0)
+}
+
+// cellText cuts s to fit in a cell, ending it with truncatedMarker
+func cellText(s string) string {
+	if len(s) <= maxCellLength || utf16Length(s) <= maxCellLength {
+		return s
+	}
+	limit := maxCellLength - utf16Length(truncatedMarker)
+	n := 0
+	for i, r := range s {
+		n += utf16Length(string(r))
+		if n > limit {
+			return s[:i] + truncatedMarker
+		}
+	}
+	return s
+}
+
+// utf16Length counts s in UTF-16 code units, as Excel does
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++
+		}
+	}
+	return n
+}
+
+// escape escapes XML text, replacing characters XML cannot represent
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// columnName converts a zero based column index to its spreadsheet letters
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// sheetNames makes sheet names acceptable to Excel: at most 31 characters,
+// none of []:*?/\ and unique within the workbook
+func sheetNames(sheets []Sheet) []string {
+	names := make([]string, len(sheets))
+	used := map[string]bool{}
+	for i, s := range sheets {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, s.Name)
+		if name == "" {
+			name = "Sheet" + strconv.Itoa(i+1)
+		}
+		name = truncate(name, 31)
+
+		base := name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = truncate(base, 31-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
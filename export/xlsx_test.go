@@ -0,0 +1,125 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Style  string `xml:"s,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZip(t *testing.T, b []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		body, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		rc.Close()
+		files[f.Name] = body
+	}
+	return files
+}
+
+func TestWriteXLSX(t *testing.T) {
+	sheets := []Sheet{
+		{
+			Name:    "Value labels",
+			Header:  []string{"value", "label", "frequency"},
+			Rows:    [][]string{{"1", "Ménage <rural> & urbain", "590"}, {"2", "家庭", ""}, {"3", "n/a", "unknown"}},
+			Numeric: map[string]bool{"frequency": true},
+		},
+		{Name: "Study info", Header: []string{"field", "value"}},
+		{Name: "Study info", Header: []string{"field"}},
+		{Name: "A very long sheet name: with [invalid] characters"},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteXLSX(&buf, sheets...))
+	files := readZip(t, buf.Bytes())
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet4.xml"} {
+		assert.Contains(t, files, name)
+	}
+
+	var book struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	assert.NoError(t, xml.Unmarshal(files["xl/workbook.xml"], &book))
+	assert.Equal(t, "Value labels", book.Sheets[0].Name)
+	assert.Equal(t, "Study info", book.Sheets[1].Name)
+	assert.Equal(t, "Study info (2)", book.Sheets[2].Name)
+	assert.Equal(t, "A very long sheet name_ with _i", book.Sheets[3].Name)
+
+	var ws xlsxSheet
+	assert.NoError(t, xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &ws))
+	assert.Len(t, ws.Rows, 4)
+
+	header := ws.Rows[0].Cells
+	assert.Equal(t, "C1", header[2].Ref)
+	assert.Equal(t, "frequency", header[2].Inline)
+	assert.Equal(t, "1", header[2].Style)
+
+	row := ws.Rows[1].Cells
+	assert.Equal(t, "Ménage <rural> & urbain", row[1].Inline)
+	assert.Equal(t, "", row[2].Type)
+	assert.Equal(t, "590", row[2].Value)
+
+	// empty cells are omitted and non-numeric values stay text
+	assert.Len(t, ws.Rows[2].Cells, 2)
+	assert.Equal(t, "家庭", ws.Rows[2].Cells[1].Inline)
+	assert.Equal(t, "inlineStr", ws.Rows[3].Cells[2].Type)
+	assert.Equal(t, "unknown", ws.Rows[3].Cells[2].Inline)
+}
+
+func TestCells(t *testing.T) {
+	for v, want := range map[string]bool{
+		"590": true, "-1.5": true, ".5": true, "2.": true, "1e3": true, "6.02E+23": true,
+		"NaN": false, "Inf": false, "-Infinity": false, "0x1p-2": false, "1_000": false,
+		"+1": false, "1e999": false, "": false, " 1": false,
+	} {
+		assert.Equal(t, want, numeric(v), v)
+	}
+
+	short := strings.Repeat("a", maxCellLength)
+	assert.Equal(t, short, cellText(short))
+
+	long := cellText(strings.Repeat("ab", maxCellLength))
+	assert.Equal(t, maxCellLength, utf16Length(long))
+	assert.True(t, strings.HasSuffix(long, truncatedMarker))
+
+	// characters outside the basic plane count twice
+	emoji := cellText(strings.Repeat("😀", maxCellLength/2+1))
+	assert.LessOrEqual(t, utf16Length(emoji), maxCellLength)
+	assert.True(t, strings.HasSuffix(emoji, "😀"+truncatedMarker))
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, "A", columnName(0))
+	assert.Equal(t, "Z", columnName(25))
+	assert.Equal(t, "AA", columnName(26))
+	assert.Equal(t, "AZ", columnName(51))
+	assert.Equal(t, "ZZ", columnName(701))
+	assert.Equal(t, "AAA", columnName(702))
+}
@@ -0,0 +1,128 @@
+package nadago
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStudyExport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ALB_2019_LFS_v01_M/ddi":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(expectedDDIResponse))
+		case "/ALB_2019_LFS_v01_M/json":
+			w.Write([]byte(`{"idno":"ALB_2019_LFS_v01_M"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	ctx := context.Background()
+
+	t.Run("streams json export", func(t *testing.T) {
+		body, err := client.GetStudyExport(ctx, "ALB_2019_LFS_v01_M", ExportJSON)
+		assert.NoError(t, err)
+		defer body.Close()
+
+		b, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"idno":"ALB_2019_LFS_v01_M"}`, string(b))
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := client.GetStudyExport(ctx, "ALB_2019_LFS_v01_M", ExportFormat("pdf"))
+		assert.IsType(t, AppErr{}, err)
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		_, err := client.GetStudyExport(ctx, "missing", ExportDDI)
+		assert.Equal(t, FetchErr{
+			Message:    "non-200 status code from the API",
+			StatusCode: 404,
+		}, err)
+	})
+
+	t.Run("parses ddi export", func(t *testing.T) {
+		meta, vars, err := client.GetStudyDDI(ctx, "ALB_2019_LFS_v01_M")
+		assert.NoError(t, err)
+		assert.Equal(t, "ALB_2019_LFS_v01_M", meta.Idno)
+
+		data := meta.Data.(map[string]interface{})
+		assert.Equal(t, "Labour Force Survey 2019", data["title"])
+		assert.Equal(t, "Albania", data["nation"])
+		assert.Equal(t, "2019", data["year_start"])
+		assert.Equal(t, "2019", data["year_end"])
+
+		assert.Len(t, vars, 2)
+		assert.Equal(t, "V1", vars[0].Vid)
+		assert.Equal(t, "ALB_2019_LFS_v01_M", vars[0].Idno)
+
+		v := vars[1].Data.(map[string]interface{})
+		assert.Equal(t, "sex", v["name"])
+		assert.Equal(t, "Sex of respondent", v["labl"])
+		assert.Equal(t, "F1", v["fid"])
+		assert.Equal(t, "What is your sex?", v["qstn"])
+
+		md := v["metadata"].(map[string]interface{})
+		cats := md["var_catgry"].([]interface{})
+		assert.Len(t, cats, 2)
+		assert.Equal(t, "Female", cats[1].(map[string]interface{})["labl"])
+	})
+
+	t.Run("invalid xml", func(t *testing.T) {
+		_, _, err := ParseDDI(strings.NewReader("<codeBook><stdyDscr>"))
+		assert.Error(t, err)
+	})
+}
+
+var expectedDDIResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<codeBook xmlns="ddi:codebook:2_5" ID="ALB_2019_LFS_v01_M" version="2.5">
+  <stdyDscr>
+    <citation>
+      <titlStmt>
+        <titl>Labour Force Survey 2019</titl>
+        <IDNo>ALB_2019_LFS_v01_M</IDNo>
+      </titlStmt>
+    </citation>
+    <stdyInfo>
+      <abstract>Quarterly labour force survey.</abstract>
+      <sumDscr>
+        <collDate event="start" date="2019-01-01"/>
+        <collDate event="end" date="2019-12-31"/>
+        <nation abbr="ALB">Albania</nation>
+        <anlyUnit>Individual</anlyUnit>
+      </sumDscr>
+    </stdyInfo>
+    <method>
+      <dataColl>
+        <sampProc>Two stage stratified sample.</sampProc>
+      </dataColl>
+    </method>
+  </stdyDscr>
+  <fileDscr ID="F1">
+    <fileTxt>
+      <fileName>lfs_2019.dta</fileName>
+    </fileTxt>
+  </fileDscr>
+  <dataDscr>
+    <var ID="V1" name="hhid" files="F1" intrvl="contin">
+      <labl>Household identifier</labl>
+      <sumStat type="vald">1200</sumStat>
+    </var>
+    <var ID="V2" name="sex" files="F1" intrvl="discrete">
+      <labl>Sex of respondent</labl>
+      <qstn><qstnLit>What is your sex?</qstnLit></qstn>
+      <catgry><catValu>1</catValu><labl>Male</labl><catStat type="freq">590</catStat></catgry>
+      <catgry><catValu>2</catValu><labl>Female</labl><catStat type="freq">610</catStat></catgry>
+    </var>
+  </dataDscr>
+</codeBook>`
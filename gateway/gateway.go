@@ -0,0 +1,306 @@
+// Package gateway serves a REST API in front of one or more NADA catalogs, so
+// applications can share a single cached and rate limited set of clients.
+//
+// Routes, all answered with a JSON envelope of data and meta, or error:
+//
+//	GET /healthz                                           liveness
+//	GET /readyz                                            reachability of every catalog
+//	GET /catalogs                                          configured catalog names
+//	GET /catalogs/{catalog}/search?{query}                 search, see nadago.ParseQuery
+//	GET /catalogs/{catalog}/studies/{idno}                 study metadata
+//	GET /catalogs/{catalog}/studies/{idno}/variables       variable list
+//	GET /catalogs/{catalog}/studies/{idno}/variables/{vid} variable metadata
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/northeastloon/nadago"
+)
+
+type Server struct {
+	catalogs     map[string]*nadago.Client
+	names        []string
+	origins      map[string]bool
+	readyTimeout time.Duration
+}
+
+type Option func(s *Server)
+
+// WithAllowedOrigins sets the origins allowed to call the API from a browser.
+// The default "*" allows any origin
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *Server) {
+		s.origins = map[string]bool{}
+		for _, o := range origins {
+			s.origins[o] = true
+		}
+	}
+}
+
+// WithReadyTimeout bounds how long /readyz waits for each catalog. The default
+// is five seconds
+func WithReadyTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.readyTimeout = d
+	}
+}
+
+// New creates a server for catalogs keyed by the name used in request paths.
+// Caching and rate limiting are configured on the clients
+func New(catalogs map[string]*nadago.Client, opts ...Option) *Server {
+	s := &Server{
+		catalogs:     catalogs,
+		origins:      map[string]bool{"*": true},
+		readyTimeout: 5 * time.Second,
+	}
+	for name := range catalogs {
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+type envelope struct {
+	Data  interface{} `json:"data,omitempty"`
+	Meta  interface{} `json:"meta,omitempty"`
+	Error *apiError   `json:"error,omitempty"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type searchMeta struct {
+	Catalog  string `json:"catalog"`
+	Count    int    `json:"count"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+type catalogMeta struct {
+	Catalog string `json:"catalog"`
+}
+
+type study struct {
+	Idno    string      `json:"idno"`
+	Dataset interface{} `json:"dataset"`
+}
+
+type variableList struct {
+	Idno      string                   `json:"idno"`
+	Variables []map[string]interface{} `json:"variables"`
+}
+
+type variable struct {
+	Idno     string      `json:"idno"`
+	Vid      string      `json:"vid"`
+	Variable interface{} `json:"variable"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.cors(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "healthz":
+		writeJSON(w, http.StatusOK, envelope{Data: map[string]string{"status": "ok"}})
+	case len(parts) == 1 && parts[0] == "readyz":
+		s.ready(w, r)
+	case len(parts) == 1 && parts[0] == "catalogs":
+		writeJSON(w, http.StatusOK, envelope{Data: s.names})
+	case len(parts) >= 3 && parts[0] == "catalogs":
+		client, ok := s.catalogs[parts[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("unknown catalog %s", parts[1]))
+			return
+		}
+		s.catalog(w, r, parts[1], client, parts[2:])
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// idPattern matches the study idnos and variable ids accepted in paths, so
+// that they cannot change the path or query of requests to the catalog
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+func validID(id string) bool {
+	return idPattern.MatchString(id) && strings.Trim(id, ".") != ""
+}
+
+func (s *Server) catalog(w http.ResponseWriter, r *http.Request, name string, c *nadago.Client, parts []string) {
+	ctx := r.Context()
+	meta := catalogMeta{Catalog: name}
+
+	if len(parts) >= 2 && parts[0] == "studies" && !validID(parts[1]) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid idno %q", parts[1]))
+		return
+	}
+	if len(parts) == 4 && parts[0] == "studies" && !validID(parts[3]) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid vid %q", parts[3]))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "search":
+		q, err := nadago.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		params, err := q.Params()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		surveys, err := c.Search(ctx, params)
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, envelope{
+			Data: surveys,
+			Meta: searchMeta{Catalog: name, Count: len(surveys), Page: params.Page, PageSize: params.Ps},
+		})
+
+	case len(parts) == 2 && parts[0] == "studies":
+		m, err := c.GetSurveyMeta(ctx, parts[1])
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, envelope{Data: study{Idno: m.Idno, Dataset: m.Data}, Meta: meta})
+
+	case len(parts) == 3 && parts[0] == "studies" && parts[2] == "variables":
+		vars, err := c.GetSurveyVars(ctx, parts[1])
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, envelope{Data: variableList{Idno: vars.Idno, Variables: vars.Variables}, Meta: meta})
+
+	case len(parts) == 4 && parts[0] == "studies" && parts[2] == "variables":
+		v, err := c.GetVarMeta(ctx, parts[1], parts[3])
+		if err != nil {
+			writeClientError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, envelope{Data: variable{Idno: v.Idno, Vid: v.Vid, Variable: v.Data}, Meta: meta})
+
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// ready searches every catalog for a single study in parallel, skipping the
+// cache so a catalog that is down is reported as such
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	statuses := make(map[string]string, len(s.names))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, name := range s.names {
+		wg.Add(1)
+		go func(name string, c *nadago.Client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(nadago.WithoutCache(r.Context()), s.readyTimeout)
+			defer cancel()
+
+			params := nadago.NewDefaultSearchParams()
+			params.Ps = 1
+			status := "ok"
+			if _, err := c.Search(ctx, params); err != nil {
+				status = err.Error()
+			}
+
+			mu.Lock()
+			statuses[name] = status
+			mu.Unlock()
+		}(name, s.catalogs[name])
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, status := range statuses {
+		if status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, envelope{Data: statuses})
+}
+
+func (s *Server) cors(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	switch {
+	case s.origins["*"]:
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case origin != "" && s.origins[origin]:
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	default:
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+	}
+}
+
+// writeClientError maps client errors to gateway statuses. Missing studies keep
+// their 404, catalogs behind an open circuit breaker are 503 and other
+// upstream failures become 502
+func writeClientError(w http.ResponseWriter, err error) {
+	var fetchErr nadago.FetchErr
+	var validationErr nadago.ValidationErr
+	var openErr nadago.ErrCircuitOpen
+
+	status := http.StatusBadGateway
+	switch {
+	case errors.As(err, &validationErr):
+		status = http.StatusBadRequest
+	case errors.As(err, &fetchErr) && fetchErr.StatusCode == http.StatusNotFound:
+		status = http.StatusNotFound
+	case errors.As(err, &openErr):
+		status = http.StatusServiceUnavailable
+		if wait := time.Until(openErr.Until); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second)/time.Second)))
+		}
+	}
+	writeError(w, status, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, envelope{Error: &apiError{Status: status, Message: message}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body envelope) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,208 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+)
+
+const searchResponse = `{"result":{"rows":[{"idno":"ALB_2019_LFS_v01_M","title":"Labour Force Survey 2019","nation":"Albania","year_start":2019,"year_end":2019,"created":"2022-05-11T11:14:45+00:00","changed":"2022-05-11T11:14:46+00:00","varcount":85}]}}`
+
+// fakeCatalog answers the consumer API endpoints used by the gateway
+type fakeCatalog struct {
+	hits  int32
+	query string
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.hits, 1)
+	switch r.URL.Path {
+	case "/search":
+		f.query = r.URL.RawQuery
+		w.Write([]byte(searchResponse))
+	case "/ALB_2019_LFS_v01_M":
+		w.Write([]byte(`{"dataset":{"idno":"ALB_2019_LFS_v01_M","title":"Labour Force Survey 2019"}}`))
+	case "/ALB_2019_LFS_v01_M/variables":
+		w.Write([]byte(`{"variables":[{"vid":"V1","name":"age","labl":"Age"}]}`))
+	case "/ALB_2019_LFS_v01_M/variables/V1":
+		w.Write([]byte(`{"variable":{"vid":"V1","name":"age","labl":"Age"}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+type response struct {
+	Data  json.RawMessage        `json:"data"`
+	Meta  map[string]interface{} `json:"meta"`
+	Error *apiError              `json:"error"`
+}
+
+func get(t *testing.T, h http.Handler, path string) (*httptest.ResponseRecorder, response) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	var resp response
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+	return rec, resp
+}
+
+func newTestServer(t *testing.T, opts ...Option) (*Server, *fakeCatalog) {
+	catalog := &fakeCatalog{}
+	ts := httptest.NewServer(catalog)
+	t.Cleanup(ts.Close)
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(down.Close)
+
+	return New(map[string]*nadago.Client{
+		"ihsn": nadago.NewClient(ts.URL, nadago.WithCache(time.Minute, 100)),
+		"down": nadago.NewClient(down.URL),
+	}, opts...), catalog
+}
+
+func TestServer(t *testing.T) {
+	s, catalog := newTestServer(t)
+
+	t.Run("health", func(t *testing.T) {
+		rec, resp := get(t, s, "/healthz")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, string(resp.Data))
+
+		rec, resp = get(t, s, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		var statuses map[string]string
+		assert.NoError(t, json.Unmarshal(resp.Data, &statuses))
+		assert.Equal(t, "ok", statuses["ihsn"])
+		assert.Contains(t, statuses["down"], "statuscode: 500")
+
+		// readiness is never answered from the cache
+		before := atomic.LoadInt32(&catalog.hits)
+		get(t, s, "/readyz")
+		assert.Equal(t, before+1, atomic.LoadInt32(&catalog.hits))
+	})
+
+	t.Run("catalogs", func(t *testing.T) {
+		_, resp := get(t, s, "/catalogs")
+		assert.JSONEq(t, `["down","ihsn"]`, string(resp.Data))
+	})
+
+	t.Run("search", func(t *testing.T) {
+		rec, resp := get(t, s, "/catalogs/ihsn/search?all=labour&country=ALB&ps=5")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, catalog.query, "country=ALB")
+		assert.Contains(t, catalog.query, "ps=5")
+
+		var surveys []nadago.Survey
+		assert.NoError(t, json.Unmarshal(resp.Data, &surveys))
+		assert.Equal(t, "ALB_2019_LFS_v01_M", surveys[0].Idno)
+		assert.Equal(t, map[string]interface{}{"catalog": "ihsn", "count": float64(1), "page": float64(1), "page_size": float64(5)}, resp.Meta)
+
+		rec, resp = get(t, s, "/catalogs/ihsn/search?ps=1000")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, http.StatusBadRequest, resp.Error.Status)
+
+		rec, _ = get(t, s, "/catalogs/ihsn/search?bogus=1")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("study and variables", func(t *testing.T) {
+		_, resp := get(t, s, "/catalogs/ihsn/studies/ALB_2019_LFS_v01_M")
+		assert.JSONEq(t, `{"idno":"ALB_2019_LFS_v01_M","dataset":{"idno":"ALB_2019_LFS_v01_M","title":"Labour Force Survey 2019"}}`, string(resp.Data))
+		assert.Equal(t, "ihsn", resp.Meta["catalog"])
+
+		_, resp = get(t, s, "/catalogs/ihsn/studies/ALB_2019_LFS_v01_M/variables")
+		assert.JSONEq(t, `{"idno":"ALB_2019_LFS_v01_M","variables":[{"vid":"V1","name":"age","labl":"Age"}]}`, string(resp.Data))
+
+		_, resp = get(t, s, "/catalogs/ihsn/studies/ALB_2019_LFS_v01_M/variables/V1")
+		assert.JSONEq(t, `{"idno":"ALB_2019_LFS_v01_M","vid":"V1","variable":{"vid":"V1","name":"age","labl":"Age"}}`, string(resp.Data))
+
+		// served from the client cache
+		before := atomic.LoadInt32(&catalog.hits)
+		get(t, s, "/catalogs/ihsn/studies/ALB_2019_LFS_v01_M/variables/V1")
+		assert.Equal(t, before, atomic.LoadInt32(&catalog.hits))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		rec, resp := get(t, s, "/catalogs/ihsn/studies/MISSING")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, http.StatusNotFound, resp.Error.Status)
+
+		rec, _ = get(t, s, "/catalogs/down/studies/ALB_2019_LFS_v01_M")
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer down.Close()
+		broken := New(map[string]*nadago.Client{
+			"down": nadago.NewClient(down.URL, nadago.WithCircuitBreaker(nadago.BreakerConfig{ConsecutiveFailures: 1, OpenFor: time.Minute})),
+		})
+		rec, _ = get(t, broken, "/catalogs/down/studies/ALB_2019_LFS_v01_M")
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		rec, _ = get(t, broken, "/catalogs/down/studies/ALB_2019_LFS_v01_M")
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+		rec, resp = get(t, s, "/catalogs/nope/search")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "unknown catalog nope", resp.Error.Message)
+
+		before := atomic.LoadInt32(&catalog.hits)
+		for _, path := range []string{
+			"/catalogs/ihsn/studies/ALB%3Fformat=xml",
+			"/catalogs/ihsn/studies/..",
+			"/catalogs/ihsn/studies/ALB_2019_LFS_v01_M/variables/V1%23x",
+		} {
+			rec, resp = get(t, s, path)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+			assert.Contains(t, resp.Error.Message, "invalid")
+		}
+		assert.Equal(t, before, atomic.LoadInt32(&catalog.hits))
+
+		rec, _ = get(t, s, "/catalogs/ihsn/unknown/route")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		post := httptest.NewRecorder()
+		s.ServeHTTP(post, httptest.NewRequest(http.MethodPost, "/catalogs", strings.NewReader("{}")))
+		assert.Equal(t, http.StatusMethodNotAllowed, post.Code)
+		assert.Equal(t, "GET, HEAD, OPTIONS", post.Header().Get("Allow"))
+	})
+}
+
+func TestCORS(t *testing.T) {
+	t.Run("any origin", func(t *testing.T) {
+		s, _ := newTestServer(t)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodOptions, "/catalogs", nil)
+		req.Header.Set("Origin", "https://example.org")
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "*", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, HEAD, OPTIONS", rec.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("listed origins", func(t *testing.T) {
+		s, _ := newTestServer(t, WithAllowedOrigins("https://apps.example.org"))
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set("Origin", "https://apps.example.org")
+		s.ServeHTTP(rec, req)
+		assert.Equal(t, "https://apps.example.org", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+		rec = httptest.NewRecorder()
+		req.Header.Set("Origin", "https://evil.example.com")
+		s.ServeHTTP(rec, req)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
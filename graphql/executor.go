@@ -0,0 +1,388 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// Error is a GraphQL error. Path locates the field that failed in the result
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+func (e Error) Error() string {
+	return e.Message
+}
+
+// orderedMap is a result object, marshalled with its fields in query order
+type orderedMap []entry
+
+type entry struct {
+	key   string
+	value interface{}
+}
+
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, e := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type executor struct {
+	loader *loader
+	vars   map[string]interface{}
+
+	mu     sync.Mutex
+	errors []Error
+}
+
+// operation selects the operation to run, by name when the document has more
+// than one
+func (d *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, Error{Message: "operationName is required when the document has several operations"}
+		}
+		return d.Operations[0], nil
+	}
+	for _, op := range d.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+// variables coerces the request variables to the types declared by the
+// operation, applying defaults
+func (op *Operation) variables(given map[string]interface{}) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	for _, def := range op.Variables {
+		v, ok := given[def.Name]
+		if !ok {
+			v = def.Default
+		}
+		coerced, err := coerce(v, def.Type)
+		if err != nil {
+			return nil, Error{Message: fmt.Sprintf("variable $%s: %s", def.Name, err)}
+		}
+		vars[def.Name] = coerced
+	}
+	return vars, nil
+}
+
+// validate checks the selections against the schema before anything is fetched
+func (op *Operation) validate() []Error {
+	declared := map[string]bool{}
+	for _, def := range op.Variables {
+		declared[def.Name] = true
+	}
+	return validateSelection("Query", op.Selection, declared, nil)
+}
+
+func validateSelection(typeName string, fields []*Field, declared map[string]bool, path []interface{}) []Error {
+	var errs []Error
+	seen := map[string]bool{}
+	for _, f := range fields {
+		fieldPath := appendPath(path, f.ResponseKey())
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, Error{Message: fmt.Sprintf(format, args...), Path: fieldPath})
+		}
+
+		if seen[f.ResponseKey()] {
+			fail("duplicate field %q, use an alias", f.ResponseKey())
+			continue
+		}
+		seen[f.ResponseKey()] = true
+
+		for _, d := range f.Directives {
+			if d.Name != "include" && d.Name != "skip" {
+				fail("unknown directive @%s", d.Name)
+			}
+			if _, ok := d.Arguments["if"]; !ok || len(d.Arguments) != 1 {
+				fail("@%s takes a single if argument", d.Name)
+			}
+			errs = append(errs, undeclared(d.Arguments, declared, fieldPath)...)
+		}
+
+		if f.Name == "__typename" {
+			if f.Selection != nil || len(f.Arguments) > 0 {
+				fail("__typename takes no arguments or selections")
+			}
+			continue
+		}
+		def, ok := types[typeName][f.Name]
+		if !ok {
+			fail("cannot query field %q on type %s", f.Name, typeName)
+			continue
+		}
+
+		for name, v := range f.Arguments {
+			typ, ok := def.args[name]
+			if !ok {
+				fail("unknown argument %q on field %s.%s", name, typeName, f.Name)
+				continue
+			}
+			if _, err := coerce(v, typ); err != nil && !hasVariable(v) {
+				fail("argument %q: %s", name, err)
+			}
+		}
+		for name, typ := range def.args {
+			if strings.HasSuffix(typ, "!") && f.Arguments[name] == nil {
+				fail("argument %q of type %s is required on field %s.%s", name, typ, typeName, f.Name)
+			}
+		}
+		errs = append(errs, undeclared(f.Arguments, declared, fieldPath)...)
+
+		elem := elemType(def.typ)
+		switch {
+		case scalars[elem] && f.Selection != nil:
+			fail("field %q of type %s cannot have a selection", f.Name, def.typ)
+		case !scalars[elem] && f.Selection == nil:
+			fail("field %q of type %s must have a selection", f.Name, def.typ)
+		case !scalars[elem]:
+			errs = append(errs, validateSelection(elem, f.Selection, declared, fieldPath)...)
+		}
+	}
+	return errs
+}
+
+func undeclared(args map[string]interface{}, declared map[string]bool, path []interface{}) []Error {
+	var errs []Error
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case Variable:
+			if !declared[string(v)] {
+				errs = append(errs, Error{Message: fmt.Sprintf("variable $%s is not declared", v), Path: path})
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	for _, v := range args {
+		walk(v)
+	}
+	return errs
+}
+
+// hasVariable reports whether a value refers to variables, so can only be
+// coerced once they are known
+func hasVariable(v interface{}) bool {
+	switch v := v.(type) {
+	case Variable:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if hasVariable(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selection resolves the fields of an object concurrently
+func (e *executor) selection(ctx context.Context, typeName string, source interface{}, fields []*Field, path []interface{}) orderedMap {
+	var selected []*Field
+	for _, f := range fields {
+		if e.included(f) {
+			selected = append(selected, f)
+		}
+	}
+
+	out := make(orderedMap, len(selected))
+	var wg sync.WaitGroup
+	for i, f := range selected {
+		out[i].key = f.ResponseKey()
+		if f.Name == "__typename" {
+			out[i].value = typeName
+			continue
+		}
+		wg.Add(1)
+		go func(i int, f *Field) {
+			defer wg.Done()
+			out[i].value = e.field(ctx, typeName, source, f, appendPath(path, f.ResponseKey()))
+		}(i, f)
+	}
+	wg.Wait()
+	return out
+}
+
+func (e *executor) included(f *Field) bool {
+	for _, d := range f.Directives {
+		cond, _ := e.resolve(d.Arguments["if"]).(bool)
+		if d.Name == "include" && !cond || d.Name == "skip" && cond {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) field(ctx context.Context, typeName string, source interface{}, f *Field, path []interface{}) interface{} {
+	def := types[typeName][f.Name]
+
+	args := map[string]interface{}{}
+	for name, typ := range def.args {
+		v, err := coerce(e.resolve(f.Arguments[name]), typ)
+		if err != nil {
+			e.fail(fmt.Errorf("argument %q: %w", name, err), path)
+			return nil
+		}
+		if v != nil {
+			args[name] = v
+		}
+	}
+
+	v, err := def.resolve(ctx, e.loader, source, args)
+	if err != nil {
+		e.fail(err, path)
+		return nil
+	}
+	return e.complete(ctx, def.typ, v, f, path)
+}
+
+// complete shapes a resolved value to its type, resolving the selections of
+// objects and the items of lists concurrently
+func (e *executor) complete(ctx context.Context, typ string, v interface{}, f *Field, path []interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if scalars[typ] {
+		return v
+	}
+	if !strings.HasPrefix(typ, "[") {
+		return e.selection(ctx, typ, v, f.Selection, path)
+	}
+
+	items := v.([]interface{})
+	out := make([]interface{}, len(items))
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			out[i] = e.complete(ctx, elemType(typ), item, f, appendPath(path, i))
+		}(i, item)
+	}
+	wg.Wait()
+	return out
+}
+
+// resolve replaces variable references in an argument value
+func (e *executor) resolve(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Variable:
+		return e.vars[string(v)]
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = e.resolve(item)
+		}
+		return out
+	}
+	return v
+}
+
+func (e *executor) fail(err error, path []interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errors = append(e.errors, Error{Message: err.Error(), Path: path})
+}
+
+// coerce converts an input value to a scalar or list type. JSON numbers are
+// accepted as Int when integral and single values as lists of one
+func coerce(v interface{}, typ string) (interface{}, error) {
+	required := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if v == nil {
+		if required {
+			return nil, fmt.Errorf("expected %s!, found null", typ)
+		}
+		return nil, nil
+	}
+
+	if strings.HasPrefix(typ, "[") {
+		elem := typ[1 : len(typ)-1]
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			c, err := coerce(item, elem)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+
+	switch typ {
+	case "String":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case "Int":
+		switch n := v.(type) {
+		case int:
+			return n, nil
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) <= math.MaxInt32 {
+				return int(n), nil
+			}
+		}
+	case "Float":
+		switch n := v.(type) {
+		case int:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %s", typ)
+	}
+	return nil, fmt.Errorf("expected %s, found %v", typ, v)
+}
+
+// elemType strips list brackets and non-null markers from a type
+func elemType(typ string) string {
+	return strings.Trim(typ, "[]!")
+}
+
+func appendPath(path []interface{}, key interface{}) []interface{} {
+	p := make([]interface{}, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, key)
+}
@@ -0,0 +1,146 @@
+// Package graphql serves a GraphQL API over a catalog, so clients can fetch a
+// study, its data files and selected variables in one round trip. See Schema
+// for the types and fields.
+//
+// Each request gets its own loader: studies, variable lists and variables
+// requested several times are fetched once, and the GetVarMeta calls needed
+// for a list of variables are made concurrently, bounded by WithConcurrency.
+// WithMaxVariables caps the number of those calls a single request can make.
+// Queries, variables, aliases and the @include and @skip directives are
+// supported; fragments, mutations and introspection are not.
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+)
+
+type Handler struct {
+	client       *nadago.Client
+	concurrency  int
+	maxBody      int64
+	maxVariables int
+}
+
+type Option func(h *Handler)
+
+// WithConcurrency sets how many catalog requests a query makes at once. The
+// default is 8
+func WithConcurrency(n int) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.concurrency = n
+		}
+	}
+}
+
+// WithMaxVariables limits how many variables a query may fetch the full
+// metadata of, each needing its own GetVarMeta call. Fields of variables past
+// the limit are null with an error. The default is 1000
+func WithMaxVariables(n int) Option {
+	return func(h *Handler) {
+		if n > 0 {
+			h.maxVariables = n
+		}
+	}
+}
+
+// WithMaxBodySize limits the size of POST bodies. The default is 1MB
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBody = n
+	}
+}
+
+func NewHandler(c *nadago.Client, opts ...Option) *Handler {
+	h := &Handler{client: c, concurrency: 8, maxBody: 1 << 20, maxVariables: 1000}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Response holds the result of a request. Data is nil when the request could
+// not be parsed or validated
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// Execute runs a request. Errors of individual fields are reported in the
+// response alongside the data that could be resolved
+func (h *Handler) Execute(ctx context.Context, req Request) Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{err.(Error)}}
+	}
+	if errs := op.validate(); len(errs) > 0 {
+		return Response{Errors: errs}
+	}
+	vars, err := op.variables(req.Variables)
+	if err != nil {
+		return Response{Errors: []Error{err.(Error)}}
+	}
+
+	e := &executor{loader: newLoader(h.client, h.concurrency, h.maxVariables), vars: vars}
+	data := e.selection(ctx, "Query", nil, op.Selection, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+// ServeHTTP accepts POST requests with a JSON body and GET requests with
+// query, variables and operationName parameters
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	switch r.Method {
+	case http.MethodPost:
+		if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+			writeJSON(w, http.StatusUnsupportedMediaType, Response{Errors: []Error{{Message: "content type must be application/json"}}})
+			return
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBody)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Errors: []Error{{Message: "invalid request body: " + err.Error()}}})
+			return
+		}
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeJSON(w, http.StatusBadRequest, Response{Errors: []Error{{Message: "invalid variables: " + err.Error()}}})
+				return
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, Response{Errors: []Error{{Message: "method not allowed"}}})
+		return
+	}
+
+	resp := h.Execute(r.Context(), req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
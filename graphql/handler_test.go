@@ -0,0 +1,235 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+)
+
+var catalogResponses = map[string]string{
+	"/search": `{"result":{"rows":[{"idno":"KEN_2021_HFS","title":"High Frequency Survey 2021","nation":"Kenya","year_start":2021,"year_end":2021,"created":"2022-05-11T11:14:45+00:00","changed":"2022-05-11T11:14:46+00:00","varcount":3}]}}`,
+	"/KEN_2021_HFS": `{"dataset":{"idno":"KEN_2021_HFS","title":"High Frequency Survey 2021","nation":"Kenya","created":"2022-05-03 12:46:00","changed":"","metadata":{"data_files":[
+		{"file_id":"F1","file_name":"household","description":"Household roster","case_count":1200,"var_count":2},
+		{"file_id":"F2","file_name":"individual","case_count":"3400","var_count":"1"}]}}}`,
+	"/KEN_2021_HFS/variables": `{"variables":[
+		{"vid":"V1","name":"hhid","labl":"Household id","fid":"F1"},
+		{"vid":"V2","name":"sex","labl":"Sex of respondent","fid":"F1"},
+		{"vid":"V3","name":"age","labl":"Age","fid":"F2"}]}`,
+	"/KEN_2021_HFS/variables/V1": `{"variable":{"vid":"V1","name":"hhid","labl":"Household id","fid":"F1","metadata":{}}}`,
+	"/KEN_2021_HFS/variables/V2": `{"variable":{"vid":"V2","name":"sex","labl":"Sex of respondent","fid":"F1","metadata":{
+		"var_qstn_qstnlit":"What is your sex?",
+		"var_catgry":[{"value":"1","labl":"Male","stats":[{"type":"freq","value":"590"}]},{"value":"2","labl":"Female"}]}}}`,
+	"/KEN_2021_HFS/variables/V3": `{"variable":{"vid":"V3","name":"age","labl":"Age","fid":"F2","metadata":{"var_qstn_qstnlit":"How old are you?"}}}`,
+	"/NGA_2020_HFS":              `{"dataset":{"idno":"NGA_2020_HFS","title":"High Frequency Survey 2020"}}`,
+	"/NGA_2020_HFS/variables":    `{"variables":[{"vid":"V1","name":"hhid","fid":"F9"},{"vid":"V2","name":"state","fid":"F9"}]}`,
+}
+
+// fakeCatalog serves catalogResponses, counting hits per path and the most
+// requests in flight at once
+type fakeCatalog struct {
+	mu       sync.Mutex
+	hits     map[string]int
+	inFlight int
+	peak     int
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.hits[r.URL.Path]++
+	f.inFlight++
+	if f.inFlight > f.peak {
+		f.peak = f.inFlight
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	body, ok := catalogResponses[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(body))
+}
+
+func newTestHandler(t *testing.T, opts ...Option) (*Handler, *fakeCatalog) {
+	catalog := &fakeCatalog{hits: map[string]int{}}
+	ts := httptest.NewServer(catalog)
+	t.Cleanup(ts.Close)
+	return NewHandler(nadago.NewClient(ts.URL), opts...), catalog
+}
+
+func post(t *testing.T, h http.Handler, body string) (*httptest.ResponseRecorder, string) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, req)
+	return rec, rec.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	t.Run("study with data files and variables", func(t *testing.T) {
+		h, catalog := newTestHandler(t)
+		query, _ := json.Marshal(Request{
+			Query: `query Study($idno: String!) {
+				study(idno: $idno) {
+					title
+					dataFiles { id name caseCount variables { name } }
+					variables(names: ["sex", "age"]) {
+						vid name question
+						categories { value label frequency }
+					}
+				}
+				sex: variable(idno: $idno, vid: "V2") { label question }
+			}`,
+			Variables: map[string]interface{}{"idno": "KEN_2021_HFS"},
+		})
+
+		rec, body := post(t, h, string(query))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"data":{
+			"study":{
+				"title":"High Frequency Survey 2021",
+				"dataFiles":[
+					{"id":"F1","name":"household","caseCount":1200,"variables":[{"name":"hhid"},{"name":"sex"}]},
+					{"id":"F2","name":"individual","caseCount":3400,"variables":[{"name":"age"}]}],
+				"variables":[
+					{"vid":"V2","name":"sex","question":"What is your sex?","categories":[
+						{"value":"1","label":"Male","frequency":590},
+						{"value":"2","label":"Female","frequency":null}]},
+					{"vid":"V3","name":"age","question":"How old are you?","categories":[]}]},
+			"sex":{"label":"Sex of respondent","question":"What is your sex?"}}}`, body)
+
+		// fields are returned in query order
+		assert.True(t, strings.HasPrefix(body, `{"data":{"study":{"title":`))
+
+		// every resource is fetched once and V1 is never fetched as only list
+		// fields of it were selected
+		assert.Equal(t, map[string]int{
+			"/KEN_2021_HFS":              1,
+			"/KEN_2021_HFS/variables":    1,
+			"/KEN_2021_HFS/variables/V2": 1,
+			"/KEN_2021_HFS/variables/V3": 1,
+		}, catalog.hits)
+	})
+
+	t.Run("data files derived from variables", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		_, body := post(t, h, `{"query":"{ study(idno: \"NGA_2020_HFS\") { dataFiles { id name varCount } } }"}`)
+		assert.JSONEq(t, `{"data":{"study":{"dataFiles":[{"id":"F9","name":null,"varCount":2}]}}}`, body)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		h, catalog := newTestHandler(t)
+		_, body := post(t, h, `{"query":"{ search(keywords: \"frequency\", countries: \"KEN\", pageSize: 5) { __typename idno yearStart created study { nation } } }"}`)
+		assert.JSONEq(t, `{"data":{"search":[{"__typename":"Survey","idno":"KEN_2021_HFS","yearStart":2021,"created":"2022-05-11T11:14:45Z","study":{"nation":"Kenya"}}]}}`, body)
+		assert.Equal(t, 1, catalog.hits["/search"])
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		h, catalog := newTestHandler(t, WithConcurrency(1))
+		_, body := post(t, h, `{"query":"{ study(idno: \"KEN_2021_HFS\") { variables { question } } }"}`)
+		assert.JSONEq(t, `{"data":{"study":{"variables":[{"question":null},{"question":"What is your sex?"},{"question":"How old are you?"}]}}}`, body)
+		assert.Equal(t, 1, catalog.peak)
+
+		h, catalog = newTestHandler(t)
+		post(t, h, `{"query":"{ study(idno: \"KEN_2021_HFS\") { variables { question } } }"}`)
+		assert.Equal(t, 3, catalog.peak)
+	})
+
+	t.Run("variable limit", func(t *testing.T) {
+		h, catalog := newTestHandler(t, WithMaxVariables(2))
+		_, body := post(t, h, `{"query":"{ study(idno: \"KEN_2021_HFS\") { variables { name question } } }"}`)
+
+		var r Response
+		assert.NoError(t, json.Unmarshal([]byte(body), &r))
+		if assert.Len(t, r.Errors, 1) {
+			assert.Equal(t, "query needs the metadata of more than 2 variables; select fewer with names, vids or limit", r.Errors[0].Message)
+			assert.Equal(t, []interface{}{"study", "variables", r.Errors[0].Path[2], "question"}, r.Errors[0].Path)
+		}
+		fetched := catalog.hits["/KEN_2021_HFS/variables/V1"] + catalog.hits["/KEN_2021_HFS/variables/V2"] + catalog.hits["/KEN_2021_HFS/variables/V3"]
+		assert.Equal(t, 2, fetched)
+
+		// variables listed without their full metadata do not count
+		_, body = post(t, h, `{"query":"{ study(idno: \"KEN_2021_HFS\") { variables { name label } } }"}`)
+		assert.NotContains(t, body, "errors")
+	})
+
+	t.Run("study times", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		_, body := post(t, h, `{"query":"{ study(idno: \"KEN_2021_HFS\") { created changed } }"}`)
+		assert.JSONEq(t, `{"data":{"study":{"created":"2022-05-03T12:46:00Z","changed":null}}}`, body)
+	})
+
+	t.Run("directives", func(t *testing.T) {
+		h, catalog := newTestHandler(t)
+		_, body := post(t, h, `{"query":"query($full: Boolean = false) { study(idno: \"KEN_2021_HFS\") { title variables(limit: 1) @include(if: $full) { name } abstract @skip(if: true) } }"}`)
+		assert.JSONEq(t, `{"data":{"study":{"title":"High Frequency Survey 2021"}}}`, body)
+		assert.Zero(t, catalog.hits["/KEN_2021_HFS/variables"])
+	})
+
+	t.Run("field errors", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		rec, body := post(t, h, `{"query":"{ a: study(idno: \"KEN_2021_HFS\") { idno } b: study(idno: \"MISSING\") { idno } }"}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"data":{"a":{"idno":"KEN_2021_HFS"},"b":null},
+			"errors":[{"message":"failed to fetch response: non-200 status code from the API with statuscode: 404","path":["b"]}]}`, body)
+	})
+
+	t.Run("request errors", func(t *testing.T) {
+		h, catalog := newTestHandler(t)
+		for query, msg := range map[string]string{
+			`{ study(idno: "x") { bogus } }`:                          `cannot query field "bogus" on type StudyMeta`,
+			`{ study { title } }`:                                     `argument "idno" of type String! is required on field Query.study`,
+			`{ study(idno: "x") }`:                                    `field "study" of type StudyMeta must have a selection`,
+			`{ study(idno: $idno) { title } }`:                        `variable $idno is not declared`,
+			`query($idno: String!) { study(idno: $idno) { title } }`:  `variable $idno: expected String!, found null`,
+			`{ search(page: "one") { idno } }`:                        `argument "page": expected Int, found one`,
+			`query A { search { idno } } query B { search { idno } }`: `operationName is required when the document has several operations`,
+			`{ study(idno: "x"`:                                       `syntax error at 1:18: unexpected end of document`,
+		} {
+			body, _ := json.Marshal(Request{Query: query})
+			rec, resp := post(t, h, string(body))
+			var r Response
+			assert.NoError(t, json.Unmarshal([]byte(resp), &r))
+			if assert.Len(t, r.Errors, 1, query) {
+				assert.Equal(t, msg, r.Errors[0].Message, query)
+			}
+			assert.Nil(t, r.Data, query)
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+		assert.Empty(t, catalog.hits)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		rec := httptest.NewRecorder()
+		q := url.Values{
+			"query":         {`query A($vid: String!) { variable(idno: "KEN_2021_HFS", vid: $vid) { name } } query B { search { idno } }`},
+			"variables":     {`{"vid":"V3"}`},
+			"operationName": {"A"},
+		}
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?"+q.Encode(), nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"data":{"variable":{"name":"age"}}}`, rec.Body.String())
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/graphql", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.Equal(t, "GET, POST", rec.Header().Get("Allow"))
+	})
+}
@@ -0,0 +1,106 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/northeastloon/nadago"
+)
+
+// loader fetches studies, variable lists and variables for a single request.
+// Concurrent resolvers asking for the same key share one call, and at most
+// concurrency calls reach the catalog at once. Past maxVariables distinct
+// variables, fetching a variable fails instead of calling GetVarMeta
+type loader struct {
+	client       *nadago.Client
+	sem          chan struct{}
+	maxVariables int
+
+	mu      sync.Mutex
+	calls   map[string]*call
+	fetched int
+}
+
+type call struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newLoader(c *nadago.Client, concurrency, maxVariables int) *loader {
+	return &loader{
+		client:       c,
+		sem:          make(chan struct{}, concurrency),
+		maxVariables: maxVariables,
+		calls:        map[string]*call{},
+	}
+}
+
+func (l *loader) load(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	l.mu.Lock()
+	if c, ok := l.calls[key]; ok {
+		l.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	l.calls[key] = c
+	l.mu.Unlock()
+	defer close(c.done)
+
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return nil, c.err
+	}
+	c.val, c.err = fetch(ctx)
+	<-l.sem
+	return c.val, c.err
+}
+
+func (l *loader) study(ctx context.Context, idno string) (nadago.SurveyMeta, error) {
+	v, err := l.load(ctx, "study/"+idno, func(ctx context.Context) (interface{}, error) {
+		return l.client.GetSurveyMeta(ctx, idno)
+	})
+	if err != nil {
+		return nadago.SurveyMeta{}, err
+	}
+	return v.(nadago.SurveyMeta), nil
+}
+
+func (l *loader) variables(ctx context.Context, idno string) ([]nadago.Variable, error) {
+	v, err := l.load(ctx, "variables/"+idno, func(ctx context.Context) (interface{}, error) {
+		vars, err := l.client.GetSurveyVars(ctx, idno)
+		if err != nil {
+			return nil, err
+		}
+		return vars.List(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]nadago.Variable), nil
+}
+
+func (l *loader) variable(ctx context.Context, idno, vid string) (nadago.Variable, error) {
+	v, err := l.load(ctx, "variable/"+idno+"/"+vid, func(ctx context.Context) (interface{}, error) {
+		l.mu.Lock()
+		l.fetched++
+		over := l.fetched > l.maxVariables
+		l.mu.Unlock()
+		if over {
+			return nil, fmt.Errorf("query needs the metadata of more than %d variables; select fewer with names, vids or limit", l.maxVariables)
+		}
+		return l.client.GetVarMeta(ctx, idno, vid)
+	})
+	if err != nil {
+		return nadago.Variable{}, err
+	}
+	return v.(nadago.Variable), nil
+}
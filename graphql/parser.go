@@ -0,0 +1,463 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed request. Only query operations are supported; fragments
+// are rejected when parsing
+type Document struct {
+	Operations []*Operation
+}
+
+type Operation struct {
+	Name      string
+	Variables []VariableDefinition
+	Selection []*Field
+}
+
+type VariableDefinition struct {
+	Name     string
+	Type     string
+	Default  interface{}
+	Required bool
+}
+
+type Field struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]interface{}
+	Directives []Directive
+	Selection  []*Field
+}
+
+type Directive struct {
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// Variable is a reference to an operation variable inside an argument value
+type Variable string
+
+// ResponseKey is the key of the field in the result, the alias when given
+func (f *Field) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type SyntaxError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// Parse parses a GraphQL query document
+func Parse(src string) (doc *Document, err error) {
+	p := &parser{src: src}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+
+	p.next()
+	doc = &Document{}
+	for p.tok.kind != tokenEOF {
+		doc.Operations = append(doc.Operations, p.operation())
+	}
+	if len(doc.Operations) == 0 {
+		p.fail("document has no operations")
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	line, col := 1, 1
+	for _, r := range p.src[:p.tok.pos] {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	panic(SyntaxError{Line: line, Column: col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) operation() *Operation {
+	op := &Operation{}
+	if p.peek(tokenPunct, "{") {
+		op.Selection = p.selectionSet()
+		return op
+	}
+
+	switch kw := p.tok.value; {
+	case p.tok.kind != tokenName:
+		p.expect(tokenName, "query")
+	case kw == "mutation" || kw == "subscription":
+		p.fail("%s operations are not supported", kw)
+	case kw == "fragment":
+		p.fail("fragments are not supported")
+	case kw != "query":
+		p.fail("unexpected %q", kw)
+	}
+	p.next()
+
+	if p.tok.kind == tokenName {
+		op.Name = p.expect(tokenName, "")
+	}
+	if p.skip(tokenPunct, "(") {
+		for !p.skip(tokenPunct, ")") {
+			op.Variables = append(op.Variables, p.variableDefinition())
+		}
+	}
+	op.Selection = p.selectionSet()
+	return op
+}
+
+func (p *parser) variableDefinition() VariableDefinition {
+	p.expect(tokenPunct, "$")
+	def := VariableDefinition{Name: p.expect(tokenName, "")}
+	p.expect(tokenPunct, ":")
+	def.Type, def.Required = p.typeRef()
+	if p.skip(tokenPunct, "=") {
+		def.Default = p.value(true)
+	}
+	return def
+}
+
+func (p *parser) typeRef() (string, bool) {
+	var t string
+	if p.skip(tokenPunct, "[") {
+		inner, _ := p.typeRef()
+		p.expect(tokenPunct, "]")
+		t = "[" + inner + "]"
+	} else {
+		t = p.expect(tokenName, "")
+	}
+	if p.skip(tokenPunct, "!") {
+		return t + "!", true
+	}
+	return t, false
+}
+
+func (p *parser) selectionSet() []*Field {
+	p.expect(tokenPunct, "{")
+	var fields []*Field
+	for !p.skip(tokenPunct, "}") {
+		if p.peek(tokenPunct, "...") {
+			p.fail("fragments are not supported")
+		}
+		fields = append(fields, p.field())
+	}
+	if len(fields) == 0 {
+		p.fail("empty selection set")
+	}
+	return fields
+}
+
+func (p *parser) field() *Field {
+	f := &Field{Name: p.expect(tokenName, "")}
+	if p.skip(tokenPunct, ":") {
+		f.Alias, f.Name = f.Name, p.expect(tokenName, "")
+	}
+	if p.peek(tokenPunct, "(") {
+		f.Arguments = p.arguments()
+	}
+	for p.skip(tokenPunct, "@") {
+		d := Directive{Name: p.expect(tokenName, "")}
+		if p.peek(tokenPunct, "(") {
+			d.Arguments = p.arguments()
+		}
+		f.Directives = append(f.Directives, d)
+	}
+	if p.peek(tokenPunct, "{") {
+		f.Selection = p.selectionSet()
+	}
+	return f
+}
+
+func (p *parser) arguments() map[string]interface{} {
+	p.expect(tokenPunct, "(")
+	args := map[string]interface{}{}
+	for !p.skip(tokenPunct, ")") {
+		name := p.expect(tokenName, "")
+		p.expect(tokenPunct, ":")
+		args[name] = p.value(false)
+	}
+	return args
+}
+
+// value parses an argument value. Enum values are returned as strings
+func (p *parser) value(constant bool) interface{} {
+	tok := p.tok
+	switch {
+	case tok.kind == tokenPunct && tok.value == "$":
+		if constant {
+			p.fail("variables are not allowed in default values")
+		}
+		p.next()
+		return Variable(p.expect(tokenName, ""))
+	case tok.kind == tokenPunct && tok.value == "[":
+		p.next()
+		list := []interface{}{}
+		for !p.skip(tokenPunct, "]") {
+			list = append(list, p.value(constant))
+		}
+		return list
+	case tok.kind == tokenPunct && tok.value == "{":
+		p.next()
+		obj := map[string]interface{}{}
+		for !p.skip(tokenPunct, "}") {
+			name := p.expect(tokenName, "")
+			p.expect(tokenPunct, ":")
+			obj[name] = p.value(constant)
+		}
+		return obj
+	case tok.kind == tokenInt:
+		p.next()
+		n, err := strconv.Atoi(tok.value)
+		if err != nil {
+			p.fail("invalid integer %s", tok.value)
+		}
+		return n
+	case tok.kind == tokenFloat:
+		p.next()
+		f, _ := strconv.ParseFloat(tok.value, 64)
+		return f
+	case tok.kind == tokenString:
+		p.next()
+		return tok.value
+	case tok.kind == tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return tok.value
+	}
+	p.fail("unexpected %q", tok.value)
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.tok.kind == kind && (value == "" || p.tok.value == value)
+}
+
+func (p *parser) skip(kind tokenKind, value string) bool {
+	if p.peek(kind, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, value string) string {
+	if !p.peek(kind, value) {
+		if p.tok.kind == tokenEOF {
+			p.fail("unexpected end of document")
+		}
+		want := value
+		if want == "" {
+			want = "a name"
+		}
+		p.fail("expected %s, found %q", want, p.tok.value)
+	}
+	v := p.tok.value
+	p.next()
+	return v
+}
+
+// next reads the following token, skipping whitespace, commas and comments
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], "\ufeff") {
+			p.pos += 3
+			continue
+		}
+		break
+	}
+
+	start := p.pos
+	p.tok = token{pos: start}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokenEOF
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok.kind, p.tok.value = tokenPunct, "..."
+	case strings.ContainsRune("!$():=@[]{}|", rune(c)):
+		p.pos++
+		p.tok.kind, p.tok.value = tokenPunct, string(c)
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok.kind, p.tok.value = tokenName, p.src[start:p.pos]
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		p.fail("unexpected character %q", c)
+	}
+}
+
+func (p *parser) number() {
+	start := p.pos
+	p.tok.kind = tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		n := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == n {
+			p.fail("invalid number")
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		p.pos++
+		p.tok.kind = tokenFloat
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		p.pos++
+		p.tok.kind = tokenFloat
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	p.tok.value = p.src[start:p.pos]
+}
+
+func (p *parser) string() {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			p.fail("unterminated block string")
+		}
+		p.tok.kind, p.tok.value = tokenString, p.src[p.pos+3:p.pos+3+end]
+		p.pos += end + 6
+		return
+	}
+
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			b.WriteRune(r)
+			p.pos += size
+			continue
+		}
+
+		p.pos++
+		if p.pos >= len(p.src) {
+			p.fail("unterminated string")
+		}
+		switch e := p.src[p.pos]; e {
+		case '"', '\\', '/':
+			b.WriteByte(e)
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if p.pos+5 > len(p.src) {
+				p.fail("invalid unicode escape")
+			}
+			n, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 32)
+			if err != nil {
+				p.fail("invalid unicode escape")
+			}
+			b.WriteRune(rune(n))
+			p.pos += 4
+		default:
+			p.fail("invalid escape \\%c", e)
+		}
+		p.pos++
+	}
+	p.tok.kind, p.tok.value = tokenString, b.String()
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
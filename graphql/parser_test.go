@@ -0,0 +1,65 @@
+package graphql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# fetch a study
+		query Study($idno: String!, $names: [String] = ["sex", "age"]) {
+			s: study(idno: $idno) {
+				title
+				variables(names: $names, limit: 10) @include(if: true) { name question }
+			}
+		}
+	`)
+	assert.NoError(t, err)
+	assert.Len(t, doc.Operations, 1)
+
+	op := doc.Operations[0]
+	assert.Equal(t, "Study", op.Name)
+	assert.Equal(t, []VariableDefinition{
+		{Name: "idno", Type: "String!", Required: true},
+		{Name: "names", Type: "[String]", Default: []interface{}{"sex", "age"}},
+	}, op.Variables)
+
+	study := op.Selection[0]
+	assert.Equal(t, "s", study.ResponseKey())
+	assert.Equal(t, "study", study.Name)
+	assert.Equal(t, map[string]interface{}{"idno": Variable("idno")}, study.Arguments)
+
+	vars := study.Selection[1]
+	assert.Equal(t, map[string]interface{}{"names": Variable("names"), "limit": 10}, vars.Arguments)
+	assert.Equal(t, []Directive{{Name: "include", Arguments: map[string]interface{}{"if": true}}}, vars.Directives)
+	assert.Len(t, vars.Selection, 2)
+
+	t.Run("values", func(t *testing.T) {
+		doc, err := Parse(`{ f(a: -1.5e2, b: "tab\té", c: null, d: ENUM, e: {x: [1, 2]}, g: """raw "quoted" text""") }`)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"a": -150.0,
+			"b": "tab\té",
+			"c": nil,
+			"d": "ENUM",
+			"e": map[string]interface{}{"x": []interface{}{1, 2}},
+			"g": `raw "quoted" text`,
+		}, doc.Operations[0].Selection[0].Arguments)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for src, msg := range map[string]string{
+			"":                               "syntax error at 1:1: document has no operations",
+			"{ study(idno: \"x\") { title }": "syntax error at 1:29: unexpected end of document",
+			"mutation { x }":                 "syntax error at 1:1: mutation operations are not supported",
+			"{ ...Fields }":                  "syntax error at 1:3: fragments are not supported",
+			"{\n  a(b: \"open) }":            "syntax error at 2:8: unterminated string",
+			"{ a(b: $c = 1) }":               `syntax error at 1:11: expected a name, found "="`,
+		} {
+			_, err := Parse(src)
+			assert.EqualError(t, err, msg, src)
+		}
+	})
+}
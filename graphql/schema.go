@@ -0,0 +1,385 @@
+package graphql
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/northeastloon/nadago"
+)
+
+// Schema is the schema served by the handler, in GraphQL SDL
+const Schema = `type Query {
+  search(keywords: String, countries: [String], from: Int, to: Int, page: Int, pageSize: Int): [Survey]
+  study(idno: String!): StudyMeta
+  variable(idno: String!, vid: String!): Variable
+}
+
+type Survey {
+  idno: String
+  title: String
+  nation: String
+  yearStart: Int
+  yearEnd: Int
+  created: String
+  changed: String
+  url: String
+  varCount: Int
+  study: StudyMeta
+}
+
+type StudyMeta {
+  idno: String
+  title: String
+  nation: String
+  abstract: String
+  samplingProcedure: String
+  created: String
+  changed: String
+  dataFiles: [DataFile]
+  variables(names: [String], vids: [String], fileId: String, limit: Int): [Variable]
+}
+
+type DataFile {
+  id: String
+  name: String
+  description: String
+  caseCount: Int
+  varCount: Int
+  variables(limit: Int): [Variable]
+}
+
+type Variable {
+  idno: String
+  vid: String
+  name: String
+  label: String
+  question: String
+  fileId: String
+  categories: [Category]
+}
+
+type Category {
+  value: String
+  label: String
+  frequency: Float
+}
+`
+
+// resolver returns the value of a field. Values of list fields are returned as
+// []interface{} and missing values as a nil interface
+type resolver func(ctx context.Context, l *loader, source interface{}, args map[string]interface{}) (interface{}, error)
+
+type fieldDef struct {
+	typ     string
+	args    map[string]string
+	resolve resolver
+}
+
+var scalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true}
+
+var types = map[string]map[string]fieldDef{
+	"Query": {
+		"search": {
+			typ:     "[Survey]",
+			args:    map[string]string{"keywords": "String", "countries": "[String]", "from": "Int", "to": "Int", "page": "Int", "pageSize": "Int"},
+			resolve: resolveSearch,
+		},
+		"study": {
+			typ:  "StudyMeta",
+			args: map[string]string{"idno": "String!"},
+			resolve: func(ctx context.Context, l *loader, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				return l.study(ctx, args["idno"].(string))
+			},
+		},
+		"variable": {
+			typ:  "Variable",
+			args: map[string]string{"idno": "String!", "vid": "String!"},
+			resolve: func(ctx context.Context, l *loader, _ interface{}, args map[string]interface{}) (interface{}, error) {
+				v, err := l.variable(ctx, args["idno"].(string), args["vid"].(string))
+				return variable{Variable: v, full: true}, err
+			},
+		},
+	},
+	"Survey": {
+		"idno":      surveyField("String", func(s nadago.Survey) interface{} { return s.Idno }),
+		"title":     surveyField("String", func(s nadago.Survey) interface{} { return s.Title }),
+		"nation":    surveyField("String", func(s nadago.Survey) interface{} { return s.Nation }),
+		"yearStart": surveyField("Int", func(s nadago.Survey) interface{} { return s.Start }),
+		"yearEnd":   surveyField("Int", func(s nadago.Survey) interface{} { return s.End }),
+		"created":   surveyField("String", func(s nadago.Survey) interface{} { return formatTime(s.Created.Time) }),
+		"changed":   surveyField("String", func(s nadago.Survey) interface{} { return formatTime(s.Changed.Time) }),
+		"url":       surveyField("String", func(s nadago.Survey) interface{} { return s.Url }),
+		"varCount":  surveyField("Int", func(s nadago.Survey) interface{} { return s.Varcount }),
+		"study": {
+			typ: "StudyMeta",
+			resolve: func(ctx context.Context, l *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+				return l.study(ctx, src.(nadago.Survey).Idno)
+			},
+		},
+	},
+	"StudyMeta": {
+		"idno":              studyField(func(m nadago.SurveyMeta) string { return m.Idno }),
+		"title":             studyField(nadago.SurveyMeta.Title),
+		"nation":            studyField(nadago.SurveyMeta.Nation),
+		"abstract":          studyField(nadago.SurveyMeta.Abstract),
+		"samplingProcedure": studyField(nadago.SurveyMeta.SamplingProcedure),
+		"created":           studyField(func(m nadago.SurveyMeta) string { return formatTimeString(m.Created().Time) }),
+		"changed":           studyField(func(m nadago.SurveyMeta) string { return formatTimeString(m.Changed().Time) }),
+		"dataFiles":         {typ: "[DataFile]", resolve: resolveDataFiles},
+		"variables": {
+			typ:     "[Variable]",
+			args:    map[string]string{"names": "[String]", "vids": "[String]", "fileId": "String", "limit": "Int"},
+			resolve: resolveStudyVariables,
+		},
+	},
+	"DataFile": {
+		"id":          fileField("String", func(f dataFile) interface{} { return f.ID }),
+		"name":        fileField("String", func(f dataFile) interface{} { return nullIfEmpty(f.Name) }),
+		"description": fileField("String", func(f dataFile) interface{} { return nullIfEmpty(f.Description) }),
+		"caseCount":   fileField("Int", func(f dataFile) interface{} { return f.CaseCount }),
+		"varCount":    fileField("Int", func(f dataFile) interface{} { return f.VarCount }),
+		"variables": {
+			typ:  "[Variable]",
+			args: map[string]string{"limit": "Int"},
+			resolve: func(ctx context.Context, l *loader, src interface{}, args map[string]interface{}) (interface{}, error) {
+				f := src.(dataFile)
+				vars, err := l.variables(ctx, f.idno)
+				if err != nil {
+					return nil, err
+				}
+				return filterVariables(vars, nil, nil, f.ID, args["limit"]), nil
+			},
+		},
+	},
+	"Variable": {
+		"idno":     variableField(false, func(v nadago.Variable) string { return v.Idno }),
+		"vid":      variableField(false, func(v nadago.Variable) string { return v.Vid }),
+		"name":     variableField(false, nadago.Variable.Name),
+		"label":    variableField(false, nadago.Variable.Label),
+		"fileId":   variableField(false, nadago.Variable.FileID),
+		"question": variableField(true, nadago.Variable.Question),
+		"categories": {
+			typ: "[Category]",
+			resolve: func(ctx context.Context, l *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+				v, err := src.(variable).metadata(ctx, l)
+				if err != nil {
+					return nil, err
+				}
+				var cats []interface{}
+				for _, c := range v.Categories() {
+					cats = append(cats, c)
+				}
+				return cats, nil
+			},
+		},
+	},
+	"Category": {
+		"value": categoryField(func(c nadago.Category) interface{} { return c.Value }),
+		"label": categoryField(func(c nadago.Category) interface{} { return nullIfEmpty(c.Label) }),
+		"frequency": {
+			typ: "Float",
+			resolve: func(_ context.Context, _ *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+				if f, ok := src.(nadago.Category).Frequency(); ok {
+					return f, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+}
+
+// variable is a Variable either from a variable list row, which lacks the
+// question and categories, or from GetVarMeta
+type variable struct {
+	nadago.Variable
+	full bool
+}
+
+// metadata returns the full variable metadata, fetching it through the loader
+// for list rows
+func (v variable) metadata(ctx context.Context, l *loader) (nadago.Variable, error) {
+	if v.full {
+		return v.Variable, nil
+	}
+	return l.variable(ctx, v.Idno, v.Vid)
+}
+
+type dataFile struct {
+	nadago.DataFile
+	idno string
+}
+
+func surveyField(typ string, get func(nadago.Survey) interface{}) fieldDef {
+	return fieldDef{typ: typ, resolve: func(_ context.Context, _ *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(nadago.Survey)), nil
+	}}
+}
+
+func studyField(get func(nadago.SurveyMeta) string) fieldDef {
+	return fieldDef{typ: "String", resolve: func(_ context.Context, _ *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return nullIfEmpty(get(src.(nadago.SurveyMeta))), nil
+	}}
+}
+
+func fileField(typ string, get func(dataFile) interface{}) fieldDef {
+	return fieldDef{typ: typ, resolve: func(_ context.Context, _ *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(dataFile)), nil
+	}}
+}
+
+func categoryField(get func(nadago.Category) interface{}) fieldDef {
+	return fieldDef{typ: "String", resolve: func(_ context.Context, _ *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(src.(nadago.Category)), nil
+	}}
+}
+
+// variableField reads a string field, from the list row when it has it and
+// otherwise from the full metadata. Fields only found in the full metadata
+// always fetch it
+func variableField(full bool, get func(nadago.Variable) string) fieldDef {
+	return fieldDef{typ: "String", resolve: func(ctx context.Context, l *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		v := src.(variable)
+		if !full {
+			if s := get(v.Variable); s != "" || v.full {
+				return nullIfEmpty(s), nil
+			}
+		}
+		meta, err := v.metadata(ctx, l)
+		if err != nil {
+			return nil, err
+		}
+		return nullIfEmpty(get(meta)), nil
+	}}
+}
+
+func resolveSearch(ctx context.Context, l *loader, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	q := nadago.NewQuery()
+	if kw, ok := args["keywords"].(string); ok {
+		q.All(strings.Fields(kw)...)
+	}
+	for _, c := range toStrings(args["countries"]) {
+		q.Countries(c)
+	}
+	from, _ := args["from"].(int)
+	to, _ := args["to"].(int)
+	q.Years(from, to)
+	if page, ok := args["page"].(int); ok {
+		q.Page(page)
+	}
+	if ps, ok := args["pageSize"].(int); ok {
+		q.PageSize(ps)
+	}
+
+	surveys, err := q.Search(ctx, l.client)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, len(surveys))
+	for i, s := range surveys {
+		list[i] = s
+	}
+	return list, nil
+}
+
+// resolveDataFiles lists the data files described in the study metadata. When
+// the metadata has none, the files are derived from the file ids of the
+// study's variables
+func resolveDataFiles(ctx context.Context, l *loader, src interface{}, _ map[string]interface{}) (interface{}, error) {
+	m := src.(nadago.SurveyMeta)
+	var files []interface{}
+	for _, f := range m.DataFiles() {
+		files = append(files, dataFile{DataFile: f, idno: m.Idno})
+	}
+	if len(files) > 0 {
+		return files, nil
+	}
+
+	vars, err := l.variables(ctx, m.Idno)
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for _, v := range vars {
+		fid := v.FileID()
+		if fid == "" {
+			continue
+		}
+		i, ok := index[fid]
+		if !ok {
+			i = len(files)
+			index[fid] = i
+			files = append(files, dataFile{DataFile: nadago.DataFile{ID: fid}, idno: m.Idno})
+		}
+		f := files[i].(dataFile)
+		f.VarCount++
+		files[i] = f
+	}
+	return files, nil
+}
+
+func resolveStudyVariables(ctx context.Context, l *loader, src interface{}, args map[string]interface{}) (interface{}, error) {
+	vars, err := l.variables(ctx, src.(nadago.SurveyMeta).Idno)
+	if err != nil {
+		return nil, err
+	}
+	fid, _ := args["fileId"].(string)
+	return filterVariables(vars, toStrings(args["names"]), toStrings(args["vids"]), fid, args["limit"]), nil
+}
+
+// filterVariables keeps the variables matching any of the names or vids, when
+// given, in the order of the study's variable list
+func filterVariables(vars []nadago.Variable, names, vids []string, fid string, limit interface{}) []interface{} {
+	keep := map[string]bool{}
+	for _, n := range names {
+		keep["name/"+n] = true
+	}
+	for _, v := range vids {
+		keep["vid/"+v] = true
+	}
+	max, _ := limit.(int)
+
+	list := []interface{}{}
+	for _, v := range vars {
+		if max > 0 && len(list) == max {
+			break
+		}
+		if len(keep) > 0 && !keep["name/"+v.Name()] && !keep["vid/"+v.Vid] {
+			continue
+		}
+		if fid != "" && v.FileID() != fid {
+			continue
+		}
+		list = append(list, variable{Variable: v})
+	}
+	return list
+}
+
+func toStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	s := make([]string, 0, len(list))
+	for _, item := range list {
+		if str, ok := item.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
+
+func formatTime(t time.Time) interface{} {
+	return nullIfEmpty(formatTimeString(t))
+}
+
+func formatTimeString(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
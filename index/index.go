@@ -0,0 +1,473 @@
+// Package index is an in-memory inverted index over harvested study and
+// variable metadata, supporting field-scoped, phrase, prefix and fuzzy queries
+// ranked with BM25. Indexes can be saved to and loaded from disk.
+package index
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/text"
+)
+
+type Field string
+
+const (
+	FieldTitle    Field = "title"
+	FieldNation   Field = "nation"
+	FieldAbstract Field = "abstract"
+	FieldName     Field = "name"
+	FieldLabel    Field = "label"
+	FieldQuestion Field = "question"
+	FieldValues   Field = "values"
+)
+
+// Fields lists every indexed field in the order unscoped queries search them
+var Fields = []Field{FieldTitle, FieldNation, FieldAbstract, FieldName, FieldLabel, FieldQuestion, FieldValues}
+
+// boosts weight matches in short descriptive fields above long free text
+var boosts = map[Field]float64{
+	FieldTitle: 2,
+	FieldName:  1.5,
+	FieldLabel: 2,
+}
+
+type Kind string
+
+const (
+	KindStudy    Kind = "study"
+	KindVariable Kind = "variable"
+)
+
+// Document is a unit of indexed text. Documents added with an existing ID are
+// merged into it, with non-empty fields replacing the previous values
+type Document struct {
+	ID     string
+	Kind   Kind
+	Idno   string
+	Vid    string
+	Title  string
+	Fields map[Field]string
+}
+
+type Result struct {
+	ID    string
+	Kind  Kind
+	Idno  string
+	Vid   string
+	Title string
+	Score float64
+}
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+type doc struct {
+	Document
+	Tokens map[Field][]string
+}
+
+// Index is safe for concurrent use. Searches run in parallel, while adding a
+// document waits for searches in progress
+type Index struct {
+	mu       sync.RWMutex
+	docs     []*doc
+	ids      map[string]int
+	postings map[Field]map[string]map[int]int
+	totals   map[Field]int
+	counts   map[Field]int
+}
+
+func New() *Index {
+	return &Index{
+		ids:      map[string]int{},
+		postings: map[Field]map[string]map[int]int{},
+		totals:   map[Field]int{},
+		counts:   map[Field]int{},
+	}
+}
+
+// Len returns the number of documents in the index
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.ids)
+}
+
+// AddSurvey indexes a search result as a study document
+func (ix *Index) AddSurvey(s nadago.Survey) {
+	ix.Add(Document{
+		ID:    studyID(s.Idno),
+		Kind:  KindStudy,
+		Idno:  s.Idno,
+		Title: s.Title,
+		Fields: map[Field]string{
+			FieldTitle:  s.Title,
+			FieldNation: s.Nation,
+		},
+	})
+}
+
+// AddStudy indexes study metadata, merging with any search result already indexed
+func (ix *Index) AddStudy(m nadago.SurveyMeta) {
+	ix.Add(Document{
+		ID:    studyID(m.Idno),
+		Kind:  KindStudy,
+		Idno:  m.Idno,
+		Title: m.Title(),
+		Fields: map[Field]string{
+			FieldTitle:    m.Title(),
+			FieldNation:   m.Nation(),
+			FieldAbstract: m.Abstract(),
+		},
+	})
+}
+
+// AddVariable indexes a variable from a variable list or GetVarMeta
+func (ix *Index) AddVariable(v nadago.Variable) {
+	cats := v.Categories()
+	values := make([]string, 0, len(cats))
+	for _, c := range cats {
+		values = append(values, c.Label)
+	}
+
+	title := v.Name()
+	if v.Label() != "" {
+		title += " - " + v.Label()
+	}
+
+	ix.Add(Document{
+		ID:    "variable:" + v.Idno + "/" + v.Vid,
+		Kind:  KindVariable,
+		Idno:  v.Idno,
+		Vid:   v.Vid,
+		Title: title,
+		Fields: map[Field]string{
+			FieldName:     v.Name(),
+			FieldLabel:    v.Label(),
+			FieldQuestion: v.Question(),
+			FieldValues:   strings.Join(values, "\n"),
+		},
+	})
+}
+
+func studyID(idno string) string {
+	return "study:" + idno
+}
+
+func (ix *Index) Add(d Document) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	// a document added again takes the slot of the one it replaces
+	i := len(ix.docs)
+	if prev, ok := ix.ids[d.ID]; ok {
+		i = prev
+		old := ix.docs[i]
+		ix.remove(i)
+		merged := old.Document
+		merged.Fields = map[Field]string{}
+		for f, v := range old.Fields {
+			merged.Fields[f] = v
+		}
+		for f, v := range d.Fields {
+			if v != "" {
+				merged.Fields[f] = v
+			}
+		}
+		if d.Title != "" {
+			merged.Title = d.Title
+		}
+		d = merged
+	}
+
+	nd := &doc{Document: d, Tokens: map[Field][]string{}}
+	if i == len(ix.docs) {
+		ix.docs = append(ix.docs, nd)
+	} else {
+		ix.docs[i] = nd
+	}
+	ix.ids[d.ID] = i
+
+	for f, v := range d.Fields {
+		tokens := text.Tokenize(v)
+		if len(tokens) == 0 {
+			continue
+		}
+		nd.Tokens[f] = tokens
+		ix.totals[f] += len(tokens)
+		ix.counts[f]++
+
+		terms := ix.postings[f]
+		if terms == nil {
+			terms = map[string]map[int]int{}
+			ix.postings[f] = terms
+		}
+		for _, t := range tokens {
+			if terms[t] == nil {
+				terms[t] = map[int]int{}
+			}
+			terms[t][i]++
+		}
+	}
+}
+
+func (ix *Index) remove(i int) {
+	d := ix.docs[i]
+	for f, tokens := range d.Tokens {
+		ix.totals[f] -= len(tokens)
+		ix.counts[f]--
+		for _, t := range tokens {
+			delete(ix.postings[f][t], i)
+			if len(ix.postings[f][t]) == 0 {
+				delete(ix.postings[f], t)
+			}
+		}
+	}
+	ix.docs[i] = nil
+	delete(ix.ids, d.ID)
+}
+
+// Search runs a query and returns up to limit results, best first. A limit of
+// zero returns every match. See ParseQuery for the query syntax
+func (ix *Index) Search(query string, limit int) ([]Result, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var scores map[int]float64
+	excluded := map[int]bool{}
+
+	for _, c := range q.Clauses {
+		matches := ix.match(c)
+		if c.Exclude {
+			for i := range matches {
+				excluded[i] = true
+			}
+			continue
+		}
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		// every clause must match
+		for i := range scores {
+			if s, ok := matches[i]; ok {
+				scores[i] += s
+			} else {
+				delete(scores, i)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for i, s := range scores {
+		if excluded[i] {
+			continue
+		}
+		d := ix.docs[i]
+		results = append(results, Result{
+			ID:    d.ID,
+			Kind:  d.Kind,
+			Idno:  d.Idno,
+			Vid:   d.Vid,
+			Title: d.Title,
+			Score: s,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// match scores every document matching a clause
+func (ix *Index) match(c Clause) map[int]float64 {
+	fields := Fields
+	if c.Field != "" {
+		fields = []Field{c.Field}
+	}
+
+	scores := map[int]float64{}
+	for _, f := range fields {
+		boost := boosts[f]
+		if boost == 0 {
+			boost = 1
+		}
+
+		var fieldScores map[int]float64
+		if len(c.Terms) > 1 {
+			fieldScores = ix.phrase(f, c.Terms)
+		} else {
+			fieldScores = ix.term(f, c)
+		}
+
+		for i, s := range fieldScores {
+			scores[i] += s * boost
+		}
+	}
+	return scores
+}
+
+// term scores a single term, expanding prefix and fuzzy terms against the field
+// vocabulary and keeping the best scoring expansion per document
+func (ix *Index) term(f Field, c Clause) map[int]float64 {
+	t := c.Terms[0]
+	scores := map[int]float64{}
+
+	add := func(term string, weight float64) {
+		for i, s := range ix.bm25(f, term) {
+			if s*weight > scores[i] {
+				scores[i] = s * weight
+			}
+		}
+	}
+
+	switch {
+	case c.Prefix:
+		for term := range ix.postings[f] {
+			if strings.HasPrefix(term, t) {
+				add(term, 1)
+			}
+		}
+	case c.Fuzzy > 0:
+		for term := range ix.postings[f] {
+			if d := text.Levenshtein(t, term, c.Fuzzy); d <= c.Fuzzy {
+				// exact matches outrank corrected ones
+				add(term, 1/float64(1+d))
+			}
+		}
+	default:
+		add(t, 1)
+	}
+	return scores
+}
+
+// phrase scores documents containing the terms consecutively
+func (ix *Index) phrase(f Field, terms []string) map[int]float64 {
+	candidates := ix.postings[f][terms[0]]
+	scores := map[int]float64{}
+
+	for i := range candidates {
+		tokens := ix.docs[i].Tokens[f]
+		if !containsPhrase(tokens, terms) {
+			continue
+		}
+		for _, t := range terms {
+			scores[i] += ix.bm25(f, t)[i]
+		}
+	}
+	return scores
+}
+
+func containsPhrase(tokens, terms []string) bool {
+	for start := 0; start+len(terms) <= len(tokens); start++ {
+		found := true
+		for j, t := range terms {
+			if tokens[start+j] != t {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func (ix *Index) bm25(f Field, term string) map[int]float64 {
+	postings := ix.postings[f][term]
+	if len(postings) == 0 {
+		return nil
+	}
+
+	n := float64(len(ix.ids))
+	df := float64(len(postings))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	avg := float64(ix.totals[f]) / float64(ix.counts[f])
+
+	scores := make(map[int]float64, len(postings))
+	for i, tf := range postings {
+		l := float64(len(ix.docs[i].Tokens[f]))
+		scores[i] = idf * (float64(tf) * (k1 + 1)) / (float64(tf) + k1*(1-b+b*l/avg))
+	}
+	return scores
+}
+
+// Save writes the indexed documents in a form Load can read back. Postings are
+// rebuilt when loading, which keeps the file format independent of the index layout
+func (ix *Index) Save(w io.Writer) error {
+	ix.mu.RLock()
+	docs := make([]Document, 0, len(ix.ids))
+	for _, d := range ix.docs {
+		if d != nil {
+			docs = append(docs, d.Document)
+		}
+	}
+	ix.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(docs)
+}
+
+func Load(r io.Reader) (*Index, error) {
+	var docs []Document
+	if err := gob.NewDecoder(r).Decode(&docs); err != nil {
+		return nil, err
+	}
+
+	ix := New()
+	for _, d := range docs {
+		ix.Add(d)
+	}
+	return ix, nil
+}
+
+// SaveFile saves the index to path, replacing any existing file only once the
+// index has been written completely
+func (ix *Index) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ix.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadFile(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,158 @@
+package index
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/fixture"
+	"github.com/stretchr/testify/assert"
+)
+
+func testIndex() *Index {
+	ix := New()
+	ix.AddSurvey(nadago.Survey{Idno: "KEN_2021_HFS", Title: "High Frequency Phone Survey 2021", Nation: "Kenya"})
+	ix.AddStudy(nadago.SurveyMeta{Idno: "KEN_2021_HFS", Data: map[string]interface{}{
+		"title":  "High Frequency Phone Survey 2021",
+		"nation": "Kenya",
+		"metadata": map[string]interface{}{"study_desc": map[string]interface{}{"study_info": map[string]interface{}{
+			"abstract": "Monitors household income and food security during the pandemic.",
+		}}},
+	}})
+	ix.AddSurvey(nadago.Survey{Idno: "UGA_2019_LFS", Title: "Labour Force Survey 2019", Nation: "Uganda"})
+
+	ix.AddVariable(fixture.Variable("KEN_2021_HFS", "V1", "hh_income", "Household income last month", fixture.Question("What was the total income of your household?")))
+	ix.AddVariable(fixture.Variable("KEN_2021_HFS", "V2", "head_sex", "Sex of household head", fixture.Question("Is the head of the household male or female?"), fixture.Labels("Male", "Female")))
+	ix.AddVariable(fixture.Variable("UGA_2019_LFS", "V7", "employed", "Currently employed", fixture.Question("Did you work for pay last week?"), fixture.Labels("Yes", "No")))
+	ix.AddVariable(fixture.Variable("UGA_2019_LFS", "V8", "income_main", "Income from main job"))
+	return ix
+}
+
+func ids(results []Result) []string {
+	out := make([]string, 0, len(results))
+	for _, r := range results {
+		out = append(out, r.ID)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	ix := testIndex()
+	assert.Equal(t, 6, ix.Len())
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"kenya", []string{"study:KEN_2021_HFS"}},
+		{"pandemic", []string{"study:KEN_2021_HFS"}},
+		{"label:income", []string{"variable:KEN_2021_HFS/V1", "variable:UGA_2019_LFS/V8"}},
+		{`"household head"`, []string{"variable:KEN_2021_HFS/V2"}},
+		{`question:"head of the household"`, []string{"variable:KEN_2021_HFS/V2"}},
+		{"values:female", []string{"variable:KEN_2021_HFS/V2"}},
+		{"employ*", []string{"variable:UGA_2019_LFS/V7"}},
+		{"incme~", []string{"variable:KEN_2021_HFS/V1", "variable:UGA_2019_LFS/V8", "study:KEN_2021_HFS"}},
+		{"househod~2 income", []string{"variable:KEN_2021_HFS/V1", "study:KEN_2021_HFS"}},
+		{"income -label:household", []string{"variable:UGA_2019_LFS/V8", "study:KEN_2021_HFS"}},
+		{"nosuchterm", []string{}},
+		{"", []string{}},
+	}
+	for _, c := range cases {
+		results, err := ix.Search(c.query, 0)
+		assert.NoError(t, err, c.query)
+		assert.Equal(t, c.want, ids(results), c.query)
+	}
+
+	t.Run("limit", func(t *testing.T) {
+		results, err := ix.Search("income", 1)
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "hh_income - Household income last month", results[0].Title)
+		assert.Equal(t, KindVariable, results[0].Kind)
+	})
+
+	t.Run("title matches rank above abstract matches", func(t *testing.T) {
+		results, err := ix.Search("survey", 0)
+		assert.NoError(t, err)
+		assert.Len(t, results, 2)
+		assert.Greater(t, results[0].Score, float64(0))
+	})
+
+	t.Run("re-adding replaces a document", func(t *testing.T) {
+		ix := testIndex()
+		ix.AddVariable(fixture.Variable("UGA_2019_LFS", "V8", "wage", "Wage from main job"))
+		assert.Equal(t, 6, ix.Len())
+		assert.Len(t, ix.docs, 6)
+
+		results, err := ix.Search("label:income", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"variable:KEN_2021_HFS/V1"}, ids(results))
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	ix := testIndex()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ix.AddVariable(fixture.Variable("UGA_2019_LFS", "V9", "hours", "Hours worked"))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := ix.Search("hours income", 0)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 7, ix.Len())
+	assert.Len(t, ix.docs, 7)
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`label:"Sex of head" hous* incme~2 -pilot`)
+	assert.NoError(t, err)
+	assert.Equal(t, []Clause{
+		{Field: FieldLabel, Terms: []string{"sex", "of", "head"}},
+		{Terms: []string{"hous"}, Prefix: true},
+		{Terms: []string{"incme"}, Fuzzy: 2},
+		{Terms: []string{"pilot"}, Exclude: true},
+	}, q.Clauses)
+
+	for _, bad := range []string{`colour:red`, `"open phrase`, `income~5`, `two-words*`} {
+		_, err := ParseQuery(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	ix := testIndex()
+
+	var buf bytes.Buffer
+	assert.NoError(t, ix.Save(&buf))
+	loaded, err := Load(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, ix.Len(), loaded.Len())
+
+	want, _ := ix.Search("income", 0)
+	got, _ := loaded.Search("income", 0)
+	assert.Equal(t, want, got)
+
+	path := filepath.Join(t.TempDir(), "mirror.idx")
+	assert.NoError(t, ix.SaveFile(path))
+	fromFile, err := LoadFile(path)
+	assert.NoError(t, err)
+	got, _ = fromFile.Search("income", 0)
+	assert.Equal(t, want, got)
+
+	_, err = LoadFile(filepath.Join(t.TempDir(), "missing.idx"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/northeastloon/nadago/internal/text"
+)
+
+// Clause is one part of a query. Terms holds more than one term for phrases
+type Clause struct {
+	Field   Field
+	Terms   []string
+	Prefix  bool
+	Fuzzy   int
+	Exclude bool
+}
+
+type Query struct {
+	Clauses []Clause
+}
+
+// ParseQuery parses the query syntax accepted by Search. Clauses are separated
+// by spaces and must all match:
+//
+//	income                 term in any field
+//	label:income           term in one field
+//	"household head"       phrase
+//	label:"household head" phrase in one field
+//	hous*                  prefix
+//	incom~ / incme~2       fuzzy term within 1 (or the given) edits
+//	-pilot                 exclude documents matching the clause
+func ParseQuery(q string) (Query, error) {
+	var query Query
+	rest := strings.TrimSpace(q)
+
+	for rest != "" {
+		var c Clause
+		if strings.HasPrefix(rest, "-") {
+			c.Exclude = true
+			rest = rest[1:]
+		}
+
+		// optional field scope
+		if i := strings.IndexFunc(rest, func(r rune) bool { return r == ':' || r == '"' || unicode.IsSpace(r) }); i > 0 && rest[i] == ':' {
+			f := Field(strings.ToLower(rest[:i]))
+			if !knownField(f) {
+				return Query{}, fmt.Errorf("unknown field %q", rest[:i])
+			}
+			c.Field = f
+			rest = rest[i+1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				return Query{}, fmt.Errorf("unterminated phrase in %q", q)
+			}
+			raw = rest[1 : end+1]
+			rest = rest[end+2:]
+			c.Terms = text.Tokenize(raw)
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw = rest[:end]
+			rest = rest[end:]
+
+			if i := strings.LastIndex(raw, "~"); i >= 0 {
+				c.Fuzzy = 1
+				if n := raw[i+1:]; n != "" {
+					d, err := strconv.Atoi(n)
+					if err != nil || d < 1 || d > 2 {
+						return Query{}, fmt.Errorf("fuzzy distance in %q must be 1 or 2", raw)
+					}
+					c.Fuzzy = d
+				}
+				raw = raw[:i]
+			} else if strings.HasSuffix(raw, "*") {
+				c.Prefix = true
+				raw = strings.TrimSuffix(raw, "*")
+			}
+
+			c.Terms = text.Tokenize(raw)
+			if len(c.Terms) > 1 && (c.Prefix || c.Fuzzy > 0) {
+				return Query{}, fmt.Errorf("prefix and fuzzy matching apply to single terms, not %q", raw)
+			}
+		}
+
+		rest = strings.TrimSpace(rest)
+		if len(c.Terms) == 0 {
+			continue
+		}
+		query.Clauses = append(query.Clauses, c)
+	}
+
+	return query, nil
+}
+
+func knownField(f Field) bool {
+	for _, known := range Fields {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
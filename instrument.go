@@ -0,0 +1,79 @@
+package nadago
+
+import (
+	"context"
+	"time"
+)
+
+// RequestRecord describes a completed call to a catalog endpoint
+type RequestRecord struct {
+	Endpoint string
+	Host     string
+	// Status is the final HTTP status code, 0 when no response was received
+	Status   int
+	Duration time.Duration
+	Retries  int
+	// Bytes is the number of response body bytes read by the client
+	Bytes    int64
+	CacheHit bool
+	Err      error
+}
+
+// Metrics receives a record of every request made by a Client. See
+// MetricsRegistry for an implementation with Prometheus and expvar output
+type Metrics interface {
+	ObserveRequest(RequestRecord)
+}
+
+// Attribute is a key value pair attached to a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans around client calls. It is small enough to be adapted
+// to OpenTelemetry or any other tracing library
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// WithMetrics records every request made by the client to m
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) {
+		if m != nil {
+			c.metrics = m
+		}
+	}
+}
+
+// WithTracer starts a span for every call made by the client, named after the
+// endpoint and carrying the idno and vid requested
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		if t != nil {
+			c.tracer = t
+		}
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(RequestRecord) {}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
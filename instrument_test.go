@@ -0,0 +1,140 @@
+package nadago
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMetrics struct {
+	mu      sync.Mutex
+	records []RequestRecord
+}
+
+func (m *recordingMetrics) ObserveRequest(rec RequestRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	s.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return ctx, s
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+func TestInstrumentation(t *testing.T) {
+	var unavailable int32 = 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/X/variables/V1":
+			if atomic.CompareAndSwapInt32(&unavailable, 1, 0) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"variable":{"name":"age"}}`))
+		case "/X/variables":
+			w.Write([]byte(`{"variables":[{"name":"age"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	host, _ := url.Parse(ts.URL)
+
+	metrics := &recordingMetrics{}
+	tracer := &recordingTracer{}
+	client := NewClient(ts.URL, WithMetrics(metrics), WithTracer(tracer), WithCache(time.Minute, 10), WithRetry(1, time.Millisecond))
+	ctx := context.Background()
+
+	_, err := client.GetVarMeta(ctx, "X", "V1")
+	assert.NoError(t, err)
+	_, err = client.GetVarMeta(ctx, "X", "V1")
+	assert.NoError(t, err)
+	_, err = client.GetSurveyMeta(ctx, "MISSING")
+	assert.Error(t, err)
+	// the variable list lacks vids
+	_, err = client.GetSurveyVars(ctx, "X")
+	assert.Error(t, err)
+
+	records := metrics.records
+	assert.Len(t, records, 4)
+	for i := range records {
+		assert.Greater(t, records[i].Duration, time.Duration(0))
+		records[i].Duration = 0
+	}
+	assert.Equal(t, RequestRecord{Endpoint: "variable", Host: host.Host, Status: 200, Retries: 1, Bytes: 27}, records[0])
+	assert.Equal(t, RequestRecord{Endpoint: "variable", Host: host.Host, Status: 200, Bytes: 27, CacheHit: true}, records[1])
+	assert.Equal(t, "study", records[2].Endpoint)
+	assert.Equal(t, 404, records[2].Status)
+	assert.Equal(t, FetchErr{Message: "non-200 status code from the API", StatusCode: 404}, records[2].Err)
+	// decoding succeeded, so the request itself is not an error
+	assert.Equal(t, "variables", records[3].Endpoint)
+	assert.NoError(t, records[3].Err)
+
+	spans := tracer.spans
+	assert.Len(t, spans, 4)
+	assert.Equal(t, "nadago.variable", spans[0].name)
+	assert.Equal(t, map[string]interface{}{
+		"nadago.endpoint":   "variable",
+		"nadago.idno":       "X",
+		"nadago.vid":        "V1",
+		"http.status_code":  200,
+		"nadago.retries":    1,
+		"nadago.cache_hit":  false,
+		"nadago.bytes_read": int64(27),
+	}, spans[0].attrs)
+	assert.True(t, spans[0].ended)
+	assert.Equal(t, true, spans[1].attrs["nadago.cache_hit"])
+	assert.Equal(t, "nadago.study", spans[2].name)
+	assert.Equal(t, "MISSING", spans[2].attrs["nadago.idno"])
+	assert.Equal(t, records[2].Err, spans[2].err)
+
+	t.Run("decode failures are recorded", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("invalid json"))
+		}))
+		defer ts.Close()
+
+		metrics := &recordingMetrics{}
+		client := NewClient(ts.URL, WithMetrics(metrics))
+		_, err := client.Search(ctx, NewDefaultSearchParams())
+		assert.IsType(t, AppErr{}, err)
+		assert.Len(t, metrics.records, 1)
+		assert.Equal(t, "search", metrics.records[0].Endpoint)
+		assert.Equal(t, 200, metrics.records[0].Status)
+		assert.Equal(t, int64(12), metrics.records[0].Bytes)
+		assert.Equal(t, err, metrics.records[0].Err)
+	})
+}
@@ -0,0 +1,95 @@
+// Package fixture builds variables shaped like catalog responses, for the
+// tests of the packages that read them.
+package fixture
+
+import "github.com/northeastloon/nadago"
+
+// Option adds to a variable built by Variable
+type Option func(data, metadata map[string]interface{})
+
+// Variable returns a variable shaped like a GetVarMeta response. It has no
+// categories or statistics unless options add them
+func Variable(idno, vid, name, label string, opts ...Option) nadago.Variable {
+	metadata := map[string]interface{}{
+		"var_catgry":  []interface{}{},
+		"var_sumstat": []interface{}{},
+	}
+	data := map[string]interface{}{
+		"vid":      vid,
+		"name":     name,
+		"labl":     label,
+		"metadata": metadata,
+	}
+	for _, o := range opts {
+		o(data, metadata)
+	}
+	return nadago.Variable{Idno: idno, Vid: vid, Data: data}
+}
+
+// Row returns a variable shaped like a row of a variable list, which has no
+// metadata
+func Row(idno, vid, name, label string) nadago.Variable {
+	return nadago.Variable{Idno: idno, Vid: vid, Data: map[string]interface{}{"vid": vid, "name": name, "labl": label}}
+}
+
+// File sets the data file of the variable
+func File(fid string) Option {
+	return func(data, _ map[string]interface{}) {
+		data["fid"] = fid
+	}
+}
+
+// Question sets the literal question text
+func Question(q string) Option {
+	return func(_, metadata map[string]interface{}) {
+		metadata["var_qstn_qstnlit"] = q
+	}
+}
+
+// Interval sets the measurement interval, "discrete" or "contin"
+func Interval(interval string) Option {
+	return func(_, metadata map[string]interface{}) {
+		metadata["var_intrvl"] = interval
+	}
+}
+
+// Categories adds categories built by Category
+func Categories(cats ...map[string]interface{}) Option {
+	return func(_, metadata map[string]interface{}) {
+		catgry := metadata["var_catgry"].([]interface{})
+		for _, c := range cats {
+			catgry = append(catgry, c)
+		}
+		metadata["var_catgry"] = catgry
+	}
+}
+
+// Labels adds categories valued 1, 2, ... with the given labels and no
+// frequencies
+func Labels(labels ...string) Option {
+	return func(_, metadata map[string]interface{}) {
+		catgry := metadata["var_catgry"].([]interface{})
+		for _, l := range labels {
+			catgry = append(catgry, map[string]interface{}{"value": float64(len(catgry) + 1), "labl": l})
+		}
+		metadata["var_catgry"] = catgry
+	}
+}
+
+// Stat adds an unweighted summary statistic such as "vald"
+func Stat(typ, value string) Option {
+	return func(_, metadata map[string]interface{}) {
+		metadata["var_sumstat"] = append(metadata["var_sumstat"].([]interface{}),
+			map[string]interface{}{"type": typ, "value": value, "wgtd": nil})
+	}
+}
+
+// Category returns a category with its unweighted frequency, or without
+// statistics when freq is empty
+func Category(value, label, freq string) map[string]interface{} {
+	stats := []interface{}{}
+	if freq != "" {
+		stats = append(stats, map[string]interface{}{"type": "freq", "value": freq, "wgtd": nil})
+	}
+	return map[string]interface{}{"value": value, "labl": label, "stats": stats}
+}
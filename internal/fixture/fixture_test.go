@@ -0,0 +1,30 @@
+package fixture
+
+import (
+	"testing"
+
+	"github.com/northeastloon/nadago"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVariable(t *testing.T) {
+	v := Variable("KEN_2021_HFS", "V2", "sex", "Sex", File("F1"), Question("What is your sex?"), Interval("discrete"),
+		Categories(Category("1", "Male", "48"), Category("2", "Female", "")), Labels("Other"), Stat("vald", "100"))
+
+	assert.Equal(t, "KEN_2021_HFS", v.Idno)
+	assert.Equal(t, "sex", v.Name())
+	assert.Equal(t, "Sex", v.Label())
+	assert.Equal(t, "F1", v.FileID())
+	assert.Equal(t, "What is your sex?", v.Question())
+	assert.Equal(t, "discrete", v.Interval())
+	assert.Equal(t, []nadago.Category{
+		{Value: "1", Label: "Male", Stats: []nadago.SumStat{{Type: "freq", Value: "48"}}},
+		{Value: "2", Label: "Female", Stats: []nadago.SumStat{}},
+		{Value: "3", Label: "Other", Stats: []nadago.SumStat{}},
+	}, v.Categories())
+	assert.Equal(t, []nadago.SumStat{{Type: "vald", Value: "100"}}, v.SumStats())
+
+	row := Row("KEN_2021_HFS", "V1", "hhid", "Household id")
+	assert.Equal(t, "hhid", row.Name())
+	assert.Empty(t, row.Categories())
+}
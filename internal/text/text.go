@@ -0,0 +1,139 @@
+// Package text holds the string helpers shared by the packages that search and
+// compare catalog metadata.
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize lower-cases s and splits it into runs of letters and digits
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Levenshtein returns the edit distance between a and b, giving up and
+// returning max+1 once the distance is known to exceed max
+func Levenshtein(a, b string, max int) int {
+	ar, br := []rune(a), []rune(b)
+	if d := len(ar) - len(br); d > max || -d > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < best {
+				best = cur[j]
+			}
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+
+	if prev[len(br)] > max {
+		return max + 1
+	}
+	return prev[len(br)]
+}
+
+// Similarity returns 1 minus the edit distance normalised by the longer string
+func Similarity(a, b string) float64 {
+	n := len([]rune(a))
+	if m := len([]rune(b)); m > n {
+		n = m
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(Levenshtein(a, b, n))/float64(n)
+}
+
+// Jaccard returns the overlap of two token sets
+func Jaccard(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	set := make(map[string]bool, len(a))
+	for _, t := range a {
+		set[t] = true
+	}
+	inter := 0
+	union := len(set)
+	seen := make(map[string]bool, len(b))
+	for _, t := range b {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if set[t] {
+			inter++
+		} else {
+			union++
+		}
+	}
+	return float64(inter) / float64(union)
+}
+
+// Dice returns the Sørensen-Dice coefficient of the character bigrams of a and
+// b, which unlike edit distance is insensitive to the order of word parts
+func Dice(a, b string) float64 {
+	ab, bb := bigrams(a), bigrams(b)
+	if len(ab) == 0 || len(bb) == 0 {
+		if a == b {
+			return 1
+		}
+		return 0
+	}
+
+	counts := make(map[string]int, len(ab))
+	for _, g := range ab {
+		counts[g]++
+	}
+	shared := 0
+	for _, g := range bb {
+		if counts[g] > 0 {
+			counts[g]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(ab)+len(bb))
+}
+
+func bigrams(s string) []string {
+	r := []rune(s)
+	if len(r) < 2 {
+		return nil
+	}
+	out := make([]string, len(r)-1)
+	for i := range out {
+		out[i] = string(r[i : i+2])
+	}
+	return out
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,40 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"sex", "of", "head", "2020"}, Tokenize("Sex of head (2020)"))
+	assert.Equal(t, []string{"área", "de", "résidence"}, Tokenize("Área de résidence"))
+	assert.Empty(t, Tokenize(" -- "))
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, Levenshtein("income", "income", 2))
+	assert.Equal(t, 1, Levenshtein("income", "incme", 2))
+	assert.Equal(t, 2, Levenshtein("househld", "hosehold", 2))
+	assert.Equal(t, 3, Levenshtein("income", "expenditure", 2))
+	assert.Equal(t, 1, Levenshtein("área", "area", 1))
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, float64(1), Similarity("", ""))
+	assert.Equal(t, float64(1), Similarity("hhsize", "hhsize"))
+	assert.InDelta(t, 0.857, Similarity("hh_size", "hhsize"), 0.001)
+}
+
+func TestJaccard(t *testing.T) {
+	assert.Equal(t, float64(0), Jaccard(nil, nil))
+	assert.Equal(t, 0.5, Jaccard([]string{"a", "b"}, []string{"b", "c", "a", "d"}))
+	assert.Equal(t, float64(1), Jaccard([]string{"a", "a"}, []string{"a"}))
+}
+
+func TestDice(t *testing.T) {
+	assert.Equal(t, float64(1), Dice("a", "a"))
+	assert.Equal(t, float64(0), Dice("a", "b"))
+	assert.InDelta(t, 0.833, Dice("headsex", "sexhead"), 0.001)
+	assert.Equal(t, float64(0), Dice("region", "district"))
+}
@@ -0,0 +1,444 @@
+// Package lint checks study and variable metadata taken from a NADA catalog
+// for quality problems, such as missing abstracts, unlabelled variables and
+// frequencies that do not add up, before the metadata is published.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+)
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+	Info    Severity = "info"
+)
+
+// ParseSeverity parses the name of a severity
+func ParseSeverity(s string) (Severity, error) {
+	switch sev := Severity(strings.ToLower(strings.TrimSpace(s))); sev {
+	case Error, Warning, Info:
+		return sev, nil
+	default:
+		return "", fmt.Errorf("unknown severity %q, expected error, warning or info", s)
+	}
+}
+
+func (s Severity) rank() int {
+	switch s {
+	case Error:
+		return 3
+	case Warning:
+		return 2
+	case Info:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Finding is a problem reported by a rule. Vid and Name are empty for
+// problems with the study itself
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Idno     string   `json:"idno"`
+	Vid      string   `json:"vid,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Study is the metadata of a study and its variables, for example as returned
+// by Client.GetStudyDDI or ParseDDI
+type Study struct {
+	Meta      nadago.SurveyMeta
+	Variables []nadago.Variable
+}
+
+// Rule checks a study for one kind of problem. Rules may leave the Rule and
+// Idno of their findings empty, the linter fills them in
+type Rule interface {
+	ID() string
+	Description() string
+	Check(s Study) []Finding
+}
+
+type rule struct {
+	id          string
+	description string
+	check       func(Study) []Finding
+}
+
+// NewRule returns a rule that reports the findings of check
+func NewRule(id, description string, check func(Study) []Finding) Rule {
+	return rule{id: id, description: description, check: check}
+}
+
+func (r rule) ID() string              { return r.id }
+func (r rule) Description() string     { return r.description }
+func (r rule) Check(s Study) []Finding { return r.check(s) }
+
+// DefaultRules returns the rules used by New when it is given none
+func DefaultRules() []Rule {
+	return []Rule{
+		NewRule("missing-abstract", "Studies should have an abstract", missingAbstract),
+		NewRule("missing-sampling", "Studies should describe their sampling procedure", missingSampling),
+		NewRule("unlabeled-variable", "Variables should have a label", unlabeledVariable),
+		NewRule("missing-value-labels", "Categorical variables should have categories, each with a label", missingValueLabels),
+		NewRule("frequency-mismatch", "Category frequencies should sum to the valid count of the variable", frequencyMismatch),
+		NewRule("duplicate-name", "Variable names should be unique within a data file", duplicateName),
+	}
+}
+
+type Linter struct {
+	rules []Rule
+}
+
+// New returns a linter running rules, or DefaultRules if none are given
+func New(rules ...Rule) *Linter {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+	return &Linter{rules: rules}
+}
+
+// Rules returns the rules run by the linter
+func (l *Linter) Rules() []Rule {
+	return l.rules
+}
+
+// Check runs every rule over the studies, reporting findings in the order of
+// the studies and then of the rules
+func (l *Linter) Check(studies ...Study) Report {
+	report := Report{Findings: []Finding{}, rules: l.rules}
+	for _, s := range studies {
+		for _, r := range l.rules {
+			for _, f := range r.Check(s) {
+				if f.Rule == "" {
+					f.Rule = r.ID()
+				}
+				if f.Idno == "" {
+					f.Idno = s.Meta.Idno
+				}
+				if f.Severity == "" {
+					f.Severity = Warning
+				}
+				report.Findings = append(report.Findings, f)
+			}
+		}
+	}
+	return report
+}
+
+func missingAbstract(s Study) []Finding {
+	if strings.TrimSpace(s.Meta.Abstract()) != "" {
+		return nil
+	}
+	return []Finding{{Severity: Warning, Message: "study has no abstract"}}
+}
+
+func missingSampling(s Study) []Finding {
+	if strings.TrimSpace(s.Meta.SamplingProcedure()) != "" {
+		return nil
+	}
+	return []Finding{{Severity: Warning, Message: "study has no sampling procedure"}}
+}
+
+func unlabeledVariable(s Study) []Finding {
+	var findings []Finding
+	for _, v := range s.Variables {
+		if strings.TrimSpace(v.Label()) == "" {
+			findings = append(findings, variableFinding(v, Warning, "variable has no label"))
+		}
+	}
+	return findings
+}
+
+func missingValueLabels(s Study) []Finding {
+	var findings []Finding
+	for _, v := range s.Variables {
+		cats := v.Categories()
+		if len(cats) == 0 && v.Interval() == "discrete" {
+			findings = append(findings, variableFinding(v, Warning, "categorical variable has no value labels"))
+			continue
+		}
+
+		var values []string
+		for _, c := range cats {
+			if strings.TrimSpace(c.Label) == "" {
+				values = append(values, c.Value)
+			}
+		}
+		if len(values) > 0 {
+			findings = append(findings, variableFinding(v, Warning,
+				fmt.Sprintf("categories %s have no value label", strings.Join(values, ", "))))
+		}
+	}
+	return findings
+}
+
+// frequencyMismatch compares the category frequencies of a variable with its
+// valid count. Missing value categories are counted in the frequencies, so a
+// sum equal to the valid and invalid counts together is also accepted
+func frequencyMismatch(s Study) []Finding {
+	var findings []Finding
+	for _, v := range s.Variables {
+		cats := v.Categories()
+		if len(cats) == 0 {
+			continue
+		}
+		valid, ok := sumStat(v, "vald")
+		if !ok {
+			continue
+		}
+
+		var sum float64
+		complete := true
+		for _, c := range cats {
+			freq, ok := c.Frequency()
+			if !ok {
+				complete = false
+				break
+			}
+			sum += freq
+		}
+		if !complete {
+			continue
+		}
+
+		invalid, _ := sumStat(v, "invd")
+		if same(sum, valid) || same(sum, valid+invalid) {
+			continue
+		}
+		findings = append(findings, variableFinding(v, Error,
+			fmt.Sprintf("category frequencies sum to %s but the valid count is %s", number(sum), number(valid))))
+	}
+	return findings
+}
+
+func duplicateName(s Study) []Finding {
+	var findings []Finding
+	seen := map[string]nadago.Variable{}
+	for _, v := range s.Variables {
+		name := strings.TrimSpace(v.Name())
+		if name == "" {
+			continue
+		}
+		key := v.FileID() + "\x00" + strings.ToLower(name)
+		first, ok := seen[key]
+		if !ok {
+			seen[key] = v
+			continue
+		}
+		findings = append(findings, variableFinding(v, Error,
+			fmt.Sprintf("variable name %s is also used by %s", name, first.Vid)))
+	}
+	return findings
+}
+
+func variableFinding(v nadago.Variable, sev Severity, message string) Finding {
+	return Finding{Severity: sev, Idno: v.Idno, Vid: v.Vid, Name: v.Name(), Message: message}
+}
+
+// sumStat returns the unweighted summary statistic of the given type
+func sumStat(v nadago.Variable, typ string) (float64, bool) {
+	for _, s := range v.SumStats() {
+		if s.Type != typ || s.Weighted {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(s.Value), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func same(a, b float64) bool {
+	return math.Abs(a-b) < 0.5
+}
+
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Report holds the findings of a linter run
+type Report struct {
+	Findings []Finding `json:"findings"`
+
+	rules []Rule
+}
+
+// AtLeast reports whether any finding is of severity sev or worse
+func (r Report) AtLeast(sev Severity) bool {
+	for _, f := range r.Findings {
+		if f.Severity.rank() >= sev.rank() {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of findings of severity sev
+func (r Report) Count(sev Severity) int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == sev {
+			n++
+		}
+	}
+	return n
+}
+
+// Text renders the findings for people reading them in a terminal, one per
+// line followed by a summary
+func (r Report) Text() string {
+	var b strings.Builder
+
+	for _, f := range r.Findings {
+		loc := f.Idno
+		if f.Vid != "" {
+			loc += "/" + f.Vid
+		}
+		if f.Name != "" {
+			loc += " (" + f.Name + ")"
+		}
+		fmt.Fprintf(&b, "%s: %s: %s [%s]\n", loc, f.Severity, f.Message, f.Rule)
+	}
+
+	if len(r.Findings) == 0 {
+		b.WriteString("no findings\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d findings: %d errors, %d warnings, %d info\n",
+		len(r.Findings), r.Count(Error), r.Count(Warning), r.Count(Info))
+	return b.String()
+}
+
+// WriteJSON writes the findings as a JSON document
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteSARIF writes the findings as a SARIF 2.1.0 log, so they can be read by
+// tools that collect static analysis results. Studies and variables are
+// reported as logical locations, as they have no source files
+func (r Report) WriteSARIF(w io.Writer) error {
+	rules := make([]sarifRule, 0, len(r.rules))
+	known := map[string]bool{}
+	for _, rl := range r.rules {
+		known[rl.ID()] = true
+		rules = append(rules, sarifRule{ID: rl.ID(), ShortDescription: sarifMessage{Text: rl.Description()}})
+	}
+	var extra []string
+	for _, f := range r.Findings {
+		if !known[f.Rule] {
+			known[f.Rule] = true
+			extra = append(extra, f.Rule)
+		}
+	}
+	sort.Strings(extra)
+	for _, id := range extra {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: id}})
+	}
+
+	results := make([]sarifResult, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		loc := sarifLogicalLocation{Name: f.Idno, FullyQualifiedName: f.Idno, Kind: "study"}
+		if f.Vid != "" {
+			name := f.Name
+			if name == "" {
+				name = f.Vid
+			}
+			loc = sarifLogicalLocation{Name: name, FullyQualifiedName: f.Idno + "/" + f.Vid, Kind: "variable"}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			Level:     sarifLevel(f.Severity),
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{loc}}},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "nadago-lint",
+				InformationURI: "https://github.com/northeastloon/nadago",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+}
+
+func sarifLevel(sev Severity) string {
+	switch sev {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,187 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/fixture"
+	"github.com/stretchr/testify/assert"
+)
+
+const idno = "KEN_2021_HFS_v01_M"
+
+func testMeta(abstract, sampling string) nadago.SurveyMeta {
+	return nadago.SurveyMeta{
+		Idno: idno,
+		Data: map[string]interface{}{
+			"idno": idno,
+			"metadata": map[string]interface{}{
+				"study_desc": map[string]interface{}{
+					"study_info": map[string]interface{}{"abstract": abstract},
+					"method": map[string]interface{}{
+						"data_collection": map[string]interface{}{"sampling_procedure": sampling},
+					},
+				},
+			},
+		},
+	}
+}
+
+// testVariable builds a variable of data file F1, with valid and invalid
+// counts when valid is given
+func testVariable(vid, name, label, valid string, opts ...fixture.Option) nadago.Variable {
+	opts = append(opts, fixture.File("F1"))
+	if valid != "" {
+		opts = append(opts, fixture.Stat("vald", valid), fixture.Stat("invd", "5"))
+	}
+	return fixture.Variable(idno, vid, name, label, opts...)
+}
+
+func testStudy() Study {
+	return Study{
+		Meta: testMeta("", "Two stage stratified sample"),
+		Variables: []nadago.Variable{
+			testVariable("V1", "hhid", "Household ID", "", fixture.Interval("contin")),
+			testVariable("V2", "sex", "", "100", fixture.Interval("discrete"), fixture.Categories(fixture.Category("1", "Male", "48"), fixture.Category("2", "Female", "52"))),
+			testVariable("V3", "q1", "Worked last week", "100", fixture.Categories(fixture.Category("1", "Yes", "60"), fixture.Category("2", "", "30"))),
+			testVariable("V4", "q2", "Looked for work", "100", fixture.Categories(fixture.Category("1", "Yes", "60"), fixture.Category("2", "No", "40"), fixture.Category("9", "Missing", "5"))),
+			testVariable("V5", "Sex", "Sex of member", "", fixture.Interval("discrete")),
+			testVariable("V6", "q3", "Hours worked", "100", fixture.Categories(fixture.Category("1", "Yes", "60"), fixture.Category("2", "No", ""))),
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	report := New().Check(testStudy())
+
+	assert.Equal(t, []Finding{
+		{Rule: "missing-abstract", Severity: Warning, Idno: idno, Message: "study has no abstract"},
+		{Rule: "unlabeled-variable", Severity: Warning, Idno: idno, Vid: "V2", Name: "sex", Message: "variable has no label"},
+		{Rule: "missing-value-labels", Severity: Warning, Idno: idno, Vid: "V3", Name: "q1", Message: "categories 2 have no value label"},
+		{Rule: "missing-value-labels", Severity: Warning, Idno: idno, Vid: "V5", Name: "Sex", Message: "categorical variable has no value labels"},
+		{Rule: "frequency-mismatch", Severity: Error, Idno: idno, Vid: "V3", Name: "q1", Message: "category frequencies sum to 90 but the valid count is 100"},
+		{Rule: "duplicate-name", Severity: Error, Idno: idno, Vid: "V5", Name: "Sex", Message: "variable name Sex is also used by V2"},
+	}, report.Findings)
+
+	assert.True(t, report.AtLeast(Error))
+	assert.True(t, report.AtLeast(Info))
+	assert.Equal(t, 2, report.Count(Error))
+	assert.Equal(t, 4, report.Count(Warning))
+}
+
+func TestCheckClean(t *testing.T) {
+	report := New().Check(Study{
+		Meta:      testMeta("A survey of households", "Simple random sample"),
+		Variables: []nadago.Variable{testVariable("V1", "sex", "Sex", "10", fixture.Categories(fixture.Category("1", "Male", "4"), fixture.Category("2", "Female", "6")))},
+	})
+
+	assert.Empty(t, report.Findings)
+	assert.False(t, report.AtLeast(Info))
+	assert.Equal(t, "no findings\n", report.Text())
+
+	var b bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&b))
+	assert.JSONEq(t, `{"findings":[]}`, b.String())
+}
+
+func TestCustomRule(t *testing.T) {
+	short := NewRule("short-title", "Titles should be descriptive", func(s Study) []Finding {
+		if len(s.Meta.Title()) < 10 {
+			return []Finding{{Message: "title is too short"}}
+		}
+		return nil
+	})
+
+	report := New(short).Check(testStudy())
+	assert.Equal(t, []Finding{
+		{Rule: "short-title", Severity: Warning, Idno: idno, Message: "title is too short"},
+	}, report.Findings)
+	assert.False(t, report.AtLeast(Error))
+
+	rules := append(DefaultRules(), short)
+	assert.Len(t, New(rules...).Rules(), 7)
+}
+
+func TestParseSeverity(t *testing.T) {
+	sev, err := ParseSeverity(" Warning")
+	assert.NoError(t, err)
+	assert.Equal(t, Warning, sev)
+
+	_, err = ParseSeverity("fatal")
+	assert.EqualError(t, err, `unknown severity "fatal", expected error, warning or info`)
+}
+
+func TestText(t *testing.T) {
+	text := New().Check(testStudy()).Text()
+
+	assert.Equal(t, strings.Join([]string{
+		"KEN_2021_HFS_v01_M: warning: study has no abstract [missing-abstract]",
+		"KEN_2021_HFS_v01_M/V2 (sex): warning: variable has no label [unlabeled-variable]",
+		"KEN_2021_HFS_v01_M/V3 (q1): warning: categories 2 have no value label [missing-value-labels]",
+		"KEN_2021_HFS_v01_M/V5 (Sex): warning: categorical variable has no value labels [missing-value-labels]",
+		"KEN_2021_HFS_v01_M/V3 (q1): error: category frequencies sum to 90 but the valid count is 100 [frequency-mismatch]",
+		"KEN_2021_HFS_v01_M/V5 (Sex): error: variable name Sex is also used by V2 [duplicate-name]",
+		"6 findings: 2 errors, 4 warnings, 0 info",
+		"",
+	}, "\n"), text)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, New().Check(testStudy()).WriteJSON(&b))
+
+	var doc struct {
+		Findings []Finding `json:"findings"`
+	}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &doc))
+	assert.Len(t, doc.Findings, 6)
+	assert.Equal(t, Finding{Rule: "frequency-mismatch", Severity: Error, Idno: idno, Vid: "V3", Name: "q1",
+		Message: "category frequencies sum to 90 but the valid count is 100"}, doc.Findings[4])
+}
+
+func TestWriteSARIF(t *testing.T) {
+	extra := NewRule("short-title", "Titles should be descriptive", func(s Study) []Finding {
+		return []Finding{{Rule: "title", Severity: Info, Message: "title is too short"}}
+	})
+
+	var b bytes.Buffer
+	assert.NoError(t, New(DefaultRules()[0], extra).Check(testStudy()).WriteSARIF(&b))
+
+	assert.JSONEq(t, `{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": [{
+			"tool": {"driver": {
+				"name": "nadago-lint",
+				"informationUri": "https://github.com/northeastloon/nadago",
+				"rules": [
+					{"id": "missing-abstract", "shortDescription": {"text": "Studies should have an abstract"}},
+					{"id": "short-title", "shortDescription": {"text": "Titles should be descriptive"}},
+					{"id": "title", "shortDescription": {"text": "title"}}
+				]
+			}},
+			"results": [
+				{
+					"ruleId": "missing-abstract",
+					"level": "warning",
+					"message": {"text": "study has no abstract"},
+					"locations": [{"logicalLocations": [{"name": "KEN_2021_HFS_v01_M", "fullyQualifiedName": "KEN_2021_HFS_v01_M", "kind": "study"}]}]
+				},
+				{
+					"ruleId": "title",
+					"level": "note",
+					"message": {"text": "title is too short"},
+					"locations": [{"logicalLocations": [{"name": "KEN_2021_HFS_v01_M", "fullyQualifiedName": "KEN_2021_HFS_v01_M", "kind": "study"}]}]
+				}
+			]
+		}]
+	}`, b.String())
+
+	b.Reset()
+	assert.NoError(t, New().Check(testStudy()).WriteSARIF(&b))
+	assert.Contains(t, b.String(), `"fullyQualifiedName": "KEN_2021_HFS_v01_M/V5"`)
+	assert.Contains(t, b.String(), `"kind": "variable"`)
+}
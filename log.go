@@ -0,0 +1,90 @@
+package nadago
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// snippetSize is how much of a response body is logged when it cannot be decoded
+const snippetSize = 512
+
+type logLevels struct {
+	success slog.Level
+	retry   slog.Level
+	failure slog.Level
+}
+
+// WithLogger logs every request attempt made by the client with its method,
+// redacted URL, endpoint, duration, status and attempt number. Response bodies
+// that cannot be decoded are logged at debug level
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithLogLevels sets the levels of successful requests, attempts that will be
+// retried and failed requests. The defaults are debug, warn and error
+func WithLogLevels(success, retry, failure slog.Level) Option {
+	return func(c *Client) {
+		c.logLevels = logLevels{success: success, retry: retry, failure: failure}
+	}
+}
+
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if c.logger == nil || !c.logger.Enabled(ctx, level) {
+		return
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// secretParams are query parameters whose values are removed from logged URLs
+var secretParams = map[string]bool{
+	"password": true,
+	"api_key":  true,
+	"apikey":   true,
+	"key":      true,
+	"token":    true,
+}
+
+// redactURL hides passwords in the user info and secret query parameters
+func redactURL(u *url.URL) string {
+	r := *u
+	if r.User != nil {
+		if _, ok := r.User.Password(); ok {
+			r.User = url.UserPassword(r.User.Username(), "REDACTED")
+		}
+	}
+
+	if r.RawQuery != "" {
+		q := r.Query()
+		redacted := false
+		for k := range q {
+			if secretParams[strings.ToLower(k)] {
+				q.Set(k, "REDACTED")
+				redacted = true
+			}
+		}
+		if redacted {
+			r.RawQuery = q.Encode()
+		}
+	}
+	return r.String()
+}
+
+// snippetWriter keeps the first snippetSize bytes written to it
+type snippetWriter struct {
+	buf []byte
+}
+
+func (w *snippetWriter) Write(p []byte) (int, error) {
+	if n := snippetSize - len(w.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		w.buf = append(w.buf, p[:n]...)
+	}
+	return len(p), nil
+}
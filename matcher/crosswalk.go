@@ -0,0 +1,142 @@
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Crosswalk maps harmonised concepts to the variable that measures each of them
+// in every study
+type Crosswalk struct {
+	Concepts []Concept `json:"concepts"`
+}
+
+type Concept struct {
+	Name      string `json:"name"`
+	Label     string `json:"label,omitempty"`
+	Variables []Ref  `json:"variables"`
+}
+
+// Confirm records both sides of a match under the named concept, creating the
+// concept if needed. It fails if either study is already mapped to a different
+// variable for the concept
+func (c *Crosswalk) Confirm(concept string, m Match) error {
+	k := c.concept(concept)
+
+	// check both sides before changing anything, so a conflict leaves the
+	// crosswalk as it was
+	var add []Ref
+	for _, ref := range []Ref{m.Source, m.Target} {
+		var existing Ref
+		ok := false
+		if k != nil {
+			existing, ok = k.lookup(ref.Idno)
+		}
+		for _, a := range add {
+			if !ok && a.Idno == ref.Idno {
+				existing, ok = a, true
+			}
+		}
+		if !ok {
+			add = append(add, ref)
+			continue
+		}
+		if existing.Vid != ref.Vid {
+			return fmt.Errorf("concept %s is already mapped to %s in %s", concept, existing.Name, ref.Idno)
+		}
+	}
+
+	if k == nil {
+		c.Concepts = append(c.Concepts, Concept{Name: concept, Label: m.Source.Label})
+		k = &c.Concepts[len(c.Concepts)-1]
+	}
+	k.Variables = append(k.Variables, add...)
+	return nil
+}
+
+// Lookup returns the variable for a concept in a study
+func (c *Crosswalk) Lookup(concept, idno string) (Ref, bool) {
+	k := c.concept(concept)
+	if k == nil {
+		return Ref{}, false
+	}
+	return k.lookup(idno)
+}
+
+// ConceptOf returns the concept a variable has been confirmed for
+func (c *Crosswalk) ConceptOf(idno, vid string) (string, bool) {
+	for _, k := range c.Concepts {
+		if ref, ok := k.lookup(idno); ok && ref.Vid == vid {
+			return k.Name, true
+		}
+	}
+	return "", false
+}
+
+func (c *Crosswalk) concept(name string) *Concept {
+	for i := range c.Concepts {
+		if c.Concepts[i].Name == name {
+			return &c.Concepts[i]
+		}
+	}
+	return nil
+}
+
+func (k Concept) lookup(idno string) (Ref, bool) {
+	for _, ref := range k.Variables {
+		if ref.Idno == idno {
+			return ref, true
+		}
+	}
+	return Ref{}, false
+}
+
+func (c *Crosswalk) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+func LoadCrosswalk(r io.Reader) (*Crosswalk, error) {
+	var c Crosswalk
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveFile saves the crosswalk to path, replacing any existing file only once
+// the crosswalk has been written completely
+func (c *Crosswalk) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".crosswalk-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := c.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCrosswalkFile loads a crosswalk saved with SaveFile. A missing file gives
+// an empty crosswalk so one can be built up over several sessions
+func LoadCrosswalkFile(path string) (*Crosswalk, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Crosswalk{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadCrosswalk(f)
+}
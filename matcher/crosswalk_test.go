@@ -0,0 +1,69 @@
+package matcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCrosswalk(t *testing.T) {
+	matches := New(WithLimit(1)).Match(kenya, uganda)
+
+	var cw Crosswalk
+	assert.NoError(t, cw.Confirm("household_size", matches[0]))
+	assert.NoError(t, cw.Confirm("head_sex", matches[1]))
+	// confirming the same pair again is a no-op
+	assert.NoError(t, cw.Confirm("household_size", matches[0]))
+
+	ref, ok := cw.Lookup("household_size", "UGA_2020")
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Idno: "UGA_2020", Vid: "V10", Name: "hhsize", Label: "Size of the household"}, ref)
+	assert.Equal(t, "Household size", cw.Concepts[0].Label)
+
+	_, ok = cw.Lookup("household_size", "TZA_2019")
+	assert.False(t, ok)
+
+	concept, ok := cw.ConceptOf("KEN_2021", "V2")
+	assert.True(t, ok)
+	assert.Equal(t, "head_sex", concept)
+
+	err := cw.Confirm("household_size", Match{Source: RefOf(kenya[2]), Target: RefOf(uganda[0])})
+	assert.EqualError(t, err, "concept household_size is already mapped to hh_size in KEN_2021")
+
+	t.Run("conflicts leave the crosswalk unchanged", func(t *testing.T) {
+		before, err := json.Marshal(cw)
+		assert.NoError(t, err)
+
+		tanzania := Ref{Idno: "TZA_2019", Vid: "V7", Name: "hh_members", Label: "Household members"}
+		err = cw.Confirm("household_size", Match{Source: tanzania, Target: RefOf(uganda[2])})
+		assert.EqualError(t, err, "concept household_size is already mapped to hhsize in UGA_2020")
+
+		err = cw.Confirm("region", Match{Source: tanzania, Target: Ref{Idno: "TZA_2019", Vid: "V8", Name: "region"}})
+		assert.EqualError(t, err, "concept region is already mapped to hh_members in TZA_2019")
+
+		after, err := json.Marshal(cw)
+		assert.NoError(t, err)
+		assert.JSONEq(t, string(before), string(after))
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.NoError(t, cw.Save(&buf))
+		loaded, err := LoadCrosswalk(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, cw, *loaded)
+
+		path := filepath.Join(t.TempDir(), "crosswalk.json")
+		empty, err := LoadCrosswalkFile(path)
+		assert.NoError(t, err)
+		assert.Empty(t, empty.Concepts)
+
+		assert.NoError(t, cw.SaveFile(path))
+		loaded, err = LoadCrosswalkFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, cw, *loaded)
+	})
+}
@@ -0,0 +1,288 @@
+// Package matcher finds variables measuring the same concept across studies,
+// scoring candidate pairs on their names, labels, question text and value
+// labels. Confirmed matches are collected into a Crosswalk that can be saved
+// and reused for harmonisation.
+package matcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/text"
+)
+
+// Weights sets how much each signal contributes to a match score. Signals that
+// cannot be computed for a pair, such as questions missing on either side, are
+// left out and the remaining weights rescaled
+type Weights struct {
+	Name       float64
+	Label      float64
+	Question   float64
+	Categories float64
+}
+
+var DefaultWeights = Weights{Name: 0.2, Label: 0.35, Question: 0.2, Categories: 0.25}
+
+// Ref identifies a variable within a study
+type Ref struct {
+	Idno  string `json:"idno"`
+	Vid   string `json:"vid"`
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+}
+
+func RefOf(v nadago.Variable) Ref {
+	return Ref{Idno: v.Idno, Vid: v.Vid, Name: v.Name(), Label: v.Label()}
+}
+
+// Signal is the contribution of one field to a match score
+type Signal struct {
+	Field  string
+	Score  float64
+	Weight float64
+	Detail string
+}
+
+type Match struct {
+	Source  Ref
+	Target  Ref
+	Score   float64
+	Signals []Signal
+}
+
+// Explain describes how the score was reached, strongest signal first
+func (m Match) Explain() string {
+	signals := append([]Signal{}, m.Signals...)
+	sort.SliceStable(signals, func(i, j int) bool {
+		return signals[i].Score*signals[i].Weight > signals[j].Score*signals[j].Weight
+	})
+
+	parts := make([]string, len(signals))
+	for i, s := range signals {
+		parts[i] = fmt.Sprintf("%s %.2f (%s)", s.Field, s.Score, s.Detail)
+	}
+	return fmt.Sprintf("%s/%s -> %s/%s %.2f: %s", m.Source.Idno, m.Source.Name, m.Target.Idno, m.Target.Name, m.Score, strings.Join(parts, "; "))
+}
+
+type Matcher struct {
+	weights   Weights
+	threshold float64
+	limit     int
+}
+
+type Option func(m *Matcher)
+
+func WithWeights(w Weights) Option {
+	return func(m *Matcher) {
+		m.weights = w
+	}
+}
+
+// WithThreshold sets the minimum score of returned matches. The default is 0.5
+func WithThreshold(t float64) Option {
+	return func(m *Matcher) {
+		m.threshold = t
+	}
+}
+
+// WithLimit sets how many candidates are returned per source variable. The
+// default is 3 and zero returns every candidate above the threshold
+func WithLimit(n int) Option {
+	return func(m *Matcher) {
+		m.limit = n
+	}
+}
+
+func New(opts ...Option) *Matcher {
+	m := &Matcher{weights: DefaultWeights, threshold: 0.5, limit: 3}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Match scores every pair of source and target variables and returns, for each
+// source variable in order, its best candidates
+func (m *Matcher) Match(source, target []nadago.Variable) []Match {
+	targets := make([]features, len(target))
+	for i, v := range target {
+		targets[i] = featuresOf(v)
+	}
+
+	var matches []Match
+	for _, sv := range source {
+		sf := featuresOf(sv)
+
+		var candidates []Match
+		for _, tf := range targets {
+			if match := m.score(sf, tf); match.Score >= m.threshold {
+				candidates = append(candidates, match)
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Score > candidates[j].Score
+		})
+		if m.limit > 0 && len(candidates) > m.limit {
+			candidates = candidates[:m.limit]
+		}
+		matches = append(matches, candidates...)
+	}
+	return matches
+}
+
+// MatchStudies matches the variables of every pair of studies, each study
+// matched against those after it
+func (m *Matcher) MatchStudies(studies ...[]nadago.Variable) []Match {
+	var matches []Match
+	for i := range studies {
+		for j := i + 1; j < len(studies); j++ {
+			matches = append(matches, m.Match(studies[i], studies[j])...)
+		}
+	}
+	return matches
+}
+
+// Score scores a single pair of variables
+func (m *Matcher) Score(a, b nadago.Variable) Match {
+	return m.score(featuresOf(a), featuresOf(b))
+}
+
+type features struct {
+	ref      Ref
+	name     string
+	label    []string
+	question []string
+	cats     []string
+}
+
+func featuresOf(v nadago.Variable) features {
+	f := features{
+		ref:      RefOf(v),
+		name:     normalizeName(v.Name()),
+		label:    words(v.Label()),
+		question: words(v.Question()),
+	}
+	for _, c := range v.Categories() {
+		if l := strings.Join(text.Tokenize(c.Label), " "); l != "" {
+			f.cats = append(f.cats, l)
+		}
+	}
+	return f
+}
+
+func (m *Matcher) score(a, b features) Match {
+	match := Match{Source: a.ref, Target: b.ref}
+
+	if a.name != "" && b.name != "" {
+		// edit distance catches abbreviations, bigrams catch reordered parts
+		score := text.Similarity(a.name, b.name)
+		if d := text.Dice(a.name, b.name); d > score {
+			score = d
+		}
+		match.Signals = append(match.Signals, Signal{
+			Field:  "name",
+			Score:  score,
+			Weight: m.weights.Name,
+			Detail: fmt.Sprintf("%q vs %q", a.ref.Name, b.ref.Name),
+		})
+	}
+	if len(a.label) > 0 && len(b.label) > 0 {
+		match.Signals = append(match.Signals, wordSignal("label", a.label, b.label, m.weights.Label))
+	}
+	if len(a.question) > 0 && len(b.question) > 0 {
+		match.Signals = append(match.Signals, wordSignal("question", a.question, b.question, m.weights.Question))
+	}
+	if len(a.cats) > 0 || len(b.cats) > 0 {
+		match.Signals = append(match.Signals, categorySignal(a.cats, b.cats, m.weights.Categories))
+	}
+
+	var total, weights float64
+	for _, s := range match.Signals {
+		total += s.Score * s.Weight
+		weights += s.Weight
+	}
+	if weights > 0 {
+		match.Score = total / weights
+	}
+	return match
+}
+
+func wordSignal(field string, a, b []string, weight float64) Signal {
+	shared := intersect(a, b)
+	detail := "no shared words"
+	if len(shared) > 0 {
+		detail = "shared: " + strings.Join(shared, ", ")
+	}
+	return Signal{Field: field, Score: text.Jaccard(a, b), Weight: weight, Detail: detail}
+}
+
+// categorySignal pairs each value label with its closest counterpart, so sets
+// that differ in spelling or order still score highly
+func categorySignal(a, b []string, weight float64) Signal {
+	s := Signal{Field: "categories", Weight: weight}
+	if len(a) == 0 || len(b) == 0 {
+		s.Detail = "only one variable has value labels"
+		return s
+	}
+
+	matched := 0
+	var total float64
+	for _, la := range a {
+		best := 0.0
+		for _, lb := range b {
+			if sim := text.Similarity(la, lb); sim > best {
+				best = sim
+			}
+		}
+		total += best
+		if best >= 0.8 {
+			matched++
+		}
+	}
+
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	s.Score = total / float64(n)
+	s.Detail = fmt.Sprintf("%d of %d value labels match", matched, n)
+	return s
+}
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "do": true, "does": true, "for": true, "in": true,
+	"is": true, "of": true, "or": true, "the": true, "to": true, "what": true, "you": true, "your": true,
+}
+
+func words(s string) []string {
+	var out []string
+	for _, t := range text.Tokenize(s) {
+		if !stopwords[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// normalizeName drops case and separators so hh_size and HHSize compare equal
+func normalizeName(s string) string {
+	return strings.Join(text.Tokenize(s), "")
+}
+
+func intersect(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, t := range b {
+		set[t] = true
+	}
+	var out []string
+	for _, t := range a {
+		if set[t] {
+			out = append(out, t)
+			delete(set, t)
+		}
+	}
+	return out
+}
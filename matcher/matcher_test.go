@@ -0,0 +1,84 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/fixture"
+	"github.com/stretchr/testify/assert"
+)
+
+var kenya = []nadago.Variable{
+	fixture.Variable("KEN_2021", "V1", "hh_size", "Household size", fixture.Question("How many people live in this household?")),
+	fixture.Variable("KEN_2021", "V2", "head_sex", "Sex of household head", fixture.Labels("Male", "Female")),
+	fixture.Variable("KEN_2021", "V3", "region", "Region of residence"),
+}
+
+var uganda = []nadago.Variable{
+	fixture.Variable("UGA_2020", "V10", "hhsize", "Size of the household", fixture.Question("How many people usually live in this household?")),
+	fixture.Variable("UGA_2020", "V11", "sexhead", "Head of household sex", fixture.Labels("male", "female")),
+	fixture.Variable("UGA_2020", "V12", "district", "District"),
+}
+
+func TestMatch(t *testing.T) {
+	matches := New(WithLimit(1)).Match(kenya, uganda)
+	assert.Len(t, matches, 2)
+
+	assert.Equal(t, "hh_size", matches[0].Source.Name)
+	assert.Equal(t, "hhsize", matches[0].Target.Name)
+	assert.Equal(t, "V10", matches[0].Target.Vid)
+
+	assert.Equal(t, "head_sex", matches[1].Source.Name)
+	assert.Equal(t, "sexhead", matches[1].Target.Name)
+	assert.Greater(t, matches[1].Score, 0.7)
+
+	t.Run("threshold and limit", func(t *testing.T) {
+		all := New(WithThreshold(0), WithLimit(0)).Match(kenya, uganda)
+		assert.Len(t, all, 9)
+		assert.Empty(t, New(WithThreshold(1.01)).Match(kenya, uganda))
+	})
+
+	t.Run("several studies", func(t *testing.T) {
+		third := []nadago.Variable{fixture.Variable("TZA_2019", "V1", "hhsize", "Household size")}
+		matches := New(WithLimit(1)).MatchStudies(kenya, uganda, third)
+		var pairs []string
+		for _, m := range matches {
+			pairs = append(pairs, m.Source.Idno+">"+m.Target.Idno+":"+m.Source.Name)
+		}
+		assert.Equal(t, []string{
+			"KEN_2021>UGA_2020:hh_size", "KEN_2021>UGA_2020:head_sex",
+			"KEN_2021>TZA_2019:hh_size",
+			"UGA_2020>TZA_2019:hhsize",
+		}, pairs)
+	})
+}
+
+func TestScore(t *testing.T) {
+	m := New().Score(kenya[1], uganda[1])
+
+	fields := map[string]Signal{}
+	for _, s := range m.Signals {
+		fields[s.Field] = s
+	}
+	// neither variable has a question, so that signal is left out
+	assert.NotContains(t, fields, "question")
+	assert.Equal(t, 1.0, fields["label"].Score)
+	assert.Equal(t, "shared: sex, household, head", fields["label"].Detail)
+	assert.Equal(t, 1.0, fields["categories"].Score)
+	assert.Equal(t, "2 of 2 value labels match", fields["categories"].Detail)
+
+	assert.Equal(t,
+		`KEN_2021/head_sex -> UGA_2020/sexhead 0.96: label 1.00 (shared: sex, household, head); categories 1.00 (2 of 2 value labels match); name 0.83 ("head_sex" vs "sexhead")`,
+		m.Explain())
+
+	t.Run("value labels on one side", func(t *testing.T) {
+		m := New().Score(kenya[0], uganda[1])
+		assert.Equal(t, "only one variable has value labels", m.Signals[len(m.Signals)-1].Detail)
+		assert.Less(t, m.Score, 0.5)
+	})
+
+	t.Run("weights", func(t *testing.T) {
+		m := New(WithWeights(Weights{Name: 1})).Score(kenya[0], uganda[0])
+		assert.Equal(t, 1.0, m.Score)
+	})
+}
@@ -0,0 +1,187 @@
+package nadago
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the request
+// duration histogram
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsRegistry aggregates request records per catalog host and endpoint. It
+// writes the Prometheus text exposition format, serves it over HTTP and
+// implements expvar.Var, so it can be published with expvar.Publish
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[seriesKey]*EndpointMetrics
+}
+
+type seriesKey struct {
+	host     string
+	endpoint string
+}
+
+// EndpointMetrics are the totals recorded for one endpoint of a catalog
+type EndpointMetrics struct {
+	Host      string           `json:"host"`
+	Endpoint  string           `json:"endpoint"`
+	Requests  int64            `json:"requests"`
+	Errors    int64            `json:"errors"`
+	Statuses  map[string]int64 `json:"statuses"`
+	Retries   int64            `json:"retries"`
+	Bytes     int64            `json:"bytes"`
+	CacheHits int64            `json:"cache_hits"`
+	// Seconds is the total duration of the requests
+	Seconds float64 `json:"seconds"`
+	// Buckets counts requests by the first latency bucket they fall in, with
+	// a final bucket for slower requests
+	Buckets []int64 `json:"buckets"`
+}
+
+// NewMetricsRegistry creates a registry using buckets as the latency histogram
+// bounds in seconds, or DefaultLatencyBuckets when none are given
+func NewMetricsRegistry(buckets ...float64) *MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &MetricsRegistry{buckets: b, series: map[seriesKey]*EndpointMetrics{}}
+}
+
+func (r *MetricsRegistry) ObserveRequest(rec RequestRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := seriesKey{host: rec.Host, endpoint: rec.Endpoint}
+	m, ok := r.series[key]
+	if !ok {
+		m = &EndpointMetrics{
+			Host:     rec.Host,
+			Endpoint: rec.Endpoint,
+			Statuses: map[string]int64{},
+			Buckets:  make([]int64, len(r.buckets)+1),
+		}
+		r.series[key] = m
+	}
+
+	m.Requests++
+	if rec.Err != nil {
+		m.Errors++
+	}
+	m.Statuses[statusLabel(rec.Status)]++
+	m.Retries += int64(rec.Retries)
+	m.Bytes += rec.Bytes
+	if rec.CacheHit {
+		m.CacheHits++
+	}
+	seconds := rec.Duration.Seconds()
+	m.Seconds += seconds
+	m.Buckets[sort.SearchFloat64s(r.buckets, seconds)]++
+}
+
+// Snapshot returns a copy of the metrics, ordered by host and endpoint
+func (r *MetricsRegistry) Snapshot() []EndpointMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]EndpointMetrics, 0, len(r.series))
+	for _, m := range r.series {
+		c := *m
+		c.Statuses = make(map[string]int64, len(m.Statuses))
+		for k, v := range m.Statuses {
+			c.Statuses[k] = v
+		}
+		c.Buckets = append([]int64(nil), m.Buckets...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		return out[i].Endpoint < out[j].Endpoint
+	})
+	return out
+}
+
+// String returns the snapshot as JSON, for expvar
+func (r *MetricsRegistry) String() string {
+	b, _ := json.Marshal(r.Snapshot())
+	return string(b)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	snapshot := r.Snapshot()
+	bw := bufio.NewWriter(w)
+
+	family := func(name, typ, help string, write func(m EndpointMetrics, labels string)) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, m := range snapshot {
+			write(m, fmt.Sprintf(`host="%s",endpoint="%s"`, escapeLabel(m.Host), escapeLabel(m.Endpoint)))
+		}
+	}
+
+	family("nadago_requests_total", "counter", "Requests to catalog endpoints by response status.", func(m EndpointMetrics, labels string) {
+		statuses := make([]string, 0, len(m.Statuses))
+		for s := range m.Statuses {
+			statuses = append(statuses, s)
+		}
+		sort.Strings(statuses)
+		for _, s := range statuses {
+			fmt.Fprintf(bw, "nadago_requests_total{%s,status=\"%s\"} %d\n", labels, s, m.Statuses[s])
+		}
+	})
+	family("nadago_request_errors_total", "counter", "Requests that returned an error.", func(m EndpointMetrics, labels string) {
+		fmt.Fprintf(bw, "nadago_request_errors_total{%s} %d\n", labels, m.Errors)
+	})
+	family("nadago_request_duration_seconds", "histogram", "Duration of requests including retries.", func(m EndpointMetrics, labels string) {
+		var cumulative int64
+		for i, bound := range r.buckets {
+			cumulative += m.Buckets[i]
+			fmt.Fprintf(bw, "nadago_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(bw, "nadago_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, m.Requests)
+		fmt.Fprintf(bw, "nadago_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(m.Seconds, 'g', -1, 64))
+		fmt.Fprintf(bw, "nadago_request_duration_seconds_count{%s} %d\n", labels, m.Requests)
+	})
+	family("nadago_request_retries_total", "counter", "Retried request attempts.", func(m EndpointMetrics, labels string) {
+		fmt.Fprintf(bw, "nadago_request_retries_total{%s} %d\n", labels, m.Retries)
+	})
+	family("nadago_response_bytes_total", "counter", "Response body bytes read.", func(m EndpointMetrics, labels string) {
+		fmt.Fprintf(bw, "nadago_response_bytes_total{%s} %d\n", labels, m.Bytes)
+	})
+	family("nadago_cache_hits_total", "counter", "Requests answered from the response cache.", func(m EndpointMetrics, labels string) {
+		fmt.Fprintf(bw, "nadago_cache_hits_total{%s} %d\n", labels, m.CacheHits)
+	})
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WritePrometheus(w)
+}
+
+func statusLabel(status int) string {
+	if status == 0 {
+		return "error"
+	}
+	return strconv.Itoa(status)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
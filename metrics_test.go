@@ -0,0 +1,73 @@
+package nadago
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	r := NewMetricsRegistry(0.1, 1)
+	r.ObserveRequest(RequestRecord{Endpoint: "search", Host: "catalog.ihsn.org", Status: 200, Duration: 50 * time.Millisecond, Bytes: 100})
+	r.ObserveRequest(RequestRecord{Endpoint: "search", Host: "catalog.ihsn.org", Status: 200, Duration: 500 * time.Millisecond, Bytes: 50, CacheHit: true})
+	r.ObserveRequest(RequestRecord{Endpoint: "search", Host: "catalog.ihsn.org", Status: 503, Duration: 2 * time.Second, Retries: 2, Err: errors.New("unavailable")})
+	r.ObserveRequest(RequestRecord{Endpoint: "variable", Host: `odd"host`, Duration: time.Second, Err: errors.New("timeout")})
+
+	t.Run("snapshot", func(t *testing.T) {
+		snapshot := r.Snapshot()
+		assert.Len(t, snapshot, 2)
+		assert.Equal(t, EndpointMetrics{
+			Host:      "catalog.ihsn.org",
+			Endpoint:  "search",
+			Requests:  3,
+			Errors:    1,
+			Statuses:  map[string]int64{"200": 2, "503": 1},
+			Retries:   2,
+			Bytes:     150,
+			CacheHits: 1,
+			Seconds:   2.55,
+			Buckets:   []int64{1, 1, 1},
+		}, snapshot[0])
+		assert.Equal(t, map[string]int64{"error": 1}, snapshot[1].Statuses)
+	})
+
+	t.Run("prometheus", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		out := rec.Body.String()
+		for _, line := range []string{
+			"# TYPE nadago_requests_total counter",
+			`nadago_requests_total{host="catalog.ihsn.org",endpoint="search",status="200"} 2`,
+			`nadago_requests_total{host="catalog.ihsn.org",endpoint="search",status="503"} 1`,
+			`nadago_requests_total{host="odd\"host",endpoint="variable",status="error"} 1`,
+			`nadago_request_errors_total{host="catalog.ihsn.org",endpoint="search"} 1`,
+			"# TYPE nadago_request_duration_seconds histogram",
+			`nadago_request_duration_seconds_bucket{host="catalog.ihsn.org",endpoint="search",le="0.1"} 1`,
+			`nadago_request_duration_seconds_bucket{host="catalog.ihsn.org",endpoint="search",le="1"} 2`,
+			`nadago_request_duration_seconds_bucket{host="catalog.ihsn.org",endpoint="search",le="+Inf"} 3`,
+			`nadago_request_duration_seconds_sum{host="catalog.ihsn.org",endpoint="search"} 2.55`,
+			`nadago_request_duration_seconds_count{host="catalog.ihsn.org",endpoint="search"} 3`,
+			`nadago_request_retries_total{host="catalog.ihsn.org",endpoint="search"} 2`,
+			`nadago_response_bytes_total{host="catalog.ihsn.org",endpoint="search"} 150`,
+			`nadago_cache_hits_total{host="catalog.ihsn.org",endpoint="search"} 1`,
+		} {
+			assert.Contains(t, strings.Split(out, "\n"), line)
+		}
+	})
+
+	t.Run("expvar", func(t *testing.T) {
+		var v expvar.Var = r
+		var snapshot []EndpointMetrics
+		assert.NoError(t, json.Unmarshal([]byte(v.String()), &snapshot))
+		assert.Equal(t, r.Snapshot(), snapshot)
+	})
+}
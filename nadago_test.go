@@ -33,7 +33,7 @@ func testSearchForEndpoint(t *testing.T, endpoint string) {
 	params.Ps = 2
 	params.From = 2020
 	params.To = 2020
-	params.Country = "ZAF"
+	params.Country = []string{"ZAF"}
 
 	surveys, err := client.Search(ctx, params)
 	if err != nil {
@@ -0,0 +1,323 @@
+package nadago
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query builds SearchParams fluently. Keyword terms are combined using the
+// boolean full-text syntax of the sk parameter: required terms are prefixed
+// with +, excluded terms with -, alternatives are grouped in parentheses and
+// phrases are quoted
+type Query struct {
+	all         []string
+	any         [][]string
+	not         []string
+	phrases     []string
+	countries   []string
+	from        int
+	to          int
+	created     time.Time
+	collections []string
+	dtypes      []DataAccessType
+	types       []DatasetType
+	sortBy      SortField
+	sortOrder   SortOrder
+	ps          int
+	page        int
+}
+
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// All requires every term to match
+func (q *Query) All(terms ...string) *Query {
+	q.all = append(q.all, cleanTerms(terms)...)
+	return q
+}
+
+// Any requires at least one of the terms to match. Each call adds a separate group
+func (q *Query) Any(terms ...string) *Query {
+	if t := cleanTerms(terms); len(t) > 0 {
+		q.any = append(q.any, t)
+	}
+	return q
+}
+
+// Not excludes studies matching any of the terms
+func (q *Query) Not(terms ...string) *Query {
+	q.not = append(q.not, cleanTerms(terms)...)
+	return q
+}
+
+// Phrase requires the words to appear together in order
+func (q *Query) Phrase(phrase string) *Query {
+	if p := cleanTerm(phrase); p != "" {
+		q.phrases = append(q.phrases, p)
+	}
+	return q
+}
+
+func (q *Query) Countries(codes ...string) *Query {
+	q.countries = append(q.countries, codes...)
+	return q
+}
+
+func (q *Query) Years(from, to int) *Query {
+	q.from, q.to = from, to
+	return q
+}
+
+func (q *Query) CreatedAfter(t time.Time) *Query {
+	q.created = t
+	return q
+}
+
+func (q *Query) Collections(ids ...string) *Query {
+	q.collections = append(q.collections, ids...)
+	return q
+}
+
+func (q *Query) AccessTypes(types ...DataAccessType) *Query {
+	q.dtypes = append(q.dtypes, types...)
+	return q
+}
+
+func (q *Query) Types(types ...DatasetType) *Query {
+	q.types = append(q.types, types...)
+	return q
+}
+
+func (q *Query) SortBy(field SortField, order SortOrder) *Query {
+	q.sortBy, q.sortOrder = field, order
+	return q
+}
+
+func (q *Query) PageSize(n int) *Query {
+	q.ps = n
+	return q
+}
+
+func (q *Query) Page(n int) *Query {
+	q.page = n
+	return q
+}
+
+// Keywords renders the keyword terms as the value of the sk parameter
+func (q *Query) Keywords() string {
+	var parts []string
+	for _, t := range q.all {
+		parts = append(parts, "+"+quoteTerm(t))
+	}
+	for _, p := range q.phrases {
+		parts = append(parts, `+"`+p+`"`)
+	}
+	for _, group := range q.any {
+		if len(group) == 1 {
+			parts = append(parts, "+"+quoteTerm(group[0]))
+			continue
+		}
+		quoted := make([]string, len(group))
+		for i, t := range group {
+			quoted[i] = quoteTerm(t)
+		}
+		parts = append(parts, "+("+strings.Join(quoted, " ")+")")
+	}
+	for _, t := range q.not {
+		parts = append(parts, "-"+quoteTerm(t))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Params returns validated SearchParams for the query, starting from the defaults
+func (q *Query) Params() (*SearchParams, error) {
+	p := NewDefaultSearchParams()
+	p.Keywords = q.Keywords()
+	p.From = q.from
+	p.To = q.to
+	p.Country = q.countries
+	p.Created = q.created
+	p.Collection = q.collections
+	p.Dtype = q.dtypes
+	p.Type = q.types
+	if q.sortBy != "" {
+		p.Sort_by = q.sortBy
+	}
+	if q.sortOrder != "" {
+		p.Sort_order = q.sortOrder
+	}
+	if q.ps != 0 {
+		p.Ps = q.ps
+	}
+	if q.page != 0 {
+		p.Page = q.page
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Search runs the query against the client
+func (q *Query) Search(ctx context.Context, c *Client) ([]Survey, error) {
+	p, err := q.Params()
+	if err != nil {
+		return []Survey{}, err
+	}
+	return c.Search(ctx, p)
+}
+
+// String serialises the query into a compact form that ParseQuery accepts,
+// suitable for saving searches
+func (q *Query) String() string {
+	v := url.Values{}
+	for _, t := range q.all {
+		v.Add("all", t)
+	}
+	for _, g := range q.any {
+		v.Add("any", strings.Join(g, "|"))
+	}
+	for _, t := range q.not {
+		v.Add("not", t)
+	}
+	for _, p := range q.phrases {
+		v.Add("phrase", p)
+	}
+	for _, c := range q.countries {
+		v.Add("country", c)
+	}
+	if q.from != 0 {
+		v.Set("from", strconv.Itoa(q.from))
+	}
+	if q.to != 0 {
+		v.Set("to", strconv.Itoa(q.to))
+	}
+	if !q.created.IsZero() {
+		v.Set("created", q.created.Format("2006-01-02"))
+	}
+	for _, c := range q.collections {
+		v.Add("collection", c)
+	}
+	for _, d := range q.dtypes {
+		v.Add("dtype", string(d))
+	}
+	for _, t := range q.types {
+		v.Add("type", string(t))
+	}
+	if q.sortBy != "" || q.sortOrder != "" {
+		v.Set("sort", string(q.sortBy)+":"+string(q.sortOrder))
+	}
+	if q.ps != 0 {
+		v.Set("ps", strconv.Itoa(q.ps))
+	}
+	if q.page != 0 {
+		v.Set("page", strconv.Itoa(q.page))
+	}
+	return v.Encode()
+}
+
+// ParseQuery restores a query serialised with Query.String
+func ParseQuery(s string) (*Query, error) {
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, AppErr{
+			Message:    fmt.Errorf("failed to parse query. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+
+	q := NewQuery()
+	for key, values := range v {
+		switch key {
+		case "all":
+			q.All(values...)
+		case "any":
+			for _, g := range values {
+				q.Any(strings.Split(g, "|")...)
+			}
+		case "not":
+			q.Not(values...)
+		case "phrase":
+			for _, p := range values {
+				q.Phrase(p)
+			}
+		case "country":
+			q.Countries(values...)
+		case "collection":
+			q.Collections(values...)
+		case "dtype":
+			for _, d := range values {
+				q.AccessTypes(DataAccessType(d))
+			}
+		case "type":
+			for _, t := range values {
+				q.Types(DatasetType(t))
+			}
+		case "from", "to", "ps", "page":
+			n, err := strconv.Atoi(v.Get(key))
+			if err != nil {
+				return nil, ValidationErr{Field: key, Message: fmt.Sprintf("%q is not a number", v.Get(key))}
+			}
+			switch key {
+			case "from":
+				q.from = n
+			case "to":
+				q.to = n
+			case "ps":
+				q.ps = n
+			case "page":
+				q.page = n
+			}
+		case "created":
+			t, err := time.Parse("2006-01-02", v.Get(key))
+			if err != nil {
+				return nil, ValidationErr{Field: key, Message: fmt.Sprintf("%q is not a YYYY-MM-DD date", v.Get(key))}
+			}
+			q.created = t
+		case "sort":
+			field, order, _ := strings.Cut(v.Get(key), ":")
+			q.SortBy(SortField(field), SortOrder(order))
+		default:
+			return nil, ValidationErr{Field: key, Message: "unknown query field"}
+		}
+	}
+
+	return q, nil
+}
+
+// cleanTerm strips characters that would change the meaning of the sk syntax
+func cleanTerm(t string) string {
+	t = strings.Map(func(r rune) rune {
+		switch r {
+		case '"', '(', ')', '+', '<', '>', '~', '|':
+			return ' '
+		}
+		return r
+	}, t)
+	t = strings.TrimLeft(strings.TrimSpace(t), "-*")
+	return strings.Join(strings.Fields(t), " ")
+}
+
+func cleanTerms(terms []string) []string {
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t = cleanTerm(t); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// quoteTerm turns multi-word terms into phrases
+func quoteTerm(t string) string {
+	if strings.Contains(t, " ") {
+		return `"` + t + `"`
+	}
+	return t
+}
@@ -0,0 +1,103 @@
+package nadago
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	created := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	newQuery := func() *Query {
+		return NewQuery().
+			All("income", "household").
+			Any("covid", "pandemic").
+			Not("pilot").
+			Phrase("labour force").
+			Countries("KEN", "UGA").
+			Years(2015, 2020).
+			CreatedAfter(created).
+			Collections("central").
+			AccessTypes(AccessOpen, AccessPublic).
+			Types(TypeSurvey).
+			SortBy(SortByYear, Desc).
+			PageSize(50).
+			Page(2)
+	}
+
+	t.Run("keywords composed", func(t *testing.T) {
+		assert.Equal(t, `+income +household +"labour force" +(covid pandemic) -pilot`, newQuery().Keywords())
+		assert.Equal(t, `+"sex of head" +(age "age in years") -"pilot round"`,
+			NewQuery().All("sex of head").Any("age", "age in years").Not("pilot round").Keywords())
+		assert.Equal(t, "+single", NewQuery().Any("single").Keywords())
+	})
+
+	t.Run("operators in terms are neutralised", func(t *testing.T) {
+		assert.Equal(t, `+"a b" -c`, NewQuery().All(`"a" (b)`, "", "  ").Not("-c").Keywords())
+	})
+
+	t.Run("params", func(t *testing.T) {
+		p, err := newQuery().Params()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"KEN", "UGA"}, p.Country)
+		assert.Equal(t, 2015, p.From)
+		assert.Equal(t, 2020, p.To)
+		assert.Equal(t, created, p.Created)
+		assert.Equal(t, []string{"central"}, p.Collection)
+		assert.Equal(t, []DataAccessType{AccessOpen, AccessPublic}, p.Dtype)
+		assert.Equal(t, SortByYear, p.Sort_by)
+		assert.Equal(t, Desc, p.Sort_order)
+		assert.Equal(t, 50, p.Ps)
+		assert.Equal(t, 2, p.Page)
+		assert.True(t, p.Inc_iso)
+	})
+
+	t.Run("params validated", func(t *testing.T) {
+		_, err := NewQuery().Years(2020, 2010).Params()
+		assert.IsType(t, ValidationErr{}, err)
+	})
+
+	t.Run("round trips through string", func(t *testing.T) {
+		q := newQuery()
+		parsed, err := ParseQuery(q.String())
+		assert.NoError(t, err)
+		assert.Equal(t, q, parsed)
+		assert.Equal(t, q.String(), parsed.String())
+
+		empty, err := ParseQuery("")
+		assert.NoError(t, err)
+		assert.Equal(t, NewQuery(), empty)
+	})
+
+	t.Run("parse errors", func(t *testing.T) {
+		_, err := ParseQuery("from=abc")
+		assert.IsType(t, ValidationErr{}, err)
+
+		_, err = ParseQuery("created=01-06-2019")
+		assert.IsType(t, ValidationErr{}, err)
+
+		_, err = ParseQuery("colour=blue")
+		assert.IsType(t, ValidationErr{}, err)
+
+		_, err = ParseQuery("%zz")
+		assert.IsType(t, AppErr{}, err)
+	})
+
+	t.Run("search against client", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, `+income +household +"labour force" +(covid pandemic) -pilot`, r.URL.Query().Get("sk"))
+			assert.Equal(t, "KEN|UGA", r.URL.Query().Get("country"))
+			w.Write([]byte(expectedSearchResponse))
+		}))
+		defer ts.Close()
+
+		surveys, err := newQuery().Search(context.Background(), NewClient(ts.URL))
+		assert.NoError(t, err)
+		assert.Len(t, surveys, 5)
+	})
+}
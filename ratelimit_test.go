@@ -0,0 +1,60 @@
+package nadago
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"variable":{}}`))
+	}))
+	defer ts.Close()
+
+	t.Run("requests beyond the burst wait", func(t *testing.T) {
+		client := NewClient(ts.URL, WithRateLimit(20, 2))
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			_, err := client.GetVarMeta(context.Background(), "X", "V1")
+			assert.NoError(t, err)
+		}
+		// two requests from the burst, two more at 50ms intervals
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("waiting stops with the context", func(t *testing.T) {
+		client := NewClient(ts.URL, WithRateLimit(0.1, 1))
+		_, err := client.GetVarMeta(context.Background(), "X", "V1")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = client.GetVarMeta(ctx, "X", "V1")
+		assert.ErrorContains(t, err, "context deadline exceeded")
+	})
+
+	t.Run("cached responses are not limited", func(t *testing.T) {
+		client := NewClient(ts.URL, WithRateLimit(0.1, 1), WithCache(time.Minute, 0))
+		for i := 0; i < 3; i++ {
+			_, err := client.GetVarMeta(context.Background(), "X", "V1")
+			assert.NoError(t, err)
+		}
+	})
+	t.Run("a rate of zero or less is no limit", func(t *testing.T) {
+		for _, rate := range []float64{0, -1} {
+			client := NewClient(ts.URL, WithRateLimit(20, 1), WithRateLimit(rate, 1))
+			assert.Nil(t, client.limiter)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			for i := 0; i < 3; i++ {
+				_, err := client.GetVarMeta(ctx, "X", "V1")
+				assert.NoError(t, err)
+			}
+			cancel()
+		}
+	})
+}
@@ -0,0 +1,351 @@
+package nadago
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// request describes a GET request to the catalog. The endpoint names the kind
+// of call in metrics and spans, such as "search" or "variable"
+type request struct {
+	endpoint string
+	path     string
+	url      string
+	query    url.Values
+	header   http.Header
+	attrs    []Attribute
+
+	// partial accepts 206 responses to range requests
+	partial bool
+
+	// coalesce shares the request with identical concurrent calls when the
+	// client coalesces requests
+	coalesce bool
+
+	// uncached keeps the response out of the cache, for downloads and exports
+	// too large to hold in memory
+	uncached bool
+}
+
+type retryPolicy struct {
+	max     int
+	backoff time.Duration
+}
+
+// WithRetry retries requests that fail to complete or are answered with 429,
+// 502, 503 or 504 up to maxRetries times, waiting backoff before the first
+// retry and doubling the wait after each
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retry = retryPolicy{max: maxRetries, backoff: backoff}
+	}
+}
+
+// callState is carried in the request context so the transport layers can
+// report back to the call that made the request
+type callState struct {
+	cacheHit bool
+	uncached bool
+}
+
+type callStateKey struct{}
+
+// get sends the request and decodes the body of a successful response. Errors
+// from decode are wrapped in an AppErr unless they already are one
+func (c *Client) get(ctx context.Context, r request, decode func(io.Reader) error) error {
+	if r.coalesce && c.flights != nil {
+		return c.getShared(ctx, r, decode)
+	}
+
+	body, err := c.open(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := c.decode(ctx, r, body.url, body, decode); err != nil {
+		body.fail(err)
+		return err
+	}
+	return nil
+}
+
+// getShared reads the whole response once for every identical call in flight,
+// then decodes it for this caller
+func (c *Client) getShared(ctx context.Context, r request, decode func(io.Reader) error) error {
+	key := r.endpoint + " " + r.url + c.apiURL + r.path + "?" + r.query.Encode()
+	if skipsCache(ctx) {
+		// calls that skip the cache must not share a cached response
+		key = "nocache " + key
+	}
+	data, u, err := c.flights.do(ctx, key, func(ctx context.Context) ([]byte, string, error) {
+		body, err := c.open(ctx, r)
+		if err != nil {
+			return nil, "", err
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			err = AppErr{
+				Message:    fmt.Errorf("failed to read response. %w", err).Error(),
+				StatusCode: 1001,
+			}
+			body.fail(err)
+			return nil, "", err
+		}
+		return data, body.url, nil
+	})
+	if err != nil {
+		return err
+	}
+	return c.decode(ctx, r, u, bytes.NewReader(data), decode)
+}
+
+// decode runs the decode function of a request over the body, logging failures
+func (c *Client) decode(ctx context.Context, r request, u string, body io.Reader, decode func(io.Reader) error) error {
+	in := body
+	var snippet *snippetWriter
+	if c.logger != nil && c.logger.Enabled(ctx, slog.LevelDebug) {
+		snippet = &snippetWriter{}
+		in = io.TeeReader(body, snippet)
+	}
+
+	err := decode(in)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(AppErr); !ok {
+		err = AppErr{
+			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+
+	c.log(ctx, c.logLevels.failure, "nadago: failed to decode response",
+		slog.String("endpoint", r.endpoint),
+		slog.String("url", u),
+		slog.Any("error", err),
+	)
+	if snippet != nil {
+		c.log(ctx, slog.LevelDebug, "nadago: undecodable response body",
+			slog.String("endpoint", r.endpoint),
+			slog.String("url", u),
+			slog.String("body", string(snippet.buf)),
+		)
+	}
+	return err
+}
+
+// open sends the request, retrying as configured, and returns the body of a
+// successful response. The request is recorded once the body is closed
+func (c *Client) open(ctx context.Context, r request) (*responseBody, error) {
+	attrs := append([]Attribute{{Key: "nadago.endpoint", Value: r.endpoint}}, r.attrs...)
+	ctx, span := c.tracer.Start(ctx, "nadago."+r.endpoint, attrs...)
+	state := &callState{uncached: r.uncached}
+	ctx = context.WithValue(ctx, callStateKey{}, state)
+
+	rec := RequestRecord{Endpoint: r.endpoint}
+	start := time.Now()
+	finish := func(err error) {
+		rec.Duration = time.Since(start)
+		rec.CacheHit = state.cacheHit
+		rec.Err = err
+		c.metrics.ObserveRequest(rec)
+
+		span.SetAttributes(
+			Attribute{Key: "http.status_code", Value: rec.Status},
+			Attribute{Key: "nadago.retries", Value: rec.Retries},
+			Attribute{Key: "nadago.cache_hit", Value: rec.CacheHit},
+			Attribute{Key: "nadago.bytes_read", Value: rec.Bytes},
+		)
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+
+	target := r.url
+	if target == "" {
+		target = c.apiURL + r.path
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		err = AppErr{
+			Message:    fmt.Errorf("invalid URL format: %w", err).Error(),
+			StatusCode: 1001,
+		}
+		finish(err)
+		return nil, err
+	}
+	rec.Host = u.Host
+	if len(r.query) > 0 {
+		q := u.Query()
+		for param, values := range r.query {
+			for _, v := range values {
+				q.Add(param, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var resp *http.Response
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			err = AppErr{
+				Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
+				StatusCode: 1001,
+			}
+			finish(err)
+			return nil, err
+		}
+		for k, v := range r.header {
+			req.Header[k] = v
+		}
+
+		sent := time.Now()
+		resp, err = c.httpClient.Do(req)
+		last := attempt == c.retry.max || !retryable(resp, err) || ctx.Err() != nil
+		c.logAttempt(ctx, r, u, attempt+1, time.Since(sent), resp, err, last)
+		if last {
+			if err != nil {
+				var open ErrCircuitOpen
+				if errors.As(err, &open) {
+					finish(open)
+					return nil, open
+				}
+				err = AppErr{
+					Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
+					StatusCode: 1001,
+				}
+				finish(err)
+				return nil, err
+			}
+			break
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		rec.Retries++
+		timer := time.NewTimer(c.retry.backoff << attempt)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err := AppErr{
+				Message:    fmt.Errorf("failed to complete http request. %w", ctx.Err()).Error(),
+				StatusCode: 1001,
+			}
+			finish(err)
+			return nil, err
+		}
+	}
+
+	rec.Status = resp.StatusCode
+	if resp.StatusCode != http.StatusOK && !(r.partial && resp.StatusCode == http.StatusPartialContent) {
+		resp.Body.Close()
+		err := FetchErr{
+			Message:    "non-200 status code from the API",
+			StatusCode: resp.StatusCode,
+		}
+		finish(err)
+		return nil, err
+	}
+
+	return &responseBody{resp: resp, url: redactURL(u), rec: &rec, finish: finish}, nil
+}
+
+func (c *Client) logAttempt(ctx context.Context, r request, u *url.URL, attempt int, d time.Duration, resp *http.Response, err error, last bool) {
+	if c.logger == nil {
+		return
+	}
+
+	level := c.logLevels.success
+	msg := "nadago: request"
+	ok := err == nil && (resp.StatusCode == http.StatusOK || r.partial && resp.StatusCode == http.StatusPartialContent)
+	switch {
+	case !ok && !last:
+		level, msg = c.logLevels.retry, "nadago: request failed, retrying"
+	case !ok:
+		level, msg = c.logLevels.failure, "nadago: request failed"
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", http.MethodGet),
+		slog.String("url", redactURL(u)),
+		slog.String("endpoint", r.endpoint),
+		slog.Duration("duration", d),
+		slog.Int("attempt", attempt),
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	}
+	if err != nil {
+		// the http client quotes the full URL in its errors
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			redacted := *uerr
+			redacted.URL = redactURL(u)
+			err = &redacted
+		}
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	c.log(ctx, level, msg, attrs...)
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var open ErrCircuitOpen
+		return !errors.As(err, &open)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// responseBody counts the bytes read from a response and records the request
+// when closed
+type responseBody struct {
+	resp   *http.Response
+	url    string
+	rec    *RequestRecord
+	err    error
+	finish func(error)
+	closed bool
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	n, err := b.resp.Body.Read(p)
+	b.rec.Bytes += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// fail marks the request as failed, for errors found while decoding the body
+func (b *responseBody) fail(err error) {
+	b.err = err
+}
+
+func (b *responseBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.resp.Body.Close()
+	b.finish(b.err)
+	return err
+}
@@ -0,0 +1,80 @@
+package nadago
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries unavailable responses", func(t *testing.T) {
+		var hits int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"variable":{"name":"age"}}`))
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, WithRetry(2, time.Millisecond))
+		v, err := client.GetVarMeta(ctx, "X", "V1")
+		assert.NoError(t, err)
+		assert.Equal(t, "age", v.Name())
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		var hits int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, WithRetry(1, time.Millisecond))
+		_, err := client.GetVarMeta(ctx, "X", "V1")
+		assert.Equal(t, FetchErr{Message: "non-200 status code from the API", StatusCode: http.StatusBadGateway}, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("does not retry other statuses", func(t *testing.T) {
+		var hits int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL, WithRetry(3, time.Millisecond))
+		_, err := client.GetSurveyMeta(ctx, "X")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("retries transport errors and stops with the context", func(t *testing.T) {
+		var attempts int32
+		client := NewClient("http://invalid-url", WithRetry(5, time.Hour), WithHTTPClient(&http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&attempts, 1)
+				return nil, errors.New("connection reset")
+			}),
+		}))
+
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := client.GetSurveyMeta(ctx, "X")
+		assert.IsType(t, AppErr{}, err)
+		assert.ErrorContains(t, err, "context deadline exceeded")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	})
+}
@@ -0,0 +1,285 @@
+package nadago
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Resources struct {
+	Idno      string
+	Resources []Resource `json:"resources"`
+}
+
+// Resource is an external resource attached to a study, such as a questionnaire,
+// report, technical document or program file. Url is empty when the catalog
+// gives no download location, Filename is only the name of the stored file
+type Resource struct {
+	Id       int    `json:"resource_id"`
+	Title    string `json:"title"`
+	Type     string `json:"dctype"`
+	Format   string `json:"dcformat"`
+	Url      string `json:"url"`
+	Filename string `json:"filename"`
+	Size     int64  `json:"filesize"`
+	Data     interface{}
+}
+
+func (r *Resource) UnmarshalJSON(data []byte) error {
+	type Alias Resource
+	aux := &struct {
+		Id    interface{} `json:"resource_id"`
+		Size  interface{} `json:"filesize"`
+		Links struct {
+			Download string `json:"download"`
+		} `json:"_links"`
+		*Alias
+	}{
+		Alias: (*Alias)(r),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	r.Id, err = convertToInt(aux.Id)
+	if err != nil {
+		return err
+	}
+
+	size, err := convertToInt(aux.Size)
+	if err != nil {
+		return err
+	}
+	r.Size = int64(size)
+
+	// catalogs expose the download location in different fields
+	if r.Url == "" {
+		r.Url = aux.Links.Download
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Data = raw
+
+	return nil
+}
+
+func (c *Client) GetResources(ctx context.Context, idno string) (Resources, error) {
+	if _, err := c.version(ctx, "resources"); err != nil {
+		return Resources{}, err
+	}
+
+	var res Resources
+	err := c.get(ctx, request{
+		endpoint: "resources",
+		path:     "/" + url.PathEscape(idno) + "/resources",
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}},
+	}, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&res)
+	})
+	if err != nil {
+		return Resources{}, err
+	}
+	res.Idno = idno
+
+	return res, nil
+}
+
+type download struct {
+	offset   int64
+	progress func(written, total int64)
+	hash     hash.Hash
+	checksum string
+}
+
+type DownloadOption func(d *download)
+
+// WithResume requests the resource from offset onwards using an HTTP Range
+// header, so an interrupted download can be appended to
+func WithResume(offset int64) DownloadOption {
+	return func(d *download) {
+		d.offset = offset
+	}
+}
+
+// WithProgress calls fn after each chunk is written with the total number of
+// bytes written so far (including the resume offset) and the expected total,
+// which is -1 when the server does not report a length
+func WithProgress(fn func(written, total int64)) DownloadOption {
+	return func(d *download) {
+		d.progress = fn
+	}
+}
+
+// WithChecksum verifies the downloaded bytes against the hex encoded sum. When
+// resuming, h must already contain the bytes written before the offset
+func WithChecksum(h hash.Hash, sum string) DownloadOption {
+	return func(d *download) {
+		d.hash = h
+		d.checksum = sum
+	}
+}
+
+// DownloadResource streams the resource to w and returns the number of bytes written
+func (c *Client) DownloadResource(ctx context.Context, res Resource, w io.Writer, opts ...DownloadOption) (int64, error) {
+	d := &download{}
+	for _, o := range opts {
+		o(d)
+	}
+
+	if res.Url == "" {
+		return 0, AppErr{
+			Message:    fmt.Sprintf("resource %d has no download url, the catalog only lists its file name %q", res.Id, res.Filename),
+			StatusCode: 1001,
+		}
+	}
+
+	body, err := c.openResource(ctx, res, d.offset)
+	if err != nil {
+		return 0, err
+	}
+	if body.resp.StatusCode == http.StatusPartialContent && rangeStart(body.resp) != d.offset {
+		// the server resumed from somewhere else, so download the resource
+		// from the start and skip the bytes already written
+		c.log(ctx, c.logLevels.failure, "nadago: resumed download starts at the wrong offset",
+			slog.String("url", res.Url),
+			slog.Int64("offset", d.offset),
+			slog.String("content_range", body.resp.Header.Get("Content-Range")),
+		)
+		body.Close()
+		if body, err = c.openResource(ctx, res, 0); err != nil {
+			return 0, err
+		}
+		if body.resp.StatusCode == http.StatusPartialContent && rangeStart(body.resp) != 0 {
+			body.Close()
+			return 0, AppErr{
+				Message:    fmt.Sprintf("unexpected content range %q", body.resp.Header.Get("Content-Range")),
+				StatusCode: 1001,
+			}
+		}
+	}
+	defer body.Close()
+
+	skip := d.offset
+	if body.resp.StatusCode == http.StatusPartialContent {
+		skip -= rangeStart(body.resp)
+	}
+
+	total := int64(-1)
+	resp := body.resp
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if resp.ContentLength >= 0 {
+			total = d.offset - skip + resp.ContentLength
+		}
+	case http.StatusOK:
+		total = resp.ContentLength
+	}
+
+	// the server ignored the range header, or the resumed response was
+	// replaced by the whole resource, so skip the bytes we already have
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, body, skip); err != nil {
+			err = AppErr{
+				Message:    fmt.Errorf("failed to skip to resume offset. %w", err).Error(),
+				StatusCode: 1001,
+			}
+			body.fail(err)
+			return 0, err
+		}
+	}
+
+	dst := w
+	if d.hash != nil {
+		dst = io.MultiWriter(w, d.hash)
+	}
+
+	written := d.offset
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := body.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				err = AppErr{
+					Message:    fmt.Errorf("failed to write resource. %w", err).Error(),
+					StatusCode: 1001,
+				}
+				body.fail(err)
+				return written - d.offset, err
+			}
+			written += int64(n)
+			if d.progress != nil {
+				d.progress(written, total)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return written - d.offset, AppErr{
+				Message:    fmt.Errorf("failed to read resource. %w", rerr).Error(),
+				StatusCode: 1001,
+			}
+		}
+	}
+
+	if d.hash != nil {
+		got := hex.EncodeToString(d.hash.Sum(nil))
+		if !strings.EqualFold(got, d.checksum) {
+			err := AppErr{
+				Message:    fmt.Sprintf("checksum mismatch: expected %s, got %s", d.checksum, got),
+				StatusCode: 1001,
+			}
+			body.fail(err)
+			return written - d.offset, err
+		}
+	}
+
+	return written - d.offset, nil
+}
+
+func (c *Client) openResource(ctx context.Context, res Resource, offset int64) (*responseBody, error) {
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	return c.open(ctx, request{
+		endpoint: "download",
+		url:      res.Url,
+		header:   header,
+		partial:  true,
+		uncached: true,
+		attrs:    []Attribute{{Key: "nadago.resource_id", Value: res.Id}},
+	})
+}
+
+// rangeStart returns the first byte position of a partial response's
+// Content-Range header, or -1 when it is missing or malformed
+func rangeStart(resp *http.Response) int64 {
+	cr := strings.TrimSpace(resp.Header.Get("Content-Range"))
+	if !strings.HasPrefix(cr, "bytes ") {
+		return -1
+	}
+	start, _, ok := strings.Cut(strings.TrimSpace(cr[len("bytes "):]), "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,206 @@
+package nadago
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetResources(t *testing.T) {
+	t.Run("successful request", func(t *testing.T) {
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/ALB_2020_ES-COVID19-R1_v01_M/resources", r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(expectedResourcesResponse))
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL)
+
+		ctx := context.Background()
+		idno := "ALB_2020_ES-COVID19-R1_v01_M"
+
+		res, err := client.GetResources(ctx, idno)
+		assert.NoError(t, err)
+		assert.Equal(t, idno, res.Idno)
+		assert.Len(t, res.Resources, 2)
+
+		q := res.Resources[0]
+		assert.Equal(t, 3301, q.Id)
+		assert.Equal(t, "Questionnaire", q.Title)
+		assert.Equal(t, "doc/qst", q.Type)
+		assert.Equal(t, "application/pdf", q.Format)
+		assert.Equal(t, "https://catalog.ihsn.org/catalog/10252/download/3301", q.Url)
+		assert.Equal(t, int64(482113), q.Size)
+		assert.NotNil(t, q.Data)
+
+		assert.Equal(t, "questionnaire.pdf", q.Filename)
+
+		// a file name is not a download location
+		assert.Empty(t, res.Resources[1].Url)
+		assert.Equal(t, "https://catalog.ihsn.org/files/report.pdf", res.Resources[1].Filename)
+		assert.Equal(t, int64(0), res.Resources[1].Size)
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 page not found"))
+		}))
+		defer ts.Close()
+
+		client := NewClient(ts.URL)
+
+		_, err := client.GetResources(context.Background(), "missing")
+		assert.Equal(t, FetchErr{
+			Message:    "non-200 status code from the API",
+			StatusCode: 404,
+		}, err)
+	})
+
+	t.Run("failed to complete http request", func(t *testing.T) {
+
+		failingClient := &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("failed to complete http request")
+			}),
+		}
+		client := NewClient("http://invalid-url", WithHTTPClient(failingClient))
+
+		_, err := client.GetResources(context.Background(), "idno")
+		assert.Error(t, err)
+
+		appErr, ok := err.(AppErr)
+		assert.True(t, ok, "error should be of type AppErr")
+		assert.Equal(t, 1001, appErr.StatusCode, "error status code should match expected value")
+	})
+}
+
+func TestDownloadResource(t *testing.T) {
+	content := []byte(strings.Repeat("questionnaire content ", 4096))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "q.pdf", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL)
+	res := Resource{Url: ts.URL + "/q.pdf"}
+	ctx := context.Background()
+
+	t.Run("full download with progress and checksum", func(t *testing.T) {
+		var buf bytes.Buffer
+		var lastWritten, lastTotal int64
+
+		n, err := client.DownloadResource(ctx, res, &buf,
+			WithProgress(func(written, total int64) {
+				lastWritten, lastTotal = written, total
+			}),
+			WithChecksum(sha256.New(), checksum),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int64(len(content)), lastWritten)
+		assert.Equal(t, int64(len(content)), lastTotal)
+	})
+
+	t.Run("resume from offset", func(t *testing.T) {
+		offset := int64(1000)
+		buf := bytes.NewBuffer(append([]byte{}, content[:offset]...))
+		h := sha256.New()
+		h.Write(content[:offset])
+
+		var lastTotal int64
+		n, err := client.DownloadResource(ctx, res, buf,
+			WithResume(offset),
+			WithProgress(func(written, total int64) { lastTotal = total }),
+			WithChecksum(h, checksum),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content))-offset, n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, int64(len(content)), lastTotal)
+	})
+
+	t.Run("resume when range is ignored", func(t *testing.T) {
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content)
+		}))
+		defer plain.Close()
+
+		offset := int64(10)
+		var buf bytes.Buffer
+		n, err := client.DownloadResource(ctx, Resource{Url: plain.URL}, &buf, WithResume(offset))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content))-offset, n)
+		assert.Equal(t, content[offset:], buf.Bytes())
+	})
+
+	t.Run("resume from the wrong offset", func(t *testing.T) {
+		var ranges []string
+		shifted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if r.Header.Get("Range") != "" {
+				// resume 500 bytes earlier than asked
+				w.Header().Set("Content-Range", "bytes 500-"+strconv.Itoa(len(content)-1)+"/"+strconv.Itoa(len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[500:])
+				return
+			}
+			w.Write(content)
+		}))
+		defer shifted.Close()
+
+		offset := int64(1000)
+		buf := bytes.NewBuffer(append([]byte{}, content[:offset]...))
+		h := sha256.New()
+		h.Write(content[:offset])
+
+		n, err := client.DownloadResource(ctx, Resource{Url: shifted.URL}, buf, WithResume(offset), WithChecksum(h, checksum))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content))-offset, n)
+		assert.Equal(t, content, buf.Bytes())
+		assert.Equal(t, []string{"bytes=1000-", ""}, ranges)
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		var buf bytes.Buffer
+		_, err := client.DownloadResource(ctx, res, &buf, WithChecksum(sha256.New(), "deadbeef"))
+		assert.Error(t, err)
+		assert.IsType(t, AppErr{}, err)
+		assert.Contains(t, err.Error(), "checksum mismatch")
+	})
+
+	t.Run("missing url", func(t *testing.T) {
+		_, err := client.DownloadResource(ctx, Resource{Id: 3302, Filename: "report.pdf"}, &bytes.Buffer{})
+		assert.Equal(t, AppErr{
+			Message:    `resource 3302 has no download url, the catalog only lists its file name "report.pdf"`,
+			StatusCode: 1001,
+		}, err)
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		_, err := client.DownloadResource(ctx, Resource{Url: ts.URL}, &bytes.Buffer{}, WithResume(int64(len(content))+1))
+		assert.Equal(t, FetchErr{
+			Message:    "non-200 status code from the API",
+			StatusCode: http.StatusRequestedRangeNotSatisfiable,
+		}, err)
+	})
+}
+
+var expectedResourcesResponse = `{"status":"success","resources":[{"resource_id":"3301","survey_id":"10252","dctype":"doc\/qst","title":"Questionnaire","author":"World Bank Group","dcformat":"application\/pdf","filename":"questionnaire.pdf","filesize":"482113","_links":{"download":"https:\/\/catalog.ihsn.org\/catalog\/10252\/download\/3301"}},{"resource_id":3302,"dctype":"doc\/rep","title":"Report","dcformat":"application\/pdf","filename":"https:\/\/catalog.ihsn.org\/files\/report.pdf","filesize":null}]}`
@@ -1,53 +1,119 @@
 package nadago
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-querystring/query"
 )
 
+// SearchResults is the result object of a search response.
+//
+// Deprecated: Search decodes rows straight into surveys, keeping each row in
+// Survey.Data. SearchResults is kept for code decoding responses itself
 type SearchResults struct {
 	Rows []map[string]interface{} `json:"rows"`
 }
 
+// SearchResponse is the body of a search response.
+//
+// Deprecated: see SearchResults
 type SearchResponse struct {
 	Result SearchResults `json:"result"`
 }
 
 type Survey struct {
-	Idno     string    `json:"idno"`
-	Title    string    `json:"title"`
-	Nation   string    `json:"nation"`
-	Start    int       `json:"year_start"`
-	End      int       `json:"year_end"`
-	Created  time.Time `json:"created"`
-	Changed  time.Time `json:"changed"`
-	Url      string    `json:"url"`
-	Varcount int       `json:"varcount"`
-	Data     interface{}
+	Idno     string      `json:"idno"`
+	Title    string      `json:"title"`
+	Nation   string      `json:"nation"`
+	Start    int         `json:"year_start"`
+	End      int         `json:"year_end"`
+	Created  CatalogTime `json:"created"`
+	Changed  CatalogTime `json:"changed"`
+	Url      string      `json:"url"`
+	Varcount int         `json:"varcount"`
+
+	// Data holds the search row as returned by the catalog
+	Data json.RawMessage
 }
 
-// define all search parameters for the search endpoint
+// Fields decodes the search row into a map
+func (s Survey) Fields() (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	err := json.Unmarshal(s.Data, &fields)
+	return fields, err
+}
+
+type SortField string
+
+const (
+	SortByRank       SortField = "rank"
+	SortByTitle      SortField = "title"
+	SortByNation     SortField = "nation"
+	SortByYear       SortField = "year"
+	SortByPopularity SortField = "popularity"
+	SortByCreated    SortField = "created"
+	SortByChanged    SortField = "changed"
+)
+
+type SortOrder string
+
+const (
+	Asc  SortOrder = "asc"
+	Desc SortOrder = "desc"
+)
+
+type DataAccessType string
+
+const (
+	AccessOpen     DataAccessType = "open"
+	AccessDirect   DataAccessType = "direct"
+	AccessPublic   DataAccessType = "public"
+	AccessLicensed DataAccessType = "licensed"
+	AccessEnclave  DataAccessType = "enclave"
+	AccessRemote   DataAccessType = "remote"
+	AccessNone     DataAccessType = "data_na"
+)
+
+type DatasetType string
+
+const (
+	TypeSurvey     DatasetType = "survey"
+	TypeGeospatial DatasetType = "geospatial"
+	TypeTimeseries DatasetType = "timeseries"
+	TypeDocument   DatasetType = "document"
+	TypeTable      DatasetType = "table"
+	TypeImage      DatasetType = "image"
+	TypeVideo      DatasetType = "video"
+	TypeScript     DatasetType = "script"
+)
+
+// MaxPageSize is the largest page size accepted by Validate
+const MaxPageSize = 300
+
+// define all search parameters for the search endpoint. Multi-value fields are
+// sent pipe separated, e.g. country=KEN|UGA
 type SearchParams struct {
-	Keywords   string `url:"sk,omitempty"`
-	From       int    `url:"from,omitempty"`
-	To         int    `url:"to,omitempty"`
-	Country    string `url:"country,omitempty"`
-	Inc_iso    bool   `url:"inc_iso,omitempty"`
-	Created    string `url:"created,omitempty"`
-	Dtype      string `url:"dtype,omitempty"`
-	Ps         int    `url:"ps,omitempty"`
-	Page       int    `url:"page,omitempty"`
-	Sort_by    string `url:"sort_by,omitempty"`
-	Sort_order string `url:"sort_order,omitempty"`
-	Format     string `url:"format,omitempty"`
+	Keywords   string           `url:"sk,omitempty"`
+	From       int              `url:"from,omitempty"`
+	To         int              `url:"to,omitempty"`
+	Country    []string         `url:"country,omitempty" del:"|"`
+	Inc_iso    bool             `url:"inc_iso,omitempty"`
+	Created    time.Time        `url:"created,omitempty" layout:"2006-01-02"`
+	Dtype      []DataAccessType `url:"dtype,omitempty" del:"|"`
+	Type       []DatasetType    `url:"type,omitempty" del:"|"`
+	Collection []string         `url:"collection,omitempty" del:"|"`
+	Ps         int              `url:"ps,omitempty"` // 0 leaves the page size to the catalog
+	Page       int              `url:"page,omitempty"`
+	Sort_by    SortField        `url:"sort_by,omitempty"`
+	Sort_order SortOrder        `url:"sort_order,omitempty"`
+	Format     string           `url:"format,omitempty"`
 }
 
 // set the default parameters
@@ -56,18 +122,93 @@ func NewDefaultSearchParams() *SearchParams {
 		Inc_iso:    true,
 		Ps:         30,
 		Page:       1,
-		Sort_by:    "year",
-		Sort_order: "asc",
+		Sort_by:    SortByYear,
+		Sort_order: Asc,
 		Format:     "json",
 	}
 }
 
+// Validate reports the first parameter that the search endpoint would reject or
+// silently ignore
+func (p *SearchParams) Validate() error {
+	if p.From < 0 {
+		return ValidationErr{Field: "from", Message: "must not be negative"}
+	}
+	if p.To < 0 {
+		return ValidationErr{Field: "to", Message: "must not be negative"}
+	}
+	if p.From != 0 && p.To != 0 && p.From > p.To {
+		return ValidationErr{Field: "from", Message: fmt.Sprintf("%d is after to (%d)", p.From, p.To)}
+	}
+	// countries are matched by name unless inc_iso is set
+	for _, c := range p.Country {
+		switch {
+		case strings.TrimSpace(c) == "":
+			return ValidationErr{Field: "country", Message: "must not be empty"}
+		case strings.Contains(c, "|"):
+			return ValidationErr{Field: "country", Message: fmt.Sprintf("%q contains the separator |", c)}
+		case p.Inc_iso && !isoCountryPattern.MatchString(c):
+			return ValidationErr{Field: "country", Message: fmt.Sprintf("%q is not an ISO 3166 alpha-3 code", c)}
+		}
+	}
+	for _, d := range p.Dtype {
+		if !d.valid() {
+			return ValidationErr{Field: "dtype", Message: fmt.Sprintf("unknown data access type %q", d)}
+		}
+	}
+	for _, t := range p.Type {
+		if !t.valid() {
+			return ValidationErr{Field: "type", Message: fmt.Sprintf("unknown dataset type %q", t)}
+		}
+	}
+	if p.Ps < 0 || p.Ps > MaxPageSize {
+		return ValidationErr{Field: "ps", Message: fmt.Sprintf("must be between 1 and %d, or 0 for the catalog default", MaxPageSize)}
+	}
+	if p.Page < 0 {
+		return ValidationErr{Field: "page", Message: "must not be negative"}
+	}
+	if p.Sort_by != "" && !p.Sort_by.valid() {
+		return ValidationErr{Field: "sort_by", Message: fmt.Sprintf("unknown sort field %q", p.Sort_by)}
+	}
+	if p.Sort_order != "" && p.Sort_order != Asc && p.Sort_order != Desc {
+		return ValidationErr{Field: "sort_order", Message: fmt.Sprintf("must be %q or %q", Asc, Desc)}
+	}
+	if p.Format != "" && p.Format != "json" {
+		return ValidationErr{Field: "format", Message: "only json responses are supported"}
+	}
+	return nil
+}
+
+func (f SortField) valid() bool {
+	switch f {
+	case SortByRank, SortByTitle, SortByNation, SortByYear, SortByPopularity, SortByCreated, SortByChanged:
+		return true
+	}
+	return false
+}
+
+func (d DataAccessType) valid() bool {
+	switch d {
+	case AccessOpen, AccessDirect, AccessPublic, AccessLicensed, AccessEnclave, AccessRemote, AccessNone:
+		return true
+	}
+	return false
+}
+
+func (t DatasetType) valid() bool {
+	switch t {
+	case TypeSurvey, TypeGeospatial, TypeTimeseries, TypeDocument, TypeTable, TypeImage, TypeVideo, TypeScript:
+		return true
+	}
+	return false
+}
+
 func (s *Survey) UnmarshalJSON(data []byte) error {
 	type Alias Survey
 	aux := &struct {
-		Start    interface{} `json:"year_start"`
-		End      interface{} `json:"year_end"`
-		Varcount interface{} `json:"varcount"`
+		Start    flexInt `json:"year_start"`
+		End      flexInt `json:"year_end"`
+		Varcount flexInt `json:"varcount"`
 		*Alias
 	}{
 		Alias: (*Alias)(s),
@@ -77,23 +218,40 @@ func (s *Survey) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	var err error
-	s.Start, err = convertToInt(aux.Start)
-	if err != nil {
-		return err
-	}
+	s.Start = int(aux.Start)
+	s.End = int(aux.End)
+	s.Varcount = int(aux.Varcount)
+	return nil
+}
 
-	s.End, err = convertToInt(aux.End)
-	if err != nil {
+// flexInt decodes numbers the catalog sends either as JSON numbers or as
+// strings, without going through interface{} in the common cases
+type flexInt int
+
+func (n *flexInt) UnmarshalJSON(data []byte) error {
+	switch {
+	case len(data) == 0:
+		return nil
+	case data[0] == '-' || data[0] >= '0' && data[0] <= '9':
+		f, err := strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return err
+		}
+		*n = flexInt(f)
+		return nil
+	case data[0] == '"' && bytes.IndexByte(data[1:len(data)-1], '\\') < 0:
+		v, err := convertToInt(string(data[1 : len(data)-1]))
+		*n = flexInt(v)
 		return err
 	}
 
-	s.Varcount, err = convertToInt(aux.Varcount)
-	if err != nil {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-
-	return nil
+	i, err := convertToInt(v)
+	*n = flexInt(i)
+	return err
 }
 
 func convertToInt(value interface{}) (int, error) {
@@ -118,24 +276,15 @@ func convertToInt(value interface{}) (int, error) {
 	}
 }
 
+// Search returns the studies matching params. Nil params search with
+// NewDefaultSearchParams
 func (c *Client) Search(ctx context.Context, params *SearchParams) ([]Survey, error) {
-
-	//create a http request to the search endpoint
-	path := c.apiURL + "/search"
-	parsedUrl, err := url.Parse(path)
-	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("invalid URL format: %w", err).Error(),
-			StatusCode: 1001,
-		}
+	if params == nil {
+		params = NewDefaultSearchParams()
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", parsedUrl.String(), nil)
-	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
+	if err := params.Validate(); err != nil {
+		return []Survey{}, err
 	}
 
 	//extract params into url.Values
@@ -144,79 +293,56 @@ func (c *Client) Search(ctx context.Context, params *SearchParams) ([]Survey, er
 		return []Survey{}, fmt.Errorf("failed to query parameters: %w", err)
 	}
 
-	//add the parameters to the request url
-	q := req.URL.Query()
-	for param, value := range v {
-		for _, val := range value {
-			q.Add(param, val)
-		}
-	}
-
-	//make request and unmarshal response
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := c.httpClient.Get(req.URL.String())
+	version, err := c.version(ctx, "search")
 	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return []Survey{}, err
 	}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return []Survey{}, FetchErr{
-			Message:    "non-200 status code from the API",
-			StatusCode: resp.StatusCode,
-		}
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("failed to read respose %w", err).Error(),
-			StatusCode: 1001,
-		}
-	}
-
-	var response SearchResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
-			StatusCode: 1001,
-		}
+	rowSchema := searchSchema
+	if version == NADA4 {
+		rowSchema = search4Schema
 	}
-
-	// extract response into slice of survey structs
-
-	surveys, err := extractSurveys(&response.Result)
+	drift := c.driftCheck("search", "", version)
+	defer c.reportDrift(drift)
+
+	surveys := make([]Survey, 0, params.Ps)
+	err = c.get(ctx, request{endpoint: "search", path: "/search", query: v, coalesce: true}, func(r io.Reader) error {
+		return decodeSearch(r, func(row json.RawMessage) error {
+			drift.checkRaw(row, rowSchema)
+			survey, err := c.decodeSurvey(row, version)
+			if err != nil {
+				return AppErr{
+					Message:    fmt.Errorf("failed to unmarshal response into surveys slice. %w", err).Error(),
+					StatusCode: 1001,
+				}
+			}
+			survey.Data = row
+			surveys = append(surveys, survey)
+			return nil
+		})
+	})
 	if err != nil {
-		return []Survey{}, AppErr{
-			Message:    fmt.Errorf("failed to unmarshal response into surveys slice. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return []Survey{}, err
 	}
 
 	return surveys, nil
 }
 
-func extractSurveys(search *SearchResults) ([]Survey, error) {
-	surveys := make([]Survey, 0)
-	for _, row := range search.Rows {
-
-		rowBytes, err := json.Marshal(row)
-		if err != nil {
-			return []Survey{}, err
+// decodeSearch passes each row of a search response to fn as it is read
+func decodeSearch(r io.Reader, fn func(row json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+	found, err := findArray(dec, "result", "rows")
+	if err != nil || !found {
+		return err
+	}
+	for dec.More() {
+		var row json.RawMessage
+		if err := dec.Decode(&row); err != nil {
+			return err
 		}
-
-		var survey Survey
-		if err := json.Unmarshal(rowBytes, &survey); err != nil {
-			return []Survey{}, err
+		if err := fn(row); err != nil {
+			return err
 		}
-		survey.Data = row
-		surveys = append(surveys, survey)
 	}
-	return surveys, nil
+	return nil
 }
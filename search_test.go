@@ -1,15 +1,21 @@
 package nadago
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-querystring/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,12 +53,16 @@ func TestSearch(t *testing.T) {
 		assert.Equal(t, nation, surveys[0].Nation)
 		assert.Equal(t, start, surveys[0].Start)
 		assert.Equal(t, end, surveys[0].End)
-		assert.Equal(t, created, surveys[0].Created)
-		assert.Equal(t, changed, surveys[0].Changed)
+		assert.Equal(t, created, surveys[0].Created.Time)
+		assert.Equal(t, changed, surveys[0].Changed.Time)
 		assert.Equal(t, url, surveys[0].Url)
 		assert.Equal(t, varcount, surveys[0].Varcount)
 		assert.NotNil(t, surveys[0].Data)
 
+		surveys, err = client.Search(ctx, nil)
+		assert.NoError(t, err)
+		assert.Len(t, surveys, 5)
+
 	})
 
 	t.Run("bad request", func(t *testing.T) {
@@ -86,7 +96,7 @@ func TestSearch(t *testing.T) {
 		}
 		numFields := ptype.NumField()
 
-		assert.Equal(t, 12, numFields)
+		assert.Equal(t, 14, numFields)
 		assert.Equal(t, 30, params.Ps)
 
 	})
@@ -129,4 +139,243 @@ func TestSearch(t *testing.T) {
 	})
 }
 
+func TestSearchParams(t *testing.T) {
+	t.Run("multi-value parameters encoded", func(t *testing.T) {
+		var got url.Values
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.URL.Query()
+			w.Write([]byte(expectedSearchResponse))
+		}))
+		defer ts.Close()
+
+		params := NewDefaultSearchParams()
+		params.Country = []string{"KEN", "UGA"}
+		params.Dtype = []DataAccessType{AccessOpen, AccessPublic}
+		params.Type = []DatasetType{TypeSurvey}
+		params.Collection = []string{"central", "lsms"}
+		params.Created = time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+		params.Sort_order = Desc
+
+		_, err := NewClient(ts.URL).Search(context.Background(), params)
+		assert.NoError(t, err)
+		assert.Equal(t, "KEN|UGA", got.Get("country"))
+		assert.Equal(t, "open|public", got.Get("dtype"))
+		assert.Equal(t, "survey", got.Get("type"))
+		assert.Equal(t, "central|lsms", got.Get("collection"))
+		assert.Equal(t, "2021-03-04", got.Get("created"))
+		assert.Equal(t, "year", got.Get("sort_by"))
+		assert.Equal(t, "desc", got.Get("sort_order"))
+	})
+
+	t.Run("unset parameters omitted", func(t *testing.T) {
+		v, err := query.Values(NewDefaultSearchParams())
+		assert.NoError(t, err)
+		assert.NotContains(t, v, "created")
+		assert.NotContains(t, v, "country")
+		assert.NotContains(t, v, "dtype")
+	})
+
+	invalid := map[string]func(p *SearchParams){
+		"from":       func(p *SearchParams) { p.From, p.To = 2021, 2019 },
+		"country":    func(p *SearchParams) { p.Country = []string{"Kenya"} },
+		"dtype":      func(p *SearchParams) { p.Dtype = []DataAccessType{"free"} },
+		"type":       func(p *SearchParams) { p.Type = []DatasetType{"surveys"} },
+		"ps":         func(p *SearchParams) { p.Ps = MaxPageSize + 1 },
+		"page":       func(p *SearchParams) { p.Page = -1 },
+		"sort_by":    func(p *SearchParams) { p.Sort_by = "yr" },
+		"sort_order": func(p *SearchParams) { p.Sort_order = "ascending" },
+		"format":     func(p *SearchParams) { p.Format = "xml" },
+	}
+	for field, mutate := range invalid {
+		field, mutate := field, mutate
+		t.Run("rejects invalid "+field, func(t *testing.T) {
+			params := NewDefaultSearchParams()
+			mutate(params)
+
+			err := params.Validate()
+			assert.IsType(t, ValidationErr{}, err)
+			assert.Equal(t, field, err.(ValidationErr).Field)
+
+			// Search validates before making a request
+			client := NewClient("http://invalid-url", WithHTTPClient(&http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					t.Fatal("request should not be sent")
+					return nil, nil
+				}),
+			}))
+			_, err = client.Search(context.Background(), params)
+			assert.IsType(t, ValidationErr{}, err)
+		})
+	}
+
+	t.Run("defaults are valid", func(t *testing.T) {
+		assert.NoError(t, NewDefaultSearchParams().Validate())
+		assert.NoError(t, (&SearchParams{}).Validate())
+	})
+
+	t.Run("country names without inc_iso", func(t *testing.T) {
+		params := NewDefaultSearchParams()
+		params.Inc_iso = false
+		params.Country = []string{"Kenya", "Côte d'Ivoire"}
+		assert.NoError(t, params.Validate())
+
+		params.Country = []string{"Kenya|Uganda"}
+		assert.Equal(t, ValidationErr{Field: "country", Message: `"Kenya|Uganda" contains the separator |`}, params.Validate())
+	})
+
+	t.Run("empty countries with inc_iso", func(t *testing.T) {
+		params := NewDefaultSearchParams()
+		for _, c := range []string{"", " "} {
+			params.Country = []string{c}
+			assert.Equal(t, ValidationErr{Field: "country", Message: "must not be empty"}, params.Validate())
+		}
+		params.Country = []string{"KEN|UGA"}
+		assert.Equal(t, ValidationErr{Field: "country", Message: `"KEN|UGA" contains the separator |`}, params.Validate())
+	})
+
+	t.Run("page size", func(t *testing.T) {
+		params := NewDefaultSearchParams()
+		params.Ps = -1
+		assert.Equal(t, ValidationErr{Field: "ps", Message: "must be between 1 and 300, or 0 for the catalog default"}, params.Validate())
+	})
+}
+
+func TestSearchDecoding(t *testing.T) {
+	t.Run("rows are kept as returned", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"result":{"found":1,"rows":[{"idno":"KEN_2021_HFS","varcount":"12","year_start":2021.0,"year_end":null,"rank":1}],"total":1}}`))
+		}))
+		defer ts.Close()
+
+		surveys, err := NewClient(ts.URL).Search(context.Background(), NewDefaultSearchParams())
+		assert.NoError(t, err)
+		assert.Len(t, surveys, 1)
+		assert.Equal(t, 12, surveys[0].Varcount)
+		assert.Equal(t, 2021, surveys[0].Start)
+		assert.Equal(t, 0, surveys[0].End)
+		assert.JSONEq(t, `{"idno":"KEN_2021_HFS","varcount":"12","year_start":2021.0,"year_end":null,"rank":1}`, string(surveys[0].Data))
+
+		fields, err := surveys[0].Fields()
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1), fields["rank"])
+	})
+
+	for body, want := range map[string]int{
+		`{"result":{"rows":[]}}`:   0,
+		`{"result":{"rows":null}}`: 0,
+		`{"result":null}`:          0,
+		`{"status":"ok"}`:          0,
+		expectedSearchResponse:     5,
+	} {
+		var n int
+		err := decodeSearch(strings.NewReader(body), func(json.RawMessage) error { n++; return nil })
+		assert.NoError(t, err, body)
+		assert.Equal(t, want, n, body)
+	}
+
+	for body, msg := range map[string]string{
+		`{"result":{"rows":[{"varcount":"many"}]}}`: "failed to unmarshal response into surveys slice",
+		`{"result":{"rows":[{"varcount":true}]}}`:   "unexpected type: bool",
+		`{"result":{"rows":{}}}`:                    "expected rows array",
+		`{"result":[]}`:                             "expected result object",
+		`{"result":{"rows":[{"idno":"X"},`:          "failed to unmarshal response",
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+		_, err := NewClient(ts.URL).Search(context.Background(), NewDefaultSearchParams())
+		assert.IsType(t, AppErr{}, err, body)
+		assert.ErrorContains(t, err, msg, body)
+		ts.Close()
+	}
+}
+
+// searchPage builds a search response with n rows shaped like those of the
+// IHSN catalog
+func searchPage(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"result":{"rows":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"idno":"ALB_2020_WBCS_v%02d_M","formid":5,"form_model":"remote","title":"World Bank Group Country Survey 2020","nation":"Albania","year_start":"2020","year_end":2020,"repositoryid":"central","created":"2021-01-19T01:55:01+00:00","changed":"2021-01-19T01:55:01+00:00","varcount":%d,"total_views":394,"authoring_entity":"Public Opinion Research Group","total_downloads":31,"rank":1,"type":"survey","id":%d,"url":"https:\/\/catalog.ihsn.org\/catalog\/%d"}`, i, i, i, i)
+	}
+	fmt.Fprintf(&b, `],"found":%d,"total":10174,"limit":%d,"offset":0,"search_counts_by_type":{"survey":%d},"page":1}}`, n, n, n)
+	return b.Bytes()
+}
+
+// roundTripSurveys is the previous decoding path, kept as a baseline: the body
+// is read whole, rows decoded into maps, and each row marshalled and decoded
+// again into a Survey
+func roundTripSurveys(r io.Reader) ([]Survey, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var response SearchResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	surveys := make([]Survey, 0)
+	for _, row := range response.Result.Rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		var survey Survey
+		if err := json.Unmarshal(b, &survey); err != nil {
+			return nil, err
+		}
+		surveys = append(surveys, survey)
+	}
+	return surveys, nil
+}
+
+// BenchmarkSearch measures Query.Search against a local catalog, with the
+// previous decoding path over the same server as a baseline
+func BenchmarkSearch(b *testing.B) {
+	ctx := context.Background()
+
+	for _, n := range []int{30, MaxPageSize} {
+		page := searchPage(n)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(page)
+		}))
+		defer ts.Close()
+
+		b.Run(fmt.Sprintf("roundtrip/%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(page)))
+			for i := 0; i < b.N; i++ {
+				resp, err := http.Get(ts.URL + "/search")
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = roundTripSurveys(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("streaming/%d", n), func(b *testing.B) {
+			client := NewClient(ts.URL)
+			q := NewQuery().PageSize(n)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(page)))
+			for i := 0; i < b.N; i++ {
+				surveys, err := q.Search(ctx, client)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(surveys) != n {
+					b.Fatalf("got %d surveys, want %d", len(surveys), n)
+				}
+			}
+		})
+	}
+}
+
 var expectedSearchResponse = `{"result":{"rows":[{"idno":"ALB_2020_ES-COVID19-R1_v01_M","formid":5,"form_model":"remote","title":"Enterprise Survey Follow-up on COVID-19 2020, Round 1","nation":"Albania","year_start":"2020","year_end":2020,"repositoryid":"central","created":"2022-05-11T11:14:45+00:00","changed":"2022-05-11T11:14:46+00:00","varcount":"85","total_views":125,"authoring_entity":"World Bank Group","total_downloads":6,"rank":1,"type":"survey","id":10252,"url":"https:\/\/catalog.ihsn.org\/catalog\/10252"},{"idno":"WLD_2020_CTIS_v01_M","formid":5,"form_model":"remote","title":"COVID-19 Trends and Impact Survey (2020-Ongoing)","nation":"Afghanistan, Albania, Algeria, Angola, Argentina, Armenia, Australia, Austria, Azerbaijan, Banglades","year_start":2020,"year_end":2021,"repositoryid":"central","created":"2021-11-03T19:32:10+00:00","changed":"2021-11-03T19:34:21+00:00","varcount":0,"total_views":293,"authoring_entity":"Facebook Data for Good, Carnegie Mellon University, University of Maryland","total_downloads":0,"rank":1,"type":"survey","id":9884,"url":"https:\/\/catalog.ihsn.org\/catalog\/9884"},{"idno":"WLD_2020_FBS_v01_M","formid":5,"form_model":"remote","title":"Future of Business Survey 2020","nation":"Albania, Algeria, American Samoa...and 176 more","year_start":2020,"year_end":2020,"repositoryid":"central","created":"2021-12-08T21:42:48+00:00","changed":"2022-06-14T13:16:49+00:00","varcount":0,"total_views":160,"authoring_entity":"Facebook, The Organisation for Economic Co-operation and Development (OECD), World Bank","total_downloads":5,"rank":1,"type":"survey","id":9891,"url":"https:\/\/catalog.ihsn.org\/catalog\/9891"},{"idno":"ALB_2020_WBCS_v01_M","formid":5,"form_model":"remote","title":"World Bank Group Country Survey 2020","nation":"Albania","year_start":2020,"year_end":2020,"repositoryid":"central","created":"2021-01-19T01:55:01+00:00","changed":"2021-01-19T01:55:01+00:00","varcount":289,"total_views":394,"authoring_entity":"Public Opinion Research Group","total_downloads":31,"rank":1,"type":"survey","id":9523,"url":"https:\/\/catalog.ihsn.org\/catalog\/9523"},{"idno":"ALB_2020_FIES_v01_M_v01_A_OCS","formid":5,"title":"Food Insecurity Experience Scale 2020","nation":"Albania","authoring_entity":"FAO Statistics Division","form_model":"remote","year_start":2020,"year_end":2020,"repositoryid":"central","link_da":"https:\/\/microdata.fao.org\/index.php\/catalog\/1921","created":"2023-01-25T16:22:45+00:00","changed":"2023-01-25T16:22:45+00:00","varcount":0,"total_views":0,"total_downloads":0,"rank":1,"type":"survey","id":10987,"url":"https:\/\/catalog.ihsn.org\/catalog\/10987"}],"found":5,"total":10174,"limit":15,"offset":0,"search_counts_by_type":{"survey":5},"page":1}}`
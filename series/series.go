@@ -0,0 +1,280 @@
+// Package series groups catalog studies into series, such as the rounds of a
+// phone survey or the waves of a panel, and follows variables across them.
+package series
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/text"
+)
+
+type Wave struct {
+	Survey nadago.Survey
+	// Round is the round, wave or phase number found in the title or idno, or
+	// zero when there is none
+	Round int
+}
+
+type Series struct {
+	// Key is the idno stem shared by the waves, with years, rounds and
+	// versions removed
+	Key    string
+	Title  string
+	Nation string
+	Waves  []Wave
+}
+
+type grouper struct {
+	threshold float64
+	maxGap    int
+}
+
+type Option func(g *grouper)
+
+// WithTitleThreshold sets how similar two titles must be, once years and round
+// numbers are removed, for studies with different idno stems to be grouped.
+// The default is 0.8
+func WithTitleThreshold(t float64) Option {
+	return func(g *grouper) {
+		g.threshold = t
+	}
+}
+
+// WithMaxGap sets the largest number of years between neighbouring waves of a
+// series. Waves are chained, so a series can span more than the gap as long
+// as no two consecutive waves are further apart. The default is 5
+func WithMaxGap(years int) Option {
+	return func(g *grouper) {
+		g.maxGap = years
+	}
+}
+
+var (
+	versionSuffix = regexp.MustCompile(`(?i)_v\d+(_[a-z]+)*$`)
+	idnoRound     = regexp.MustCompile(`(?i)^(?:r|w|round|wave|phase)(\d+)$`)
+	titleRound    = regexp.MustCompile(`(?i)\b(?:round|wave|phase|r)\s*(\d+)\b`)
+	yearToken     = regexp.MustCompile(`^(19|20)\d\d$`)
+)
+
+// Group clusters surveys into series. Two studies are linked when they share a
+// nation, lie within the maximum gap of years and have either the same idno
+// stem or similar titles. Series are the chains of linked studies, so the
+// first and last waves may be further apart than the gap. Studies without a
+// counterpart form series of one
+func Group(surveys []nadago.Survey, opts ...Option) []Series {
+	g := grouper{threshold: 0.8, maxGap: 5}
+	for _, o := range opts {
+		o(&g)
+	}
+
+	stems := make([]string, len(surveys))
+	titles := make([][]string, len(surveys))
+	for i, s := range surveys {
+		stems[i] = stem(s.Idno)
+		titles[i] = titleWords(s.Title)
+	}
+
+	parent := make([]int, len(surveys))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range surveys {
+		for j := i + 1; j < len(surveys); j++ {
+			a, b := surveys[i], surveys[j]
+			if a.Nation != b.Nation || gap(a, b) > g.maxGap {
+				continue
+			}
+			if (stems[i] != "" && stems[i] == stems[j]) || text.Jaccard(titles[i], titles[j]) >= g.threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int]*Series{}
+	var order []int
+	for i, s := range surveys {
+		root := find(i)
+		if groups[root] == nil {
+			groups[root] = &Series{Key: stems[i], Nation: s.Nation}
+			order = append(order, root)
+		}
+		groups[root].Waves = append(groups[root].Waves, Wave{Survey: s, Round: round(s)})
+	}
+
+	series := make([]Series, 0, len(order))
+	for _, root := range order {
+		s := groups[root]
+		sortWaves(s.Waves)
+		s.Title = commonTitle(s.Waves)
+		series = append(series, *s)
+	}
+	return series
+}
+
+// Find returns the series containing idno
+func Find(series []Series, idno string) (Series, bool) {
+	for _, s := range series {
+		for _, w := range s.Waves {
+			if w.Survey.Idno == idno {
+				return s, true
+			}
+		}
+	}
+	return Series{}, false
+}
+
+// stem removes the version suffix, years and round markers from an idno, so
+// NGA_2020_COVID_R1_v01_M and NGA_2021_COVID_R7_v02_M share the stem NGA_COVID
+func stem(idno string) string {
+	var parts []string
+	for _, p := range strings.Split(versionSuffix.ReplaceAllString(idno, ""), "_") {
+		if p == "" || yearToken.MatchString(p) || idnoRound.MatchString(p) {
+			continue
+		}
+		parts = append(parts, strings.ToUpper(p))
+	}
+	return strings.Join(parts, "_")
+}
+
+func titleWords(title string) []string {
+	var words []string
+	for _, t := range text.Tokenize(titleRound.ReplaceAllString(title, " ")) {
+		if _, err := strconv.Atoi(t); err == nil {
+			continue
+		}
+		words = append(words, t)
+	}
+	return words
+}
+
+func round(s nadago.Survey) int {
+	if m := titleRound.FindStringSubmatch(s.Title); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	for _, p := range strings.Split(versionSuffix.ReplaceAllString(s.Idno, ""), "_") {
+		if m := idnoRound.FindStringSubmatch(p); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
+
+func gap(a, b nadago.Survey) int {
+	d := a.Start - b.Start
+	if d < 0 {
+		d = -d
+	}
+	return d
+}
+
+// sortWaves orders waves by year, then round number, then release date
+func sortWaves(waves []Wave) {
+	sort.SliceStable(waves, func(i, j int) bool {
+		a, b := waves[i], waves[j]
+		if a.Survey.Start != b.Survey.Start {
+			return a.Survey.Start < b.Survey.Start
+		}
+		if a.Round != b.Round {
+			return a.Round < b.Round
+		}
+		if !a.Survey.Created.Equal(b.Survey.Created.Time) {
+			return a.Survey.Created.Before(b.Survey.Created.Time)
+		}
+		return a.Survey.Idno < b.Survey.Idno
+	})
+}
+
+// commonTitle returns the title of the first wave without its round marker
+func commonTitle(waves []Wave) string {
+	t := titleRound.ReplaceAllString(waves[0].Survey.Title, "")
+	t = strings.Join(strings.Fields(t), " ")
+	return strings.Trim(t, " ,-:")
+}
+
+// LoadVariables fetches the variable list of every wave, keyed by idno
+func LoadVariables(ctx context.Context, c *nadago.Client, s Series) (map[string][]nadago.Variable, error) {
+	vars := make(map[string][]nadago.Variable, len(s.Waves))
+	for _, w := range s.Waves {
+		list, err := c.GetSurveyVars(ctx, w.Survey.Idno)
+		if err != nil {
+			return nil, err
+		}
+		vars[w.Survey.Idno] = list.List()
+	}
+	return vars, nil
+}
+
+// Presence describes a tracked variable in one wave
+type Presence struct {
+	Idno    string
+	Present bool
+	Vid     string
+	Name    string
+	Label   string
+	// Renamed is set when the variable was found by its label under a new name
+	Renamed bool
+	// LabelChanged is set when the label differs from the previous wave the
+	// variable was present in
+	LabelChanged bool
+}
+
+// Track follows a variable through the waves of a series. Variables are found
+// by name, or failing that by the label last seen, to follow renames
+func (s Series) Track(name string, vars map[string][]nadago.Variable) []Presence {
+	track := make([]Presence, 0, len(s.Waves))
+	current, lastLabel := name, ""
+
+	for _, w := range s.Waves {
+		p := Presence{Idno: w.Survey.Idno}
+		list := vars[w.Survey.Idno]
+
+		v, ok := byName(list, current)
+		if !ok && lastLabel != "" {
+			if v, ok = byLabel(list, lastLabel); ok {
+				p.Renamed = true
+			}
+		}
+
+		if ok {
+			p.Present = true
+			p.Vid, p.Name, p.Label = v.Vid, v.Name(), v.Label()
+			p.LabelChanged = lastLabel != "" && !strings.EqualFold(p.Label, lastLabel)
+			current, lastLabel = p.Name, p.Label
+		}
+		track = append(track, p)
+	}
+	return track
+}
+
+func byName(vars []nadago.Variable, name string) (nadago.Variable, bool) {
+	for _, v := range vars {
+		if strings.EqualFold(v.Name(), name) {
+			return v, true
+		}
+	}
+	return nadago.Variable{}, false
+}
+
+func byLabel(vars []nadago.Variable, label string) (nadago.Variable, bool) {
+	for _, v := range vars {
+		if strings.EqualFold(strings.TrimSpace(v.Label()), strings.TrimSpace(label)) {
+			return v, true
+		}
+	}
+	return nadago.Variable{}, false
+}
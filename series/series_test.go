@@ -0,0 +1,107 @@
+package series
+
+import (
+	"testing"
+	"time"
+
+	"github.com/northeastloon/nadago"
+	"github.com/northeastloon/nadago/internal/fixture"
+	"github.com/stretchr/testify/assert"
+)
+
+func survey(idno, title, nation string, year int) nadago.Survey {
+	return nadago.Survey{Idno: idno, Title: title, Nation: nation, Start: year, End: year,
+		Created: nadago.CatalogTime{Time: time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC)}}
+}
+
+var surveys = []nadago.Survey{
+	survey("NGA_2020_NLPS_R3_v01_M", "COVID-19 National Longitudinal Phone Survey 2020, Round 3", "Nigeria", 2020),
+	survey("KEN_2019_KIHBS_v01_M", "Kenya Integrated Household Budget Survey 2019", "Kenya", 2019),
+	survey("NGA_2020_NLPS_R1_v02_M", "COVID-19 National Longitudinal Phone Survey 2020, Round 1", "Nigeria", 2020),
+	survey("NGA_2021_NLPS_R12_v01_M", "COVID-19 National Longitudinal Phone Survey 2021, Round 12", "Nigeria", 2021),
+	// same programme released under a different idno scheme
+	survey("NGA_2020_COVID19_W2", "COVID-19 National Longitudinal Phone Survey 2020, Round 2", "Nigeria", 2020),
+	// same title elsewhere is a different series
+	survey("GHA_2020_NLPS_R1_v01_M", "COVID-19 National Longitudinal Phone Survey 2020, Round 1", "Ghana", 2020),
+	survey("KEN_2005_KIHBS_v01_M", "Kenya Integrated Household Budget Survey 2005", "Kenya", 2005),
+}
+
+func TestGroup(t *testing.T) {
+	series := Group(surveys)
+	assert.Len(t, series, 4)
+
+	nga := series[0]
+	assert.Equal(t, "NGA_NLPS", nga.Key)
+	assert.Equal(t, "Nigeria", nga.Nation)
+	assert.Equal(t, "COVID-19 National Longitudinal Phone Survey 2020", nga.Title)
+
+	var idnos []string
+	var rounds []int
+	for _, w := range nga.Waves {
+		idnos = append(idnos, w.Survey.Idno)
+		rounds = append(rounds, w.Round)
+	}
+	assert.Equal(t, []string{"NGA_2020_NLPS_R1_v02_M", "NGA_2020_COVID19_W2", "NGA_2020_NLPS_R3_v01_M", "NGA_2021_NLPS_R12_v01_M"}, idnos)
+	assert.Equal(t, []int{1, 2, 3, 12}, rounds)
+
+	// fourteen years apart is beyond the default gap
+	assert.Equal(t, "KEN_KIHBS", series[1].Key)
+	assert.Len(t, series[1].Waves, 1)
+	assert.Equal(t, "Ghana", series[2].Nation)
+	assert.Len(t, series[3].Waves, 1)
+
+	t.Run("options", func(t *testing.T) {
+		// without title matching the differently named release is split off
+		series := Group(surveys, WithMaxGap(20), WithTitleThreshold(1.1))
+		assert.Len(t, series, 4)
+		assert.Len(t, series[0].Waves, 3)
+		assert.Equal(t, "NGA_COVID19", series[2].Key)
+
+		assert.Len(t, series[1].Waves, 2)
+		assert.Equal(t, "KEN_2005_KIHBS_v01_M", series[1].Waves[0].Survey.Idno)
+	})
+
+	t.Run("waves are chained", func(t *testing.T) {
+		// each wave is within the gap of the previous one, not of the first
+		series := Group([]nadago.Survey{
+			survey("ALB_2002_LSMS_v01_M", "Living Standards Measurement Survey 2002", "Albania", 2002),
+			survey("ALB_2005_LSMS_v01_M", "Living Standards Measurement Survey 2005", "Albania", 2005),
+			survey("ALB_2008_LSMS_v01_M", "Living Standards Measurement Survey 2008", "Albania", 2008),
+			survey("ALB_2012_LSMS_v01_M", "Living Standards Measurement Survey 2012", "Albania", 2012),
+		}, WithMaxGap(4))
+		assert.Len(t, series, 1)
+		assert.Len(t, series[0].Waves, 4)
+	})
+
+	t.Run("find", func(t *testing.T) {
+		s, ok := Find(series, "NGA_2020_COVID19_W2")
+		assert.True(t, ok)
+		assert.Equal(t, "NGA_NLPS", s.Key)
+		_, ok = Find(series, "missing")
+		assert.False(t, ok)
+	})
+}
+
+func TestStem(t *testing.T) {
+	assert.Equal(t, "NGA_COVID", stem("NGA_2020_COVID_R1_v01_M"))
+	assert.Equal(t, "ETH_ESS", stem("ETH_2018_ESS_v03_M_STATA"))
+	assert.Equal(t, "ALB_LFS", stem("ALB_2019_LFS_W3"))
+}
+
+func TestTrack(t *testing.T) {
+	s := Group(surveys)[0]
+	vars := map[string][]nadago.Variable{
+		"NGA_2020_NLPS_R1_v02_M":  {fixture.Row("R1", "V1", "s6q1", "Household received assistance")},
+		"NGA_2020_COVID19_W2":     {fixture.Row("W2", "V3", "S6Q1", "Household received any assistance")},
+		"NGA_2020_NLPS_R3_v01_M":  {fixture.Row("R3", "V9", "other", "Other")},
+		"NGA_2021_NLPS_R12_v01_M": {fixture.Row("R12", "V4", "assist", "household received any assistance")},
+	}
+
+	track := s.Track("s6q1", vars)
+	assert.Equal(t, []Presence{
+		{Idno: "NGA_2020_NLPS_R1_v02_M", Present: true, Vid: "V1", Name: "s6q1", Label: "Household received assistance"},
+		{Idno: "NGA_2020_COVID19_W2", Present: true, Vid: "V3", Name: "S6Q1", Label: "Household received any assistance", LabelChanged: true},
+		{Idno: "NGA_2020_NLPS_R3_v01_M"},
+		{Idno: "NGA_2021_NLPS_R12_v01_M", Present: true, Vid: "V4", Name: "assist", Label: "household received any assistance", Renamed: true},
+	}, track)
+}
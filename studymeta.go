@@ -3,8 +3,8 @@ package nadago
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
+	"io"
+	"net/url"
 )
 
 type SurveyMeta struct {
@@ -13,43 +13,107 @@ type SurveyMeta struct {
 }
 
 func (c *Client) GetSurveyMeta(ctx context.Context, idno string) (SurveyMeta, error) {
-
-	//create a http request to the search endpoint
-	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+"/"+idno, nil)
-	if err != nil {
-		return SurveyMeta{}, AppErr{
-			Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
-	}
-
-	// make request and unmarshal response
-	resp, err := c.httpClient.Do(req)
+	version, err := c.version(ctx, "study")
 	if err != nil {
-		return SurveyMeta{}, AppErr{
-			Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return SurveyMeta{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return SurveyMeta{}, FetchErr{
-			Message:    "non-200 status code from the API",
-			StatusCode: resp.StatusCode,
-		}
+	s := studySchema
+	if version == NADA4 {
+		s = study4Schema
 	}
+	drift := c.driftCheck("study", idno, version)
+	defer c.reportDrift(drift)
 
-	// decode JSON response into SurveyMeta struct
 	var meta SurveyMeta
-	err = json.NewDecoder(resp.Body).Decode(&meta)
+	err = c.get(ctx, request{
+		endpoint: "study",
+		path:     "/" + url.PathEscape(idno),
+		coalesce: true,
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}},
+	}, func(r io.Reader) error {
+		return drift.decode(r, &meta, func(raw json.RawMessage) {
+			drift.checkMember(raw, "dataset", s, false)
+		})
+	})
 	if err != nil {
-		return SurveyMeta{}, AppErr{
-			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return SurveyMeta{}, err
 	}
 	meta.Idno = idno
+	normaliseStudy(meta.Data, version)
 
 	return meta, nil
 }
+
+func (m SurveyMeta) Title() string {
+	return stringOf(lookup(m.Data, "title"))
+}
+
+func (m SurveyMeta) Nation() string {
+	return stringOf(lookup(m.Data, "nation"))
+}
+
+func (m SurveyMeta) Abstract() string {
+	return stringOf(lookup(m.Data, "metadata", "study_desc", "study_info", "abstract"))
+}
+
+func (m SurveyMeta) SamplingProcedure() string {
+	return stringOf(lookup(m.Data, "metadata", "study_desc", "method", "data_collection", "sampling_procedure"))
+}
+
+// Created returns when the study was added to the catalog
+func (m SurveyMeta) Created() CatalogTime {
+	return catalogTimeOf(lookup(m.Data, "created"))
+}
+
+// Changed returns when the study was last updated in the catalog
+func (m SurveyMeta) Changed() CatalogTime {
+	return catalogTimeOf(lookup(m.Data, "changed"))
+}
+
+type DataFile struct {
+	ID          string
+	Name        string
+	Description string
+	CaseCount   int
+	VarCount    int
+}
+
+// DataFiles returns the data file descriptions of the study, read from the
+// survey schema's metadata.data_files or, for ParseDDI output, data_files
+func (m SurveyMeta) DataFiles() []DataFile {
+	raw, ok := lookup(m.Data, "metadata", "data_files").([]interface{})
+	if !ok {
+		raw, _ = lookup(m.Data, "data_files").([]interface{})
+	}
+
+	files := make([]DataFile, 0, len(raw))
+	for _, r := range raw {
+		f, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cases, _ := convertToInt(f["case_count"])
+		vars, _ := convertToInt(f["var_count"])
+		files = append(files, DataFile{
+			ID:          stringOf(f["file_id"]),
+			Name:        stringOf(f["file_name"]),
+			Description: stringOf(f["description"]),
+			CaseCount:   cases,
+			VarCount:    vars,
+		})
+	}
+	return files
+}
+
+// lookup walks nested JSON objects and returns nil when any key is missing
+func lookup(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
@@ -3,8 +3,9 @@ package nadago
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
+	"io"
+	"net/url"
+	"strconv"
 )
 
 type Variable struct {
@@ -14,44 +15,164 @@ type Variable struct {
 }
 
 func (c *Client) GetVarMeta(ctx context.Context, idno string, vid string) (Variable, error) {
-
-	//create a http request to the search endpoint
-	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+"/"+idno+"/variables/"+vid, nil)
+	version, err := c.version(ctx, "variable")
 	if err != nil {
-		return Variable{}, AppErr{
-			Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return Variable{}, err
 	}
 
-	// make request and unmarshal response
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return Variable{}, AppErr{
-			Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return Variable{}, FetchErr{
-			Message:    "non-200 status code from the API",
-			StatusCode: resp.StatusCode,
-		}
+	s := variableSchema
+	if version == NADA4 {
+		s = variable4Schema
 	}
+	drift := c.driftCheck("variable", idno, version)
+	defer c.reportDrift(drift)
 
 	var v Variable
-	err = json.NewDecoder(resp.Body).Decode(&v)
+	err = c.get(ctx, request{
+		endpoint: "variable",
+		path:     "/" + url.PathEscape(idno) + "/variables/" + url.PathEscape(vid),
+		coalesce: true,
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}, {Key: "nadago.vid", Value: vid}},
+	}, func(r io.Reader) error {
+		return drift.decode(r, &v, func(raw json.RawMessage) {
+			drift.checkMember(raw, "variable", s, false)
+		})
+	})
 	if err != nil {
-		return Variable{}, AppErr{
-			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return Variable{}, err
 	}
 	v.Idno = idno
 	v.Vid = vid
+	normaliseVariable(v.Data, version)
 
 	return v, nil
+}
+
+type Category struct {
+	Value string
+	Label string
+	Stats []SumStat
+}
+
+type SumStat struct {
+	Type     string
+	Value    string
+	Weighted bool
+}
+
+// Name returns the variable name from either a variable list row or a
+// GetVarMeta response
+func (v Variable) Name() string {
+	return v.field("name")
+}
+
+func (v Variable) Label() string {
+	return v.field("labl")
+}
+
+func (v Variable) FileID() string {
+	if fid := v.field("fid"); fid != "" {
+		return fid
+	}
+	return v.field("file_id")
+}
+
+// Question returns the literal question text
+func (v Variable) Question() string {
+	if q := stringOf(v.metadata()["var_qstn_qstnlit"]); q != "" {
+		return q
+	}
+	return stringOf(v.data()["qstn"])
+}
+
+// Interval returns the measurement interval, "discrete" for categorical and
+// "contin" for continuous variables, or "" when the catalog does not give one
+func (v Variable) Interval() string {
+	return stringOf(v.metadata()["var_intrvl"])
+}
 
+func (v Variable) Categories() []Category {
+	raw, ok := v.metadata()["var_catgry"].([]interface{})
+	if !ok {
+		raw, _ = v.data()["catgry"].([]interface{})
+	}
+
+	cats := make([]Category, 0, len(raw))
+	for _, r := range raw {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stats, _ := m["stats"].([]interface{})
+		cats = append(cats, Category{
+			Value: stringOf(m["value"]),
+			Label: stringOf(m["labl"]),
+			Stats: toSumStats(stats),
+		})
+	}
+	return cats
+}
+
+// SumStats returns the summary statistics such as valid and invalid counts
+func (v Variable) SumStats() []SumStat {
+	raw, _ := v.metadata()["var_sumstat"].([]interface{})
+	return toSumStats(raw)
+}
+
+// Frequency returns the unweighted frequency of the category
+func (c Category) Frequency() (float64, bool) {
+	for _, s := range c.Stats {
+		if s.Type == "freq" && !s.Weighted {
+			f, err := strconv.ParseFloat(s.Value, 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+func (v Variable) data() map[string]interface{} {
+	m, _ := v.Data.(map[string]interface{})
+	return m
+}
+
+func (v Variable) metadata() map[string]interface{} {
+	m, _ := v.data()["metadata"].(map[string]interface{})
+	return m
+}
+
+func (v Variable) field(key string) string {
+	if s := stringOf(v.data()[key]); s != "" {
+		return s
+	}
+	return stringOf(v.metadata()[key])
+}
+
+func toSumStats(raw []interface{}) []SumStat {
+	stats := make([]SumStat, 0, len(raw))
+	for _, r := range raw {
+		m, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		wgtd := stringOf(m["wgtd"])
+		stats = append(stats, SumStat{
+			Type:     stringOf(m["type"]),
+			Value:    stringOf(m["value"]),
+			Weighted: wgtd != "" && wgtd != "0" && wgtd != "false",
+		})
+	}
+	return stats
+}
+
+func stringOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
 }
@@ -2,6 +2,7 @@ package nadago
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -96,3 +97,42 @@ func TestGetVarMeta(t *testing.T) {
 }
 
 var expectedVarMetaResponse = `{"variable":{"uid":"19260146","sid":"10894","fid":"F1","vid":"V1","name":"Random_ID","labl":"Unique respondent identifier","qstn":null,"catgry":null,"metadata":{"file_id":"F1","vid":"V1","name":"Random_ID","var_intrvl":"contin","var_dcml":"0","var_wgt":null,"var_is_wgt":null,"loc_start_pos":null,"loc_end_pos":null,"loc_width":null,"loc_rec_seg_no":null,"labl":"Unique respondent identifier","var_imputation":null,"var_security":null,"var_resp_unit":null,"var_analysis_unit":null,"var_qstn_preqtxt":null,"var_qstn_qstnlit":null,"var_qstn_postqtxt":null,"var_qstn_ivuinstr":null,"var_universe":null,"var_universe_clusion":null,"var_sumstat":[{"value":"0","type":"vald","wgtd":null},{"value":"0","type":"invd","wgtd":null}],"var_txt":null,"var_catgry":[],"var_codinstr":null,"var_concept":[],"var_format":{"type":"numeric","schema":"other","category":null,"name":null},"var_notes":null,"var_val_range":{"min":null,"max":null},"fid":"F1"},"keywords":null}}`
+
+func TestVariableAccessors(t *testing.T) {
+	var v Variable
+	assert.NoError(t, json.Unmarshal([]byte(expectedCategoricalVarMetaResponse), &v))
+
+	assert.Equal(t, "Gender", v.Name())
+	assert.Equal(t, "Gender of the respondent", v.Label())
+	assert.Equal(t, "F1", v.FileID())
+	assert.Equal(t, "Are you male or female?", v.Question())
+	assert.Equal(t, "discrete", v.Interval())
+
+	cats := v.Categories()
+	assert.Len(t, cats, 2)
+	assert.Equal(t, Category{
+		Value: "1",
+		Label: "Male",
+		Stats: []SumStat{{Type: "freq", Value: "512"}, {Type: "freq", Value: "498.7", Weighted: true}},
+	}, cats[0])
+
+	freq, ok := cats[1].Frequency()
+	assert.True(t, ok)
+	assert.Equal(t, float64(488), freq)
+
+	assert.Equal(t, []SumStat{{Type: "vald", Value: "1000"}, {Type: "invd", Value: "0"}}, v.SumStats())
+
+	t.Run("missing fields", func(t *testing.T) {
+		empty := Variable{}
+		assert.Equal(t, "", empty.Name())
+		assert.Equal(t, "", empty.Question())
+		assert.Equal(t, "", empty.Interval())
+		assert.Empty(t, empty.Categories())
+		assert.Empty(t, empty.SumStats())
+
+		_, ok := Category{}.Frequency()
+		assert.False(t, ok)
+	})
+}
+
+var expectedCategoricalVarMetaResponse = `{"variable":{"uid":"19260167","sid":"10894","fid":"F1","vid":"V22","name":"Gender","labl":"Gender of the respondent","qstn":null,"catgry":null,"metadata":{"file_id":"F1","vid":"V22","name":"Gender","var_intrvl":"discrete","labl":"Gender of the respondent","var_qstn_qstnlit":"Are you male or female?","var_sumstat":[{"value":"1000","type":"vald","wgtd":null},{"value":"0","type":"invd","wgtd":null}],"var_catgry":[{"value":"1","labl":"Male","stats":[{"type":"freq","value":"512","wgtd":null},{"type":"freq","value":"498.7","wgtd":"wgtd"}]},{"value":"2","labl":"Female","stats":[{"type":"freq","value":488,"wgtd":null}]}],"var_format":{"type":"numeric","schema":"other","category":null,"name":null}},"keywords":null}}`
@@ -5,7 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"io"
+	"net/url"
 )
 
 type Variables struct {
@@ -15,42 +16,31 @@ type Variables struct {
 }
 
 func (c *Client) GetSurveyVars(ctx context.Context, idno string) (Variables, error) {
-
-	//create a http request to the search endpoint
-	req, err := http.NewRequestWithContext(ctx, "GET", c.apiURL+"/"+idno+"/variables", nil)
+	version, err := c.version(ctx, "variables")
 	if err != nil {
-		return Variables{}, AppErr{
-			Message:    fmt.Errorf("failed to generate http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
-	}
-
-	// make request and unmarshal response
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return Variables{}, AppErr{
-			Message:    fmt.Errorf("failed to complete http request. %w", err).Error(),
-			StatusCode: 1001,
-		}
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return Variables{}, FetchErr{
-			Message:    "non-200 status code from the API",
-			StatusCode: resp.StatusCode,
-		}
+		return Variables{}, err
 	}
+	drift := c.driftCheck("variables", idno, version)
+	defer c.reportDrift(drift)
 
 	var vars Variables
-	err = json.NewDecoder(resp.Body).Decode(&vars)
+	err = c.get(ctx, request{
+		endpoint: "variables",
+		path:     "/" + url.PathEscape(idno) + "/variables",
+		coalesce: true,
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}},
+	}, func(r io.Reader) error {
+		return drift.decode(r, &vars, func(raw json.RawMessage) {
+			drift.checkMember(raw, "variables", variableRowSchemaOf(version), true)
+		})
+	})
 	if err != nil {
-		return Variables{}, AppErr{
-			Message:    fmt.Errorf("failed to unmarshal response. %w", err).Error(),
-			StatusCode: 1001,
-		}
+		return Variables{}, err
 	}
 	vars.Idno = idno
+	for _, row := range vars.Variables {
+		normaliseVariableRow(row, version)
+	}
 
 	err = extractVids(&vars)
 	if err != nil {
@@ -61,7 +51,6 @@ func (c *Client) GetSurveyVars(ctx context.Context, idno string) (Variables, err
 	}
 
 	return vars, nil
-
 }
 
 func extractVids(vars *Variables) error {
@@ -79,3 +68,156 @@ func extractVids(vars *Variables) error {
 	}
 	return nil
 }
+
+// List returns the rows of the variable list as Variables, so their fields can
+// be read with the same accessors as GetVarMeta responses
+func (vars Variables) List() []Variable {
+	list := make([]Variable, 0, len(vars.Variables))
+	for _, row := range vars.Variables {
+		list = append(list, Variable{
+			Idno: vars.Idno,
+			Vid:  stringOf(row["vid"]),
+			Data: row,
+		})
+	}
+	return list
+}
+
+// EachSurveyVar streams the variable list of a study, calling fn with each
+// variable as it is decoded so memory use does not grow with the number of
+// variables. The response is neither read from nor stored in the cache, which
+// would hold it whole. The variables have the list row as Data, like
+// Variables.List. Iteration stops at the first error returned by fn, which
+// EachSurveyVar returns
+func (c *Client) EachSurveyVar(ctx context.Context, idno string, fn func(Variable) error) error {
+	version, err := c.version(ctx, "variables")
+	if err != nil {
+		return err
+	}
+	drift := c.driftCheck("variables", idno, version)
+	defer c.reportDrift(drift)
+
+	var fnErr error
+	err = c.get(ctx, request{
+		endpoint: "variables",
+		path:     "/" + url.PathEscape(idno) + "/variables",
+		attrs:    []Attribute{{Key: "nadago.idno", Value: idno}},
+		uncached: true,
+	}, func(r io.Reader) error {
+		return decodeVariables(r, func(row map[string]interface{}) error {
+			drift.check("", row, variableRowSchemaOf(version))
+			normaliseVariableRow(row, version)
+			vid, ok := row["vid"].(string)
+			if !ok {
+				return AppErr{
+					Message:    "failed to extract variable ids from response. VID field not found",
+					StatusCode: 1001,
+				}
+			}
+			if err := fn(Variable{Idno: idno, Vid: vid, Data: row}); err != nil {
+				fnErr = err
+				return errStopDecoding
+			}
+			return nil
+		})
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+func variableRowSchemaOf(v NADAVersion) schema {
+	if v == NADA4 {
+		return variableRow4Schema
+	}
+	return variableRowSchema
+}
+
+var errStopDecoding = errors.New("stop decoding")
+
+// decodeVariables reads the variables array of a variable list response one
+// row at a time, skipping the other fields of the response
+func decodeVariables(r io.Reader, fn func(row map[string]interface{}) error) error {
+	dec := json.NewDecoder(r)
+	found, err := findArray(dec, "variables")
+	if err != nil || !found {
+		return err
+	}
+	for dec.More() {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			if err == errStopDecoding {
+				return nil
+			}
+			return err
+		}
+	}
+	// the rest of the response is not needed
+	return nil
+}
+
+// findArray reads up to the start of the array found by following keys
+// through nested objects. It reports false if a key is missing or null
+func findArray(dec *json.Decoder, keys ...string) (bool, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return false, err
+	}
+
+	for i, key := range keys {
+		found, err := findKey(dec, key)
+		if err != nil || !found {
+			return false, err
+		}
+
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		last := i == len(keys)-1
+		switch {
+		case tok == nil:
+			return false, nil
+		case last && tok == json.Delim('['):
+			return true, nil
+		case !last && tok == json.Delim('{'):
+		case last:
+			return false, fmt.Errorf("expected %s array, found %v", key, tok)
+		default:
+			return false, fmt.Errorf("expected %s object, found %v", key, tok)
+		}
+	}
+	return false, nil
+}
+
+// findKey skips the members of the current object up to key
+func findKey(dec *json.Decoder, key string) (bool, error) {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if k, _ := tok.(string); k == key {
+			return true, nil
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		return fmt.Errorf("expected %v, found %v", d, tok)
+	}
+	return nil
+}
@@ -1,12 +1,14 @@
 package nadago
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -32,6 +34,13 @@ func TestGetSurveyVars(t *testing.T) {
 		assert.Equal(t, expectedVids, variables.Vids)
 		assert.Equal(t, idno, variables.Idno)
 		assert.NotNil(t, variables.Variables)
+
+		list := variables.List()
+		assert.Len(t, list, 22)
+		assert.Equal(t, idno, list[1].Idno)
+		assert.Equal(t, "V2", list[1].Vid)
+		assert.Equal(t, "WORRIED", list[1].Name())
+		assert.Equal(t, "F1", list[1].FileID())
 	})
 
 	t.Run("bad request", func(t *testing.T) {
@@ -93,4 +102,104 @@ func TestGetSurveyVars(t *testing.T) {
 
 }
 
+func TestEachSurveyVar(t *testing.T) {
+	ctx := context.Background()
+	idno := "LBR_2020_FIES_v01_M_v01_A_OCS"
+
+	t.Run("matches GetSurveyVars", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(expectedVariablesResponse))
+		}))
+		defer ts.Close()
+		client := NewClient(ts.URL)
+
+		var streamed []Variable
+		err := client.EachSurveyVar(ctx, idno, func(v Variable) error {
+			streamed = append(streamed, v)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		vars, err := client.GetSurveyVars(ctx, idno)
+		assert.NoError(t, err)
+		assert.Equal(t, vars.List(), streamed)
+	})
+
+	t.Run("bypasses the cache", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(expectedVariablesResponse))
+		}))
+		defer ts.Close()
+		client := NewClient(ts.URL, WithCache(time.Minute, 10))
+
+		assert.NoError(t, client.EachSurveyVar(ctx, idno, func(Variable) error { return nil }))
+		assert.Empty(t, client.cache.entries)
+	})
+
+	t.Run("stops at the first callback error", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(expectedVariablesResponse))
+		}))
+		defer ts.Close()
+
+		stop := errors.New("enough")
+		var seen int
+		err := NewClient(ts.URL).EachSurveyVar(ctx, idno, func(v Variable) error {
+			seen++
+			if v.Vid == "V3" {
+				return stop
+			}
+			return nil
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 3, seen)
+	})
+
+	t.Run("large lists are streamed", func(t *testing.T) {
+		const n = 100000
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			bw := bufio.NewWriter(w)
+			bw.WriteString(`{"total":100000,"variables":[`)
+			for i := 1; i <= n; i++ {
+				if i > 1 {
+					bw.WriteByte(',')
+				}
+				fmt.Fprintf(bw, `{"fid":"F1","vid":"V%d","name":"var%d","labl":"Variable %d"}`, i, i, i)
+			}
+			bw.WriteString(`],"links":{"next":null}}`)
+			bw.Flush()
+		}))
+		defer ts.Close()
+
+		var count int
+		var last Variable
+		err := NewClient(ts.URL).EachSurveyVar(ctx, idno, func(v Variable) error {
+			count++
+			last = v
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, n, count)
+		assert.Equal(t, "V100000", last.Vid)
+		assert.Equal(t, "var100000", last.Name())
+	})
+
+	t.Run("invalid responses", func(t *testing.T) {
+		for body, msg := range map[string]string{
+			`{"variables":[{"name":"no vid"}]}`: "failed to extract variable ids from response. VID field not found",
+			`{"variables":{"V1":{}}}`:           "expected variables array",
+			`[]`:                                "expected {",
+			`{"variables":[{"vid":"V1"},`:       "failed to unmarshal response",
+		} {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			}))
+			err := NewClient(ts.URL).EachSurveyVar(ctx, idno, func(Variable) error { return nil })
+			assert.IsType(t, AppErr{}, err, body)
+			assert.ErrorContains(t, err, msg, body)
+			ts.Close()
+		}
+	})
+}
+
 var expectedVariablesResponse = `{"total":22,"variables":[{"uid":"19260146","sid":"10894","fid":"F1","vid":"V1","name":"Random_ID","labl":"Unique respondent identifier"},{"uid":"19260147","sid":"10894","fid":"F1","vid":"V2","name":"WORRIED","labl":"Worried you would not have enough food to eat because of a lack of money or other resources"},{"uid":"19260148","sid":"10894","fid":"F1","vid":"V3","name":"HEALTHY","labl":"Unable to eat healthy and nutritious food because of a lack of money or other resources"},{"uid":"19260149","sid":"10894","fid":"F1","vid":"V4","name":"FEWFOOD","labl":"Ate only a few kinds of foods because of a lack of money or other resources"},{"uid":"19260150","sid":"10894","fid":"F1","vid":"V5","name":"SKIPPED","labl":"Skipped a meal because there was not enough money or other resources to get food"},{"uid":"19260151","sid":"10894","fid":"F1","vid":"V6","name":"ATELESS","labl":"Ate less than you thought you should because of a lack of money or other resources"},{"uid":"19260152","sid":"10894","fid":"F1","vid":"V7","name":"RUNOUT","labl":"Household ran out of food because of a lack of money or other resources"},{"uid":"19260153","sid":"10894","fid":"F1","vid":"V8","name":"HUNGRY","labl":"Hungry but did not eat because there was not enough money or other resources for food?"},{"uid":"19260154","sid":"10894","fid":"F1","vid":"V9","name":"WHLDAY","labl":"Went without eating for a whole day because of a lack of money or other resources?"},{"uid":"19260155","sid":"10894","fid":"F1","vid":"V10","name":"wt","labl":"Post-stratification sampling weights"},{"uid":"19260156","sid":"10894","fid":"F1","vid":"V11","name":"year","labl":"Year when the study was administered in the country"},{"uid":"19260157","sid":"10894","fid":"F1","vid":"V12","name":"N_adults","labl":"Number of adults 15 years of age and above in household"},{"uid":"19260158","sid":"10894","fid":"F1","vid":"V13","name":"N_child","labl":"Number of children under 15 years of age in household"},{"uid":"19260159","sid":"10894","fid":"F1","vid":"V14","name":"Raw_score","labl":"Sum of Affirmative responses to FIES questions"},{"uid":"19260160","sid":"10894","fid":"F1","vid":"V15","name":"Raw_score_par","labl":"Estimated person parameters using the Rasch model"},{"uid":"19260161","sid":"10894","fid":"F1","vid":"V16","name":"Raw_score_par_error","labl":"Estimated person parameter errors using the Rasch model"},{"uid":"19260162","sid":"10894","fid":"F1","vid":"V17","name":"Prob_Mod_Sev","labl":"Probability of being moderately or severely food insecure"},{"uid":"19260163","sid":"10894","fid":"F1","vid":"V18","name":"Prob_sev","labl":"Probability of being severely food insecure"},{"uid":"19260164","sid":"10894","fid":"F1","vid":"V19","name":"Age","labl":"Age of the respondent"},{"uid":"19260165","sid":"10894","fid":"F1","vid":"V20","name":"Education","labl":"Education of the respondent"},{"uid":"19260166","sid":"10894","fid":"F1","vid":"V21","name":"Area","labl":"Area"},{"uid":"19260167","sid":"10894","fid":"F1","vid":"V22","name":"Gender","labl":"Gender of the respondent"}]}`
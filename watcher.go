@@ -0,0 +1,355 @@
+package nadago
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type StudyEventType string
+
+const (
+	StudyAdded   StudyEventType = "added"
+	StudyUpdated StudyEventType = "updated"
+)
+
+type StudyEvent struct {
+	Type   StudyEventType
+	Survey Survey
+}
+
+// Checkpoint is the high-water mark of a Watcher. Idnos lists the studies
+// already delivered whose Changed time equals the mark, so studies sharing a
+// timestamp are not delivered twice
+type Checkpoint struct {
+	Changed time.Time `json:"changed"`
+	Idnos   []string  `json:"idnos"`
+}
+
+type CheckpointStore interface {
+	Load() (Checkpoint, error)
+	Save(Checkpoint) error
+}
+
+// FileCheckpointStore persists checkpoints as JSON at Path. A missing file is
+// treated as an empty checkpoint
+type FileCheckpointStore struct {
+	Path string
+}
+
+func (f FileCheckpointStore) Load() (Checkpoint, error) {
+	var cp Checkpoint
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(b, &cp)
+	return cp, err
+}
+
+// Save writes to a temporary file first so a crash never leaves a truncated checkpoint
+func (f FileCheckpointStore) Save(cp Checkpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// Watcher polls a catalog for studies created or changed since its checkpoint
+type Watcher struct {
+	client   *Client
+	params   SearchParams
+	store    CheckpointStore
+	interval time.Duration
+	maxPages int
+	since    time.Time
+	callback func(StudyEvent)
+	events   chan StudyEvent
+}
+
+type WatcherOption func(w *Watcher)
+
+// WithInterval sets the time between polls. The default is one hour
+func WithInterval(d time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.interval = d
+	}
+}
+
+// WithCallback delivers events to fn instead of the Events channel
+func WithCallback(fn func(StudyEvent)) WatcherOption {
+	return func(w *Watcher) {
+		w.callback = fn
+	}
+}
+
+// WithMaxPages limits how many result pages a single poll reads. A poll that
+// reaches the limit before the checkpoint fails rather than skip the studies
+// it has not read. The default, 0, reads until the checkpoint
+func WithMaxPages(n int) WatcherOption {
+	return func(w *Watcher) {
+		w.maxPages = n
+	}
+}
+
+// WithSince sets the starting high-water mark used when the store has no
+// checkpoint yet. Without it the first poll reports every matching study
+func WithSince(t time.Time) WatcherOption {
+	return func(w *Watcher) {
+		w.since = t
+	}
+}
+
+// NewWatcher creates a watcher for studies matching params. Sorting and paging
+// parameters are overridden so the newest changes are read first. Nil params
+// watch the whole catalog
+func NewWatcher(c *Client, params *SearchParams, store CheckpointStore, opts ...WatcherOption) *Watcher {
+	if params == nil {
+		params = NewDefaultSearchParams()
+	}
+	w := &Watcher{
+		client:   c,
+		params:   *params,
+		store:    store,
+		interval: time.Hour,
+		events:   make(chan StudyEvent),
+	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	w.params.Sort_by = SortByChanged
+	w.params.Sort_order = Desc
+	if w.params.Ps == 0 {
+		w.params.Ps = NewDefaultSearchParams().Ps
+	}
+
+	return w
+}
+
+// Events returns the channel events are delivered on when no callback is set.
+// It is closed when Run returns
+func (w *Watcher) Events() <-chan StudyEvent {
+	return w.events
+}
+
+// Poll checks the catalog once, saves the new checkpoint and returns the events
+// found, oldest first
+func (w *Watcher) Poll(ctx context.Context) ([]StudyEvent, error) {
+	prev, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	events, cp, err := w.check(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.save(cp); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Run polls until ctx is cancelled. The checkpoint is only saved once every
+// event from a poll has been delivered, so a restart never skips a study.
+// Failed polls are logged through the logger of the client and retried,
+// waiting up to the poll interval between attempts. Run only returns early
+// when the checkpoint cannot be loaded or saved
+func (w *Watcher) Run(ctx context.Context) error {
+	defer close(w.events)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var backoff time.Duration
+	for {
+		prev, err := w.load()
+		if err != nil {
+			return err
+		}
+
+		events, cp, err := w.check(ctx, prev)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			backoff = w.backoff(backoff)
+			w.client.log(ctx, slog.LevelWarn, "nadago: watcher poll failed",
+				slog.String("error", err.Error()), slog.Duration("retry_in", backoff))
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+		backoff = 0
+
+		for _, e := range events {
+			if w.callback != nil {
+				w.callback(e)
+				continue
+			}
+			select {
+			case w.events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if err := w.save(cp); err != nil {
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns the wait after a failed poll, doubling from a second up to
+// the poll interval
+func (w *Watcher) backoff(prev time.Duration) time.Duration {
+	next := 2 * prev
+	if prev == 0 {
+		next = time.Second
+	}
+	if next > w.interval {
+		next = w.interval
+	}
+	return next
+}
+
+func (w *Watcher) load() (Checkpoint, error) {
+	cp, err := w.store.Load()
+	if err != nil {
+		return Checkpoint{}, AppErr{
+			Message:    fmt.Errorf("failed to load watcher checkpoint. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	return cp, nil
+}
+
+func (w *Watcher) save(cp Checkpoint) error {
+	if err := w.store.Save(cp); err != nil {
+		return AppErr{
+			Message:    fmt.Errorf("failed to save watcher checkpoint. %w", err).Error(),
+			StatusCode: 1001,
+		}
+	}
+	return nil
+}
+
+// check reads results until it passes the checkpoint, so that the next
+// checkpoint never moves past a study that was not delivered
+func (w *Watcher) check(ctx context.Context, prev Checkpoint) ([]StudyEvent, Checkpoint, error) {
+	// polls must see the catalog as it is now, not as it was cached
+	ctx = WithoutCache(ctx)
+	if prev.Changed.IsZero() {
+		prev.Changed = w.since
+	}
+
+	delivered := make(map[string]bool, len(prev.Idnos))
+	for _, idno := range prev.Idnos {
+		delivered[idno] = true
+	}
+
+	var events []StudyEvent
+	seen := map[string]bool{}
+	read := map[string]bool{}
+	params := w.params
+
+	for page := 1; ; page++ {
+		if w.maxPages > 0 && page > w.maxPages {
+			return nil, Checkpoint{}, AppErr{
+				Message:    fmt.Sprintf("more than %d pages of studies changed since the watcher checkpoint", w.maxPages),
+				StatusCode: 1001,
+			}
+		}
+
+		params.Page = page
+		surveys, err := w.client.Search(ctx, &params)
+		if err != nil {
+			return nil, Checkpoint{}, err
+		}
+
+		older, fresh := false, false
+		for _, s := range surveys {
+			if !read[s.Idno] {
+				read[s.Idno] = true
+				fresh = true
+			}
+			if s.Changed.Before(prev.Changed) {
+				older = true
+				continue
+			}
+			if seen[s.Idno] {
+				continue
+			}
+			if s.Changed.Equal(prev.Changed) && delivered[s.Idno] {
+				continue
+			}
+			seen[s.Idno] = true
+
+			e := StudyEvent{Type: StudyUpdated, Survey: s}
+			if s.Created.After(prev.Changed) || s.Created.Equal(s.Changed.Time) {
+				e.Type = StudyAdded
+			}
+			events = append(events, e)
+		}
+
+		// results are newest first, so once a page reaches studies older than the
+		// mark there is nothing further to read. Studies tied with the mark can
+		// span several pages and must not end the poll. A page with no study
+		// not already read means the catalog is past its last page
+		if older || len(surveys) < params.Ps || !fresh {
+			break
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Survey.Changed.Before(events[j].Survey.Changed.Time)
+	})
+
+	next := Checkpoint{Changed: prev.Changed, Idnos: append([]string{}, prev.Idnos...)}
+	for _, e := range events {
+		switch changed := e.Survey.Changed.Time; {
+		case changed.After(next.Changed):
+			next = Checkpoint{Changed: changed, Idnos: []string{e.Survey.Idno}}
+		case changed.Equal(next.Changed):
+			next.Idnos = append(next.Idnos, e.Survey.Idno)
+		}
+	}
+
+	return events, next, nil
+}
@@ -0,0 +1,243 @@
+package nadago
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCatalog serves search results sorted newest change first
+type fakeCatalog struct {
+	mu   sync.Mutex
+	rows []map[string]interface{}
+}
+
+func (f *fakeCatalog) add(idno, created, changed string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.rows {
+		if r["idno"] == idno {
+			r["changed"] = changed
+			return
+		}
+	}
+	f.rows = append(f.rows, map[string]interface{}{
+		"idno": idno, "title": idno, "nation": "Kenya", "year_start": 2021, "year_end": 2021,
+		"created": created, "changed": changed, "varcount": 0,
+	})
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := r.URL.Query()
+	if q.Get("sort_by") != "changed" || q.Get("sort_order") != "desc" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ps, _ := strconv.Atoi(q.Get("ps"))
+	page, _ := strconv.Atoi(q.Get("page"))
+
+	rows := append([]map[string]interface{}{}, f.rows...)
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i]["changed"].(string) > rows[j]["changed"].(string)
+	})
+
+	start := (page - 1) * ps
+	end := start + ps
+	if start > len(rows) {
+		start = len(rows)
+	}
+	if end > len(rows) {
+		end = len(rows)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"rows": rows[start:end]}})
+}
+
+func eventIdnos(events []StudyEvent) []string {
+	idnos := make([]string, 0, len(events))
+	for _, e := range events {
+		idnos = append(idnos, string(e.Type)+":"+e.Survey.Idno)
+	}
+	return idnos
+}
+
+func TestWatcher(t *testing.T) {
+	catalog := &fakeCatalog{}
+	catalog.add("A", "2021-01-01T00:00:00+00:00", "2021-01-01T00:00:00+00:00")
+	catalog.add("B", "2021-02-01T00:00:00+00:00", "2021-02-01T00:00:00+00:00")
+	catalog.add("C", "2021-03-01T00:00:00+00:00", "2021-03-01T00:00:00+00:00")
+
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	params := NewDefaultSearchParams()
+	params.Ps = 2
+	newWatcher := func() *Watcher {
+		return NewWatcher(NewClient(ts.URL), params, store, WithSince(time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)))
+	}
+
+	ctx := context.Background()
+
+	t.Run("first poll reports studies since the start mark", func(t *testing.T) {
+		events, err := newWatcher().Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"added:B", "added:C"}, eventIdnos(events))
+
+		cp, err := store.Load()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"C"}, cp.Idnos)
+	})
+
+	t.Run("nothing new", func(t *testing.T) {
+		events, err := newWatcher().Poll(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("updates and ties survive a restart", func(t *testing.T) {
+		catalog.add("A", "2021-01-01T00:00:00+00:00", "2021-04-01T00:00:00+00:00")
+		catalog.add("D", "2021-04-01T00:00:00+00:00", "2021-04-01T00:00:00+00:00")
+
+		events, err := newWatcher().Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"updated:A", "added:D"}, eventIdnos(events))
+
+		// a study published later with the same timestamp is still delivered once
+		catalog.add("E", "2021-04-01T00:00:00+00:00", "2021-04-01T00:00:00+00:00")
+		events, err = newWatcher().Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"added:E"}, eventIdnos(events))
+
+		events, err = newWatcher().Poll(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("run delivers over channel and callback", func(t *testing.T) {
+		catalog.add("F", "2021-05-01T00:00:00+00:00", "2021-05-01T00:00:00+00:00")
+
+		runCtx, cancel := context.WithCancel(ctx)
+		w := NewWatcher(NewClient(ts.URL), params, store, WithInterval(time.Hour))
+		done := make(chan error)
+		go func() { done <- w.Run(runCtx) }()
+
+		e := <-w.Events()
+		assert.Equal(t, StudyAdded, e.Type)
+		assert.Equal(t, "F", e.Survey.Idno)
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+
+		_, ok := <-w.Events()
+		assert.False(t, ok, "events channel should be closed")
+
+		catalog.add("G", "2021-06-01T00:00:00+00:00", "2021-06-01T00:00:00+00:00")
+		runCtx, cancel = context.WithCancel(ctx)
+		var got []string
+		w = NewWatcher(NewClient(ts.URL), params, store, WithCallback(func(e StudyEvent) {
+			got = append(got, e.Survey.Idno)
+			cancel()
+		}))
+		assert.ErrorIs(t, w.Run(runCtx), context.Canceled)
+		assert.Equal(t, []string{"G"}, got)
+	})
+
+	t.Run("search errors", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+
+		_, err := NewWatcher(NewClient(failing.URL), params, store).Poll(ctx)
+		assert.IsType(t, FetchErr{}, err)
+	})
+}
+
+func TestWatcherReadsToCheckpoint(t *testing.T) {
+	catalog := &fakeCatalog{}
+	for i := 1; i <= 25; i++ {
+		changed := time.Date(2021, 1, i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		catalog.add("S"+strconv.Itoa(i), changed, changed)
+	}
+	ts := httptest.NewServer(catalog)
+	defer ts.Close()
+
+	ctx := context.Background()
+	params := NewDefaultSearchParams()
+	params.Ps = 2
+	since := WithSince(time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC))
+
+	t.Run("a limited poll fails rather than skip studies", func(t *testing.T) {
+		store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+		_, err := NewWatcher(NewClient(ts.URL), params, store, since, WithMaxPages(10)).Poll(ctx)
+		assert.EqualError(t, err, "Application side error: more than 10 pages of studies changed since the watcher checkpoint with statuscode: 1001")
+
+		cp, err := store.Load()
+		assert.NoError(t, err)
+		assert.True(t, cp.Changed.IsZero(), "checkpoint should not move")
+	})
+
+	t.Run("polls read every page since the checkpoint", func(t *testing.T) {
+		store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+		client := NewClient(ts.URL, WithCache(time.Hour, 100))
+
+		events, err := NewWatcher(client, params, store, since).Poll(ctx)
+		assert.NoError(t, err)
+		assert.Len(t, events, 25)
+		assert.Equal(t, "S1", events[0].Survey.Idno)
+
+		// polls skip the cache, so a change is seen straight away
+		catalog.add("S26", "2021-02-01T00:00:00Z", "2021-02-01T00:00:00Z")
+		events, err = NewWatcher(client, params, store, since).Poll(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"added:S26"}, eventIdnos(events))
+	})
+}
+
+func TestWatcherRunRetries(t *testing.T) {
+	catalog := &fakeCatalog{}
+	catalog.add("A", "2021-01-01T00:00:00Z", "2021-01-01T00:00:00Z")
+
+	var mu sync.Mutex
+	failures := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures > 0
+		failures--
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		catalog.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	client := NewClient(ts.URL, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	store := FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var got []string
+	w := NewWatcher(client, NewDefaultSearchParams(), store, WithInterval(10*time.Millisecond), WithCallback(func(e StudyEvent) {
+		got = append(got, e.Survey.Idno)
+		cancel()
+	}))
+	assert.ErrorIs(t, w.Run(ctx), context.Canceled)
+	assert.Equal(t, []string{"A"}, got)
+	assert.Equal(t, 2, strings.Count(logs.String(), "nadago: watcher poll failed"))
+}